@@ -0,0 +1,14 @@
+package amqp
+
+import "testing"
+
+func TestHealthCheck(t *testing.T) {
+	session := &Session{name: "test", done: make(chan bool)}
+	if session.HealthCheck() == nil {
+		t.Fatal("session not ready must fail the check")
+	}
+	session.setReady(true)
+	if err := session.HealthCheck(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,263 @@
+package amqp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/lxf9601/go-common/logc"
+
+	"github.com/streadway/amqp"
+)
+
+var (
+	// ErrNack is returned when the broker rejects a published message,
+	// e.g. because a reject-publish queue is full.
+	ErrNack = errors.New("amqp: message nacked by the broker")
+
+	// errConfirmLost means the channel closed before the message was
+	// confirmed, it may or may not have reached the broker.
+	errConfirmLost = errors.New("amqp: channel closed before confirm")
+)
+
+// ReturnError is returned for a mandatory message the broker could
+// not route to any queue.
+type ReturnError struct {
+	Exchange  string
+	Key       string
+	ReplyCode uint16
+	ReplyText string
+}
+
+func (err *ReturnError) Error() string {
+	return fmt.Sprintf("amqp: message returned from exchange %q with key %q: %d %s",
+		err.Exchange, err.Key, err.ReplyCode, err.ReplyText)
+}
+
+// Confirm is the pending broker confirmation of a published message.
+type Confirm struct {
+	tag       uint64
+	messageId string
+	done      chan struct{}
+	err       error
+	returned  *ReturnError
+}
+
+// DeliveryTag is the tag the broker confirms the message with,
+// unique per channel.
+func (confirm *Confirm) DeliveryTag() uint64 {
+	return confirm.tag
+}
+
+// Done is closed once the message has been acked, nacked or the
+// channel it was published on has closed.
+func (confirm *Confirm) Done() <-chan struct{} {
+	return confirm.done
+}
+
+// Err reports the outcome once Done is closed: nil when acked,
+// ErrNack when nacked, a *ReturnError when a mandatory message was
+// unroutable, or an error when the channel closed first.
+func (confirm *Confirm) Err() error {
+	select {
+	case <-confirm.done:
+		return confirm.err
+	default:
+		return nil
+	}
+}
+
+// Wait blocks until the message is confirmed or ctx is done.
+func (confirm *Confirm) Wait(ctx context.Context) error {
+	select {
+	case <-confirm.done:
+		return confirm.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// publishChannel is the part of *amqp.Channel used for publishing.
+type publishChannel interface {
+	Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+}
+
+// publisher tracks delivery tags of the messages published on one
+// channel in confirm mode. A new publisher is created for every
+// channel, since delivery tags restart at 1.
+type publisher struct {
+	name    string
+	channel publishChannel
+	lock    sync.Mutex // serialises Publish so that tags follow publish order
+	nextTag uint64
+
+	confirmsLock sync.Mutex
+	pending      map[uint64]*Confirm
+	returnable   map[string]*Confirm // mandatory messages by MessageId
+	closed       bool
+}
+
+func newPublisher(name string, channel publishChannel) *publisher {
+	return &publisher{
+		name:       name,
+		channel:    channel,
+		nextTag:    1,
+		pending:    make(map[uint64]*Confirm),
+		returnable: make(map[string]*Confirm),
+	}
+}
+
+// publish sends msg and, if track is set, returns a Confirm resolved
+// by the delivery tag. Mandatory messages get a MessageId when they
+// have none, to match them with basic.return.
+func (publisher *publisher) publish(exchange string, key string, mandatory bool, track bool,
+	msg amqp.Publishing) (*Confirm, error) {
+	publisher.lock.Lock()
+	defer publisher.lock.Unlock()
+	var confirm *Confirm
+	if track {
+		if mandatory && msg.MessageId == "" {
+			msg.MessageId = newMessageId()
+		}
+		confirm = &Confirm{tag: publisher.nextTag, done: make(chan struct{})}
+		if mandatory {
+			confirm.messageId = msg.MessageId
+		}
+		publisher.confirmsLock.Lock()
+		if publisher.closed {
+			publisher.confirmsLock.Unlock()
+			return nil, errNotConnected
+		}
+		// registered before publishing, the confirm may arrive before Publish returns
+		publisher.pending[confirm.tag] = confirm
+		if confirm.messageId != "" {
+			publisher.returnable[confirm.messageId] = confirm
+		}
+		publisher.confirmsLock.Unlock()
+	}
+	err := publisher.channel.Publish(exchange, key, mandatory, false, msg)
+	if err != nil {
+		publishTotal.Inc(publisher.name, "error")
+		if confirm != nil {
+			publisher.confirmsLock.Lock()
+			publisher.forget(confirm)
+			publisher.confirmsLock.Unlock()
+		}
+		return nil, err
+	}
+	publishTotal.Inc(publisher.name, "ok")
+	publisher.nextTag++
+	return confirm, nil
+}
+
+// forget removes a pending confirm, confirmsLock must be held.
+func (publisher *publisher) forget(confirm *Confirm) {
+	delete(publisher.pending, confirm.tag)
+	if confirm.messageId != "" {
+		delete(publisher.returnable, confirm.messageId)
+	}
+}
+
+// handle resolves confirms until the channel closes, then fails the
+// messages still pending. The broker sends basic.return before the
+// ack of the same message, so returns are drained before each ack.
+func (publisher *publisher) handle(confirms <-chan amqp.Confirmation, returns <-chan amqp.Return) {
+	for {
+		select {
+		case ret, ok := <-returns:
+			if !ok {
+				returns = nil
+				continue
+			}
+			publisher.returned(ret)
+		case confirm, ok := <-confirms:
+			if !ok {
+				publisher.close()
+				return
+			}
+		drain:
+			for returns != nil {
+				select {
+				case ret, ok := <-returns:
+					if !ok {
+						returns = nil
+						break drain
+					}
+					publisher.returned(ret)
+				default:
+					break drain
+				}
+			}
+			publisher.confirm(confirm)
+		}
+	}
+}
+
+// returned records an unroutable mandatory message.
+func (publisher *publisher) returned(ret amqp.Return) {
+	publisher.confirmsLock.Lock()
+	defer publisher.confirmsLock.Unlock()
+	confirm, ok := publisher.returnable[ret.MessageId]
+	if !ok {
+		confirmsTotal.Inc(publisher.name, "returned")
+		logc.Warnf("Amqp message returned from %q with key %q: %d %s",
+			ret.Exchange, ret.RoutingKey, ret.ReplyCode, ret.ReplyText)
+		return
+	}
+	delete(publisher.returnable, ret.MessageId)
+	confirm.returned = &ReturnError{Exchange: ret.Exchange, Key: ret.RoutingKey,
+		ReplyCode: ret.ReplyCode, ReplyText: ret.ReplyText}
+}
+
+// confirm resolves the message with the given delivery tag.
+func (publisher *publisher) confirm(c amqp.Confirmation) {
+	publisher.confirmsLock.Lock()
+	confirm, ok := publisher.pending[c.DeliveryTag]
+	if ok {
+		publisher.forget(confirm)
+	}
+	publisher.confirmsLock.Unlock()
+	switch {
+	case !c.Ack:
+		confirmsTotal.Inc(publisher.name, "nack")
+	case ok && confirm.returned != nil:
+		confirmsTotal.Inc(publisher.name, "returned")
+	default:
+		confirmsTotal.Inc(publisher.name, "ack")
+	}
+	if !ok {
+		return
+	}
+	switch {
+	case !c.Ack:
+		confirm.err = ErrNack
+	case confirm.returned != nil:
+		confirm.err = confirm.returned
+	}
+	close(confirm.done)
+}
+
+// close fails all pending messages once the channel has closed.
+func (publisher *publisher) close() {
+	publisher.confirmsLock.Lock()
+	publisher.closed = true
+	pending := publisher.pending
+	publisher.pending = make(map[uint64]*Confirm)
+	publisher.returnable = make(map[string]*Confirm)
+	publisher.confirmsLock.Unlock()
+	for _, confirm := range pending {
+		confirmsTotal.Inc(publisher.name, "lost")
+		confirm.err = errConfirmLost
+		close(confirm.done)
+	}
+}
+
+// newMessageId generates a random message id.
+func newMessageId() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
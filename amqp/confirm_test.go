@@ -0,0 +1,158 @@
+package amqp
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// fakeChannel acts as a broker, confirming every publish in order
+// and returning mandatory messages sent with the "unroutable" key.
+type fakeChannel struct {
+	lock     sync.Mutex
+	tag      uint64
+	confirms chan amqp.Confirmation
+	returns  chan amqp.Return
+	err      error
+	messages []amqp.Publishing
+}
+
+func (channel *fakeChannel) Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	channel.lock.Lock()
+	defer channel.lock.Unlock()
+	if channel.err != nil {
+		return channel.err
+	}
+	channel.tag++
+	tag := channel.tag
+	channel.messages = append(channel.messages, msg)
+	if mandatory && key == "unroutable" {
+		channel.returns <- amqp.Return{ReplyCode: 312, ReplyText: "NO_ROUTE", Exchange: exchange, RoutingKey: key,
+			MessageId: msg.MessageId}
+	}
+	channel.confirms <- amqp.Confirmation{DeliveryTag: tag, Ack: key != "nack"}
+	return nil
+}
+
+func newFakePublisher() (*publisher, *fakeChannel) {
+	channel := &fakeChannel{confirms: make(chan amqp.Confirmation, 1024), returns: make(chan amqp.Return, 1024)}
+	publisher := newPublisher("test", channel)
+	go publisher.handle(channel.confirms, channel.returns)
+	return publisher, channel
+}
+
+func TestPublisherConcurrentConfirms(t *testing.T) {
+	publisher, channel := newFakePublisher()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// pipeline several messages per goroutine before waiting
+			var confirms []*Confirm
+			for j := 0; j < 10; j++ {
+				confirm, err := publisher.publish("ex", "key."+strconv.Itoa(i), false, true, amqp.Publishing{})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				confirms = append(confirms, confirm)
+			}
+			for _, confirm := range confirms {
+				if err := confirm.Wait(context.Background()); err != nil {
+					t.Error(confirm.DeliveryTag(), err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if channel.tag != 200 || len(publisher.pending) != 0 {
+		t.Fatal(channel.tag, len(publisher.pending))
+	}
+
+	if _, err := publisher.publish("ex", "key", false, false, amqp.Publishing{}); err != nil {
+		t.Fatal(err)
+	}
+	confirm, err := publisher.publish("ex", "key", false, true, amqp.Publishing{})
+	if err != nil || confirm.DeliveryTag() != 202 || confirm.Wait(context.Background()) != nil {
+		t.Fatal("untracked publish must consume a delivery tag", confirm.DeliveryTag(), err)
+	}
+}
+
+func TestPublisherNackAndReturn(t *testing.T) {
+	published := publishTotal.Value("test", "ok")
+	acks := confirmsTotal.Value("test", "ack")
+	nacks := confirmsTotal.Value("test", "nack")
+	returns := confirmsTotal.Value("test", "returned")
+	publisher, _ := newFakePublisher()
+	confirm, err := publisher.publish("ex", "nack", false, true, amqp.Publishing{})
+	if err != nil || confirm.Wait(context.Background()) != ErrNack {
+		t.Fatal("nack not reported", err)
+	}
+
+	confirm, err = publisher.publish("ex", "unroutable", true, true, amqp.Publishing{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = confirm.Wait(context.Background())
+	if ret, ok := err.(*ReturnError); !ok || ret.ReplyCode != 312 || ret.Key != "unroutable" {
+		t.Fatal("mandatory return not reported", err)
+	}
+	confirm, err = publisher.publish("ex", "routable", true, true, amqp.Publishing{})
+	if err != nil || confirm.Wait(context.Background()) != nil {
+		t.Fatal("routable mandatory message failed", err)
+	}
+	if len(publisher.returnable) != 0 {
+		t.Fatal(publisher.returnable)
+	}
+	if publishTotal.Value("test", "ok") != published+3 || confirmsTotal.Value("test", "ack") != acks+1 ||
+		confirmsTotal.Value("test", "nack") != nacks+1 || confirmsTotal.Value("test", "returned") != returns+1 {
+		t.Fatal("confirms not counted", publishTotal.Value("test", "ok")-published,
+			confirmsTotal.Value("test", "ack")-acks, confirmsTotal.Value("test", "nack")-nacks,
+			confirmsTotal.Value("test", "returned")-returns)
+	}
+}
+
+func TestPublisherChannelClosed(t *testing.T) {
+	channel := &fakeChannel{confirms: make(chan amqp.Confirmation, 1), returns: make(chan amqp.Return, 1)}
+	publisher := newPublisher("test", channel)
+	confirm, err := publisher.publish("ex", "key", false, true, amqp.Publishing{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := confirm.Wait(ctx); err != context.DeadlineExceeded {
+		t.Fatal(err)
+	}
+	// the broker never confirms, then the channel closes
+	<-channel.confirms
+	close(channel.confirms)
+	close(channel.returns)
+	lost := confirmsTotal.Value("test", "lost")
+	publisher.handle(channel.confirms, channel.returns)
+	if err := confirm.Wait(context.Background()); err != errConfirmLost {
+		t.Fatal(err)
+	}
+	if confirmsTotal.Value("test", "lost") != lost+1 {
+		t.Fatal("lost confirm not counted")
+	}
+	if _, err := publisher.publish("ex", "key", false, true, amqp.Publishing{}); err != errNotConnected {
+		t.Fatal("publish on a closed publisher", err)
+	}
+
+	channel.err = errors.New("closed")
+	publisher = newPublisher("test", channel)
+	failed := publishTotal.Value("test", "error")
+	if _, err := publisher.publish("ex", "key", false, true, amqp.Publishing{}); err == nil || len(publisher.pending) != 0 {
+		t.Fatal("failed publish left pending", err)
+	}
+	if publishTotal.Value("test", "error") != failed+1 {
+		t.Fatal("failed publish not counted")
+	}
+}
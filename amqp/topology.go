@@ -0,0 +1,145 @@
+package amqp
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// Exchange types.
+const (
+	EXCHANGE_DIRECT  = amqp.ExchangeDirect
+	EXCHANGE_FANOUT  = amqp.ExchangeFanout
+	EXCHANGE_TOPIC   = amqp.ExchangeTopic
+	EXCHANGE_HEADERS = amqp.ExchangeHeaders
+)
+
+// Queue overflow behaviours when MaxLength or MaxLengthBytes is reached.
+const (
+	OVERFLOW_DROP_HEAD          = "drop-head"
+	OVERFLOW_REJECT_PUBLISH     = "reject-publish"
+	OVERFLOW_REJECT_PUBLISH_DLX = "reject-publish-dlx"
+)
+
+// Exchange describes an exchange declared on every (re)connect.
+type Exchange struct {
+	Name       string
+	Kind       string // EXCHANGE_DIRECT (default), EXCHANGE_FANOUT, EXCHANGE_TOPIC or EXCHANGE_HEADERS
+	Durable    bool   // survives broker restarts
+	AutoDelete bool   // deleted once the last binding is removed
+	Internal   bool   // only reachable through exchange-to-exchange bindings
+	Args       amqp.Table
+}
+
+// Queue describes a queue declared on every (re)connect. The
+// TTL, length and dead-letter fields are sent as the matching
+// x-* arguments and take precedence over the same keys in Args.
+type Queue struct {
+	Name                 string
+	Durable              bool          // survives broker restarts, required for persistent messages to survive
+	AutoDelete           bool          // deleted once the last consumer unsubscribes
+	Exclusive            bool          // only accessible by this connection, deleted when it closes
+	MessageTTL           time.Duration // x-message-ttl, discarded or dead-lettered after this long
+	Expires              time.Duration // x-expires, queue deleted after being unused this long
+	MaxLength            int           // x-max-length, maximum number of ready messages
+	MaxLengthBytes       int           // x-max-length-bytes, maximum size of ready message bodies
+	Overflow             string        // x-overflow, OVERFLOW_DROP_HEAD by default on the broker
+	DeadLetterExchange   string        // x-dead-letter-exchange, "" is the default exchange when DeadLetterRoutingKey is set
+	DeadLetterRoutingKey string        // x-dead-letter-routing-key, defaults to the message's routing key
+	Args                 amqp.Table
+}
+
+// Binding routes messages from an exchange to a queue.
+type Binding struct {
+	Queue    string
+	Exchange string
+	Key      string // routing key or pattern, ignored by fanout exchanges
+	Args     amqp.Table
+}
+
+// Topology is the set of exchanges, queues and bindings a session
+// declares every time its channel is (re)established, so that a
+// broker restart or failover does not lose the routing setup.
+// Declarations are idempotent as long as the definitions match the
+// existing entities; a mismatch closes the channel and is retried.
+type Topology struct {
+	Exchanges []Exchange
+	Queues    []Queue
+	Bindings  []Binding
+}
+
+// arguments builds the x-* queue arguments.
+func (q *Queue) arguments() amqp.Table {
+	args := amqp.Table{}
+	for k, v := range q.Args {
+		args[k] = v
+	}
+	if q.MessageTTL > 0 {
+		args["x-message-ttl"] = int64(q.MessageTTL / time.Millisecond)
+	}
+	if q.Expires > 0 {
+		args["x-expires"] = int64(q.Expires / time.Millisecond)
+	}
+	if q.MaxLength > 0 {
+		args["x-max-length"] = int64(q.MaxLength)
+	}
+	if q.MaxLengthBytes > 0 {
+		args["x-max-length-bytes"] = int64(q.MaxLengthBytes)
+	}
+	if q.Overflow != "" {
+		args["x-overflow"] = q.Overflow
+	}
+	if q.DeadLetterExchange != "" || q.DeadLetterRoutingKey != "" {
+		args["x-dead-letter-exchange"] = q.DeadLetterExchange
+	}
+	if q.DeadLetterRoutingKey != "" {
+		args["x-dead-letter-routing-key"] = q.DeadLetterRoutingKey
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	return args
+}
+
+// declares reports whether the topology declares the named queue.
+func (t *Topology) declares(queue string) bool {
+	for _, q := range t.Queues {
+		if q.Name == queue {
+			return true
+		}
+	}
+	return false
+}
+
+// declareChannel is the part of *amqp.Channel used for declaring.
+type declareChannel interface {
+	ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error
+}
+
+// declare declares the exchanges, then the queues, then the bindings.
+func (t *Topology) declare(ch declareChannel) error {
+	for _, e := range t.Exchanges {
+		kind := e.Kind
+		if kind == "" {
+			kind = EXCHANGE_DIRECT
+		}
+		if err := ch.ExchangeDeclare(e.Name, kind, e.Durable, e.AutoDelete, e.Internal, false, e.Args); err != nil {
+			return fmt.Errorf("declare exchange %s: %w", e.Name, err)
+		}
+	}
+	for i := range t.Queues {
+		q := &t.Queues[i]
+		if _, err := ch.QueueDeclare(q.Name, q.Durable, q.AutoDelete, q.Exclusive, false, q.arguments()); err != nil {
+			return fmt.Errorf("declare queue %s: %w", q.Name, err)
+		}
+	}
+	for _, b := range t.Bindings {
+		if err := ch.QueueBind(b.Queue, b.Key, b.Exchange, false, b.Args); err != nil {
+			return fmt.Errorf("bind queue %s to %s: %w", b.Queue, b.Exchange, err)
+		}
+	}
+	return nil
+}
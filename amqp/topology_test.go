@@ -0,0 +1,139 @@
+package amqp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+func TestQueueArguments(t *testing.T) {
+	tests := []struct {
+		name  string
+		queue Queue
+		args  amqp.Table
+	}{
+		{"empty", Queue{}, nil},
+		{"args only", Queue{Args: amqp.Table{"x-queue-type": "quorum"}}, amqp.Table{"x-queue-type": "quorum"}},
+		{"fields", Queue{MessageTTL: time.Minute, Expires: time.Hour, MaxLength: 10, MaxLengthBytes: 1024,
+			Overflow: OVERFLOW_REJECT_PUBLISH}, amqp.Table{"x-message-ttl": int64(60000), "x-expires": int64(3600000),
+			"x-max-length": int64(10), "x-max-length-bytes": int64(1024), "x-overflow": OVERFLOW_REJECT_PUBLISH}},
+		{"fields take precedence over args", Queue{MaxLength: 10, Args: amqp.Table{"x-max-length": int64(5), "x-priority": 1}},
+			amqp.Table{"x-max-length": int64(10), "x-priority": 1}},
+		{"unset fields keep args", Queue{Args: amqp.Table{"x-max-length": int64(5)}}, amqp.Table{"x-max-length": int64(5)}},
+		{"dead letter exchange", Queue{DeadLetterExchange: "dlx"}, amqp.Table{"x-dead-letter-exchange": "dlx"}},
+		{"dead letter key uses the default exchange", Queue{DeadLetterRoutingKey: "failed"},
+			amqp.Table{"x-dead-letter-exchange": "", "x-dead-letter-routing-key": "failed"}},
+		{"dead letter key overrides args", Queue{DeadLetterRoutingKey: "failed", Args: amqp.Table{"x-dead-letter-exchange": "old"}},
+			amqp.Table{"x-dead-letter-exchange": "", "x-dead-letter-routing-key": "failed"}},
+	}
+	for _, test := range tests {
+		if args := test.queue.arguments(); !reflect.DeepEqual(args, test.args) {
+			t.Errorf("%s: %v, expected %v", test.name, args, test.args)
+		}
+	}
+
+	// arguments must not modify Args
+	q := Queue{MaxLength: 10, Args: amqp.Table{"x-max-length": int64(5)}}
+	q.arguments()
+	if q.Args["x-max-length"] != int64(5) {
+		t.Fatal(q.Args)
+	}
+}
+
+// fakeDeclareChannel records declarations in order and fails the
+// one whose name is in fail.
+type fakeDeclareChannel struct {
+	calls []string
+	fail  string
+}
+
+func (channel *fakeDeclareChannel) call(call string, name string) error {
+	channel.calls = append(channel.calls, call)
+	if name == channel.fail {
+		return errors.New("precondition failed")
+	}
+	return nil
+}
+
+func (channel *fakeDeclareChannel) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error {
+	return channel.call(fmt.Sprintf("exchange %s %s durable=%t", name, kind, durable), name)
+}
+
+func (channel *fakeDeclareChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	return amqp.Queue{Name: name}, channel.call(fmt.Sprintf("queue %s durable=%t args=%d", name, durable, len(args)), name)
+}
+
+func (channel *fakeDeclareChannel) QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error {
+	return channel.call(fmt.Sprintf("bind %s %s %s", name, key, exchange), name)
+}
+
+func TestSessionDeclare(t *testing.T) {
+	topology := &Topology{
+		Bindings: []Binding{{Queue: "orders", Exchange: "events", Key: "order.*"}},
+		Queues: []Queue{{Name: "orders", Durable: true, DeadLetterExchange: "dlx"},
+			{Name: "orders.failed", Durable: true}},
+		Exchanges: []Exchange{{Name: "events", Kind: EXCHANGE_TOPIC, Durable: true}, {Name: "dlx"}},
+	}
+	tests := []struct {
+		name     string
+		session  *Session
+		fail     string
+		calls    []string
+		expected string
+	}{
+		{"no topology declares the session queue", &Session{name: "legacy"}, "",
+			[]string{"queue legacy durable=false args=0"}, ""},
+		{"topology then the session queue", &Session{name: "legacy", topology: topology}, "", []string{
+			"exchange events topic durable=true", "exchange dlx direct durable=false",
+			"queue orders durable=true args=1", "queue orders.failed durable=true args=0",
+			"bind orders order.* events", "queue legacy durable=false args=0"}, ""},
+		{"topology declaring the session queue", &Session{name: "orders", topology: topology}, "", []string{
+			"exchange events topic durable=true", "exchange dlx direct durable=false",
+			"queue orders durable=true args=1", "queue orders.failed durable=true args=0",
+			"bind orders order.* events"}, ""},
+		{"failure stops declaring", &Session{name: "orders", topology: topology}, "dlx", []string{
+			"exchange events topic durable=true", "exchange dlx direct durable=false"}, "declare exchange dlx"},
+	}
+	for _, test := range tests {
+		channel := &fakeDeclareChannel{fail: test.fail}
+		err := test.session.declare(channel)
+		if !reflect.DeepEqual(channel.calls, test.calls) {
+			t.Errorf("%s: %q, expected %q", test.name, channel.calls, test.calls)
+		}
+		if test.expected == "" && err != nil || test.expected != "" && (err == nil || !strings.Contains(err.Error(), test.expected)) {
+			t.Errorf("%s: %v", test.name, err)
+		}
+	}
+}
+
+func TestPublishDeliveryMode(t *testing.T) {
+	publisher, channel := newFakePublisher()
+	session := &Session{name: "test", done: make(chan bool), publisher: publisher, isReady: true}
+	if err := session.PublishMessage(context.Background(), "ex", "key", amqp.Publishing{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.PublishMessage(context.Background(), "ex", "key", amqp.Publishing{DeliveryMode: amqp.Transient}); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.UnsafePublish("ex", "key", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.UnsafePush("key", nil); err != nil {
+		t.Fatal(err)
+	}
+	expected := []uint8{amqp.Persistent, amqp.Transient, amqp.Persistent, 0}
+	for i, msg := range channel.messages {
+		if msg.DeliveryMode != expected[i] {
+			t.Fatal(i, msg.DeliveryMode)
+		}
+	}
+	if len(channel.messages) != len(expected) {
+		t.Fatal(len(channel.messages))
+	}
+}
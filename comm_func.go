@@ -35,26 +35,42 @@ const TIME_LAYOUT = "2006-01-02 15:04:05"
 const DATE_LAYOUT = "2006-01-02"
 const YEAR_LAYOUT = "2006"
 
+// Stack 获取当前goroutine的调用栈, kb为初始缓冲区大小, 不足时自动扩容
+func Stack(kb int) []byte {
+	size := kb << 10
+	if size <= 0 {
+		size = 4 << 10
+	}
+	for {
+		stack := make([]byte, size)
+		length := runtime.Stack(stack, false)
+		if length < size {
+			return stack[:length]
+		}
+		size <<= 1
+	}
+}
+
+// PanicTrace 获取panic发生处的调用栈, 需在recover所在的defer中调用
+// 只包含当前goroutine, 从引发panic的函数开始; 未找到panic帧时返回去掉goroutine头的完整调用栈
 func PanicTrace(kb int) []byte {
 	s := []byte("/src/runtime/panic.go")
-	e := []byte("\ngoroutine ")
-	line := []byte("\n")
-	stack := make([]byte, kb<<10) //4KB
-	length := runtime.Stack(stack, true)
-	start := bytes.Index(stack, s)
-	stack = stack[start:length]
-	start = bytes.Index(stack, line) + 1
-	stack = stack[start:]
-	end := bytes.LastIndex(stack, line)
-	if end != -1 {
-		stack = stack[:end]
+	sigpanic := []byte("runtime.sigpanic(")
+	lines := bytes.Split(Stack(kb), []byte("\n"))
+	start := 1
+	for i := 1; i < len(lines); i++ {
+		if len(lines[i]) > 0 && lines[i][0] == '\t' && bytes.Contains(lines[i], s) {
+			start = i + 1
+		}
+	}
+	// 空指针等运行时错误会多出sigpanic帧
+	for start+1 < len(lines) && bytes.HasPrefix(lines[start], sigpanic) {
+		start += 2
 	}
-	end = bytes.Index(stack, e)
-	if end != -1 {
-		stack = stack[:end]
+	if start > len(lines) {
+		start = len(lines)
 	}
-	stack = bytes.TrimRight(stack, "\n")
-	return stack
+	return bytes.TrimRight(bytes.Join(lines[start:], []byte("\n")), "\n")
 }
 
 func GetAppPath() (string, error) {
@@ -1,6 +1,7 @@
 package comm
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -10,3 +11,31 @@ func TestIpToAton(t *testing.T) {
 		t.Error()
 	}
 }
+
+func panicTraceHelper() {
+	var m map[string]int
+	m["a"] = 1
+}
+
+func TestPanicTrace(t *testing.T) {
+	var stack []byte
+	func() {
+		defer func() {
+			recover()
+			stack = PanicTrace(0)
+		}()
+		panicTraceHelper()
+	}()
+	if !strings.Contains(strings.SplitN(string(stack), "\n", 2)[0], "panicTraceHelper") {
+		t.Fatalf("trace should start at the panicking function:\n%s", stack)
+	}
+	if strings.HasPrefix(string(stack), "goroutine ") || strings.Contains(string(stack), "go-common.PanicTrace(") {
+		t.Fatalf("unexpected frames:\n%s", stack)
+	}
+
+	// 不在panic中调用时返回完整调用栈
+	stack = PanicTrace(1)
+	if !strings.Contains(string(stack), "TestPanicTrace") {
+		t.Fatalf("%s", stack)
+	}
+}
@@ -1,6 +1,10 @@
 package db
 
 import (
+	"context"
+	"errors"
+	"math/rand"
+	"strconv"
 	"sync"
 
 	"time"
@@ -31,6 +35,7 @@ func GetRedisService(addr string, password string, keyPrefix string, selectBb in
 			})
 			redisService.Client = client
 			redisService.KeyPrefix = keyPrefix
+			redisService.instrument()
 		}
 	}
 	return redisService
@@ -138,3 +143,145 @@ func (redis *Redis) Del(key string) *redis.IntCmd {
 func (redis *Redis) Expire(key string, expiration time.Duration) *redis.BoolCmd {
 	return redis.Client.Expire(redis.KeyPrefix+key, expiration)
 }
+
+// 键不存在时设置, 返回是否设置成功
+func (redis *Redis) SetNX(key string, value interface{}, expiration time.Duration) *redis.BoolCmd {
+	return redis.Client.SetNX(redis.KeyPrefix+key, value, expiration)
+}
+
+// 集合添加成员
+func (redis *Redis) SAdd(key string, members ...interface{}) *redis.IntCmd {
+	return redis.Client.SAdd(redis.KeyPrefix+key, members...)
+}
+
+// 集合删除成员
+func (redis *Redis) SRem(key string, members ...interface{}) *redis.IntCmd {
+	return redis.Client.SRem(redis.KeyPrefix+key, members...)
+}
+
+// 获取集合所有成员
+func (redis *Redis) SMembers(key string) *redis.StringSliceCmd {
+	return redis.Client.SMembers(redis.KeyPrefix + key)
+}
+
+// WithContext 返回使用ctx的副本, 共享连接池
+// ctx取消或超时后命令不再发送, 直接以ctx.Err()失败
+// go-redis v6无法中断已发送的命令, 其耗时仍由连接的ReadTimeout控制
+func (redis *Redis) WithContext(ctx context.Context) *Redis {
+	clone := *redis
+	clone.Client = redis.Client.WithContext(ctx)
+	clone.Client.WrapProcess(contextProcess(ctx))
+	clone.Client.WrapProcessPipeline(contextProcessPipeline(ctx))
+	return &clone
+}
+
+func contextProcess(ctx context.Context) func(old func(cmd redis.Cmder) error) func(cmd redis.Cmder) error {
+	return func(old func(cmd redis.Cmder) error) func(cmd redis.Cmder) error {
+		return func(cmd redis.Cmder) error {
+			if err := ctx.Err(); err != nil {
+				return rejectClient(err).Process(cmd)
+			}
+			return old(cmd)
+		}
+	}
+}
+
+func contextProcessPipeline(ctx context.Context) func(old func(cmds []redis.Cmder) error) func(cmds []redis.Cmder) error {
+	return func(old func(cmds []redis.Cmder) error) func(cmds []redis.Cmder) error {
+		return func(cmds []redis.Cmder) error {
+			if err := ctx.Err(); err != nil {
+				pipe := rejectClient(err).Pipeline()
+				for _, cmd := range cmds {
+					pipe.Process(cmd)
+				}
+				_, err = pipe.Exec()
+				return err
+			}
+			return old(cmds)
+		}
+	}
+}
+
+var (
+	rejectClients     = make(map[error]*redis.Client)
+	rejectClientsLock sync.Mutex
+)
+
+// rejectClient 返回以err拒绝全部命令的客户端, 用于为未发送的命令设置错误, 不会建立连接
+func rejectClient(err error) *redis.Client {
+	if err != context.DeadlineExceeded {
+		err = context.Canceled
+	}
+	rejectClientsLock.Lock()
+	defer rejectClientsLock.Unlock()
+	client := rejectClients[err]
+	if client == nil {
+		client = redis.NewClient(&redis.Options{IdleTimeout: -1})
+		client.SetLimiter(rejectLimiter{err})
+		rejectClients[err] = client
+	}
+	return client
+}
+
+// rejectLimiter 拒绝全部命令
+type rejectLimiter struct {
+	err error
+}
+
+func (limiter rejectLimiter) Allow() error {
+	return limiter.err
+}
+
+func (limiter rejectLimiter) ReportResult(result error) {}
+
+// 发布频道消息
+func (redis *Redis) Publish(channel string, message interface{}) *redis.IntCmd {
+	return redis.Client.Publish(redis.KeyPrefix+channel, message)
+}
+
+// 订阅频道, 收到的消息频道名包含KeyPrefix
+func (redis *Redis) Subscribe(channels ...string) *redis.PubSub {
+	prefixed := make([]string, len(channels))
+	for i, channel := range channels {
+		prefixed[i] = redis.KeyPrefix + channel
+	}
+	return redis.Client.Subscribe(prefixed...)
+}
+
+// 滑动窗口限流脚本, 返回 {是否允许, 剩余次数, 窗口重置毫秒数}
+const slidingWindowScript = `
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+redis.call('zremrangebyscore', KEYS[1], 0, now - window)
+local count = redis.call('zcard', KEYS[1])
+if count < limit then
+	redis.call('zadd', KEYS[1], now, ARGV[4])
+	redis.call('pexpire', KEYS[1], window)
+	local oldest = redis.call('zrange', KEYS[1], 0, 0, 'withscores')
+	return {1, limit - count - 1, tonumber(oldest[2]) + window - now}
+end
+local oldest = redis.call('zrange', KEYS[1], 0, 0, 'withscores')
+return {0, 0, tonumber(oldest[2]) + window - now}`
+
+// 滑动窗口限流, 窗口内最多允许limit次请求, 返回是否允许、剩余次数及窗口重置时间
+func (redis *Redis) SlidingWindow(key string, limit int64, window time.Duration) (bool, int64, time.Duration, error) {
+	if limit <= 0 || window < time.Millisecond {
+		return false, 0, 0, errors.New("redis sliding window: limit must be positive and window at least 1ms")
+	}
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	member := strconv.FormatInt(time.Now().UnixNano(), 10) + "-" + strconv.FormatInt(rand.Int63(), 36)
+	res, err := redis.Client.Eval(slidingWindowScript, []string{redis.KeyPrefix + key},
+		now, int64(window/time.Millisecond), limit, member).Result()
+	if err != nil {
+		return false, 0, 0, err
+	}
+	vals, ok := res.([]interface{})
+	if !ok || len(vals) != 3 {
+		return false, 0, 0, errors.New("redis sliding window: unexpected result")
+	}
+	allowed, _ := vals[0].(int64)
+	remaining, _ := vals[1].(int64)
+	resetMs, _ := vals[2].(int64)
+	return allowed == 1, remaining, time.Duration(resetMs) * time.Millisecond, nil
+}
@@ -0,0 +1,42 @@
+package db
+
+import (
+	"time"
+
+	goredis "github.com/go-redis/redis"
+	"github.com/lxf9601/go-common/metrics"
+)
+
+var (
+	commandDuration = metrics.NewHistogram("redis_command_duration_seconds",
+		"Redis command latency in seconds.", []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1}, "command")
+	commandErrors = metrics.NewCounter("redis_command_errors_total",
+		"Number of failed Redis commands, excluding nil replies.", "command")
+)
+
+// instrument 为客户端添加命令耗时与错误统计
+func (redis *Redis) instrument() {
+	redis.Client.WrapProcess(func(old func(cmd goredis.Cmder) error) func(cmd goredis.Cmder) error {
+		return func(cmd goredis.Cmder) error {
+			start := time.Now()
+			err := old(cmd)
+			observeCommand(cmd.Name(), start, err)
+			return err
+		}
+	})
+	redis.Client.WrapProcessPipeline(func(old func(cmds []goredis.Cmder) error) func(cmds []goredis.Cmder) error {
+		return func(cmds []goredis.Cmder) error {
+			start := time.Now()
+			err := old(cmds)
+			observeCommand("pipeline", start, err)
+			return err
+		}
+	})
+}
+
+func observeCommand(name string, start time.Time, err error) {
+	commandDuration.Observe(time.Since(start).Seconds(), name)
+	if err != nil && err != goredis.Nil {
+		commandErrors.Inc(name)
+	}
+}
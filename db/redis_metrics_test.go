@@ -0,0 +1,45 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/go-redis/redis"
+)
+
+func TestRedisMetrics(t *testing.T) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	redis := &Redis{Client: goredis.NewClient(&goredis.Options{Addr: server.Addr()}), KeyPrefix: "test:"}
+	defer redis.Close()
+	redis.instrument()
+
+	gets := commandDuration.Count("get")
+	getErrors := commandErrors.Value("get")
+	incrErrors := commandErrors.Value("incr")
+	pipelines := commandDuration.Count("pipeline")
+
+	if err := redis.Get("missing").Err(); err != goredis.Nil {
+		t.Fatal(err)
+	}
+	redis.Set("name", "value", 0)
+	if _, err := redis.Incr("name"); err == nil {
+		t.Fatal("incr on a string must fail")
+	}
+	pipe := redis.Client.Pipeline()
+	pipe.Get("test:name")
+	pipe.Get("test:name")
+	if _, err := pipe.Exec(); err != nil {
+		t.Fatal(err)
+	}
+
+	if commandDuration.Count("get") != gets+1 || commandDuration.Count("pipeline") != pipelines+1 {
+		t.Fatal("commands not observed", commandDuration.Count("get")-gets, commandDuration.Count("pipeline")-pipelines)
+	}
+	if commandErrors.Value("get") != getErrors || commandErrors.Value("incr") != incrErrors+1 {
+		t.Fatal("nil reply counted as an error or failure not counted")
+	}
+}
@@ -0,0 +1,43 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/go-redis/redis"
+)
+
+func TestRedisWithContext(t *testing.T) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	redis := &Redis{Client: goredis.NewClient(&goredis.Options{Addr: server.Addr()}), KeyPrefix: "test:"}
+	defer redis.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := redis.WithContext(ctx)
+	if err := r.Set("name", "value", 0); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if v, err := r.Get("name").Result(); err != context.Canceled || v != "" {
+		t.Fatal(v, err)
+	}
+	pipe := r.Client.Pipeline()
+	get := pipe.Get("test:name")
+	if _, err := pipe.Exec(); err != context.Canceled || get.Err() != context.Canceled {
+		t.Fatal(err, get.Err())
+	}
+	if v, err := redis.Get("name").Result(); err != nil || v != "value" {
+		t.Fatal("original client affected", v, err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	if _, err := redis.WithContext(ctx).Incr("count"); err != context.DeadlineExceeded || server.Exists("test:count") {
+		t.Fatal("command sent after deadline", err)
+	}
+}
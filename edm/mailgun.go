@@ -137,7 +137,18 @@ type MailgunLogPageData struct {
 }
 
 // ListMgEvent 查询mailgun日志
-func ListMgEvent(query *MailgunQuery, auth *Auth) (
+func ListMgEvent(query *MailgunQuery, auth *Auth) (*MailgunLogPageData, error) {
+	pageData, err := listMgEvent(query, auth)
+	apiRequestsTotal.Inc(supplierName(SUPPLIER_MAILGUN), "events", resultLabel(err))
+	if err == nil {
+		for _, event := range pageData.List {
+			observeEvent(SUPPLIER_MAILGUN, event.EventType)
+		}
+	}
+	return pageData, err
+}
+
+func listMgEvent(query *MailgunQuery, auth *Auth) (
 	*MailgunLogPageData, error) {
 	pageData := new(MailgunLogPageData)
 	req := fasthttp.AcquireRequest()
@@ -319,7 +330,7 @@ func ListMgEvent(query *MailgunQuery, auth *Auth) (
 				}
 			}
 		} else {
-			logc.Error("mailgun event api error:%s", err)
+			logc.Errorf("mailgun event api error:%s", err)
 			return nil, errors.New("mailgun api error")
 		}
 	} else {
@@ -0,0 +1,47 @@
+package edm
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func newMailgunTestServer(t *testing.T, handler fasthttp.RequestHandler) (*Auth, func()) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go fasthttp.Serve(ln, handler)
+	return &Auth{Url: "http://" + ln.Addr().String() + "/v3/example.com", Key: "key-1"}, func() { ln.Close() }
+}
+
+func TestObserveSend(t *testing.T) {
+	sent := sendTotal.Value("mailgun", "ok")
+	failed := sendTotal.Value("sendgrid", "error")
+	ObserveSend(SUPPLIER_MAILGUN, nil)
+	ObserveSend(SUPPLIER_SENDGRID, errors.New("rejected"))
+	if sendTotal.Value("mailgun", "ok") != sent+1 || sendTotal.Value("sendgrid", "error") != failed+1 {
+		t.Fatal("send not counted")
+	}
+}
+
+func TestListMgEventMetrics(t *testing.T) {
+	auth, closeFn := newMailgunTestServer(t, func(ctx *fasthttp.RequestCtx) {
+		ctx.SetBodyString(`{"items":[{"event":"delivered","timestamp":1600000000.5,"recipient":"a@example.com",` +
+			`"user-variables":{},"tags":[],"envelope":{"sender":"shop@example.com"},"message":{"headers":{}},` +
+			`"delivery-status":{"mx-host":"mx.example.com"}}],"paging":{"next":"n"}}`)
+	})
+	defer closeFn()
+
+	delivered := eventsTotal.Value("mailgun", "delivered")
+	calls := apiRequestsTotal.Value("mailgun", "events", "ok")
+	pageData, err := ListMgEvent(&MailgunQuery{Limit: 10}, auth)
+	if err != nil || len(pageData.List) != 1 || pageData.Next != "n" {
+		t.Fatal(pageData, err)
+	}
+	if eventsTotal.Value("mailgun", "delivered") != delivered+1 || apiRequestsTotal.Value("mailgun", "events", "ok") != calls+1 {
+		t.Fatal("events not counted")
+	}
+}
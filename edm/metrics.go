@@ -0,0 +1,60 @@
+package edm
+
+import (
+	"strconv"
+
+	"github.com/lxf9601/go-common/metrics"
+)
+
+var (
+	apiRequestsTotal = metrics.NewCounter("edm_api_requests_total",
+		"Number of mail supplier API calls.", "supplier", "api", "result")
+	sendTotal = metrics.NewCounter("edm_send_total",
+		"Number of mail send requests by result.", "supplier", "result")
+	eventsTotal = metrics.NewCounter("edm_events_total",
+		"Number of mail events fetched from suppliers.", "supplier", "event")
+)
+
+var supplierNames = map[int]string{
+	SUPPLIER_MAILGUN:  "mailgun",
+	SUPPLIER_SENDGRID: "sendgrid",
+}
+
+var eventNames = map[int8]string{
+	EVENT_DELIVERED:    "delivered",
+	EVENT_OPENED:       "opened",
+	EVENT_CLICKED:      "clicked",
+	EVENT_UNSUBSCRIBED: "unsubscribed",
+	EVENT_COMPLAINED:   "complained",
+	EVENT_DROPPED:      "dropped",
+	EVENT_BOUNCED:      "bounced",
+	EVENT_FAILED:       "failed",
+}
+
+func supplierName(supplier int) string {
+	if name, ok := supplierNames[supplier]; ok {
+		return name
+	}
+	return strconv.Itoa(supplier)
+}
+
+func resultLabel(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+// ObserveSend 记录一次邮件发送结果, 供发送任务调用
+func ObserveSend(supplier int, err error) {
+	sendTotal.Inc(supplierName(supplier), resultLabel(err))
+}
+
+// observeEvent 记录拉取到的邮件事件
+func observeEvent(supplier int, eventType int8) {
+	name, ok := eventNames[eventType]
+	if !ok {
+		name = "unknown"
+	}
+	eventsTotal.Inc(supplierName(supplier), name)
+}
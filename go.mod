@@ -3,14 +3,19 @@ module github.com/lxf9601/go-common
 go 1.15
 
 require (
+	github.com/alicebob/miniredis/v2 v2.17.0
 	github.com/davecgh/go-spew v1.1.1
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
-	github.com/go-redis/redis v6.15.9+incompatible // indirect
-	github.com/go-sql-driver/mysql v1.6.0 // indirect
+	github.com/fasthttp/websocket v1.5.0
+	github.com/go-redis/redis v6.15.9+incompatible
+	github.com/go-sql-driver/mysql v1.6.0
 	github.com/gogap/errors v0.0.0-20210818113853-edfbba0ddea9 // indirect
 	github.com/gogap/logrus v0.8.2
 	github.com/gogap/stack v0.0.0-20150131034635-fef68dddd4f8 // indirect
 	github.com/jinzhu/configor v1.2.1
-	github.com/streadway/amqp v1.0.0 // indirect
-	github.com/valyala/fasthttp v1.39.0 // indirect
+	github.com/json-iterator/go v1.1.12
+	github.com/streadway/amqp v1.0.0
+	github.com/valyala/fasthttp v1.39.0
+	github.com/vmihailenco/msgpack/v5 v5.3.5
+	google.golang.org/protobuf v1.28.1
 )
@@ -0,0 +1,115 @@
+package http
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	mrand "math/rand"
+	"time"
+
+	"github.com/lxf9601/go-common/logc"
+)
+
+const HEADER_REQUEST_ID = "X-Request-ID"
+
+// 客户端传入的请求ID最大长度
+const maxRequestIdLen = 128
+
+// NewRequestID 生成随机请求ID
+func NewRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validRequestID 校验客户端传入的请求ID, 只允许可见ASCII字符
+func validRequestID(id []byte) bool {
+	if len(id) == 0 || len(id) > maxRequestIdLen {
+		return false
+	}
+	for _, b := range id {
+		if b <= ' ' || b > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// RequestID 请求ID中间件, 沿用合法的X-Request-ID请求头, 否则生成新ID, 并写入响应头
+func RequestID() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(c *HttpContext) {
+			id := c.RawCtx.Request.Header.Peek(HEADER_REQUEST_ID)
+			requestId := ""
+			if validRequestID(id) {
+				requestId = string(id)
+			} else {
+				requestId = NewRequestID()
+			}
+			c.SetRequestID(requestId)
+			c.RawCtx.Response.Header.Set(HEADER_REQUEST_ID, requestId)
+			next(c)
+		}
+	}
+}
+
+// 访问日志配置
+type AccessLogOptions struct {
+	SampleRate    float64       // 正常请求的采样比例, 0或1表示全部记录
+	SlowThreshold time.Duration // 慢请求阈值, 超过时以WARN级别记录且不受采样影响
+	UserClaim     string        // 用户标识在鉴权信息中的字段, 默认sub
+	SkipPaths     []string      // 不记录的路径, 如健康检查
+}
+
+// AccessLog 访问日志中间件, 记录方法、路径、路由、状态码、字节数、耗时、客户端IP及用户
+// 5xx及慢请求总是记录, 其余请求按SampleRate采样
+func AccessLog(options *AccessLogOptions) Middleware {
+	userClaim := options.UserClaim
+	if userClaim == "" {
+		userClaim = "sub"
+	}
+	skip := make(map[string]bool, len(options.SkipPaths))
+	for _, p := range options.SkipPaths {
+		skip[p] = true
+	}
+	return func(next HandlerFunc) HandlerFunc {
+		return func(c *HttpContext) {
+			if skip[string(c.RawCtx.Path())] {
+				next(c)
+				return
+			}
+			start := time.Now()
+			next(c)
+			latency := time.Since(start)
+
+			ctx := c.RawCtx
+			resp := c.response()
+			status := resp.StatusCode()
+			slow := options.SlowThreshold > 0 && latency >= options.SlowThreshold
+			if status < 500 && !slow && options.SampleRate > 0 && options.SampleRate < 1 &&
+				mrand.Float64() >= options.SampleRate {
+				return
+			}
+			size := resp.Header.ContentLength()
+			if !resp.IsBodyStream() {
+				size = len(resp.Body())
+			}
+			logger := c.Logger().WithFields(logc.Fields{
+				"method":     string(ctx.Method()),
+				"path":       string(ctx.Path()),
+				"route":      c.RoutePattern(),
+				"status":     status,
+				"bytes":      size,
+				"latency_ms": float64(latency.Microseconds()) / 1000,
+				"client_ip":  c.ClientIP(),
+				"user":       c.ClaimString(userClaim),
+			})
+			if status >= 500 {
+				logger.Error("access")
+			} else if slow {
+				logger.Warn("slow request")
+			} else {
+				logger.Info("access")
+			}
+		}
+	}
+}
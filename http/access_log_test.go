@@ -0,0 +1,63 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/gogap/logrus"
+	"github.com/valyala/fasthttp"
+)
+
+type accessLogTestController struct {
+	Controller
+}
+
+func (this *accessLogTestController) User(ctx *HttpContext) *ApiResponse {
+	return this.Success(ctx.FormString("id"))
+}
+
+func TestRequestIDAndAccessLog(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logrus.SetOutput(buf)
+	logrus.SetFormatter(&logrus.JSONFormatter{})
+	defer logrus.SetOutput(os.Stdout)
+	defer logrus.SetFormatter(&logrus.TextFormatter{})
+
+	router := new(Router)
+	router.Init()
+	router.Use(RequestID(), AccessLog(&AccessLogOptions{}))
+	var controller interface{} = &accessLogTestController{}
+	router.Any("/user/{id}", &controller, "User")
+	handler := HttpHandler("", router)
+
+	req := fasthttp.AcquireRequest()
+	req.SetRequestURI("/user/42")
+	req.Header.Set(HEADER_REQUEST_ID, "abc-123")
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Init(req, nil, nil)
+	handler(ctx)
+
+	if string(ctx.Response.Header.Peek(HEADER_REQUEST_ID)) != "abc-123" {
+		t.Fatal(ctx.Response.Header.String())
+	}
+	if string(ctx.Response.Body()) != `{"ret":0,"msg":"","data":"42"}` {
+		t.Fatal(string(ctx.Response.Body()))
+	}
+	entry := map[string]interface{}{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatal(buf.String())
+	}
+	if entry["request_id"] != "abc-123" || entry["route"] != "/user/{id}" ||
+		entry["path"] != "/user/42" || entry["status"] != float64(200) {
+		t.Fatal(buf.String())
+	}
+
+	req.Header.Set(HEADER_REQUEST_ID, "bad id\n")
+	ctx.Init(req, nil, nil)
+	handler(ctx)
+	if id := ctx.Response.Header.Peek(HEADER_REQUEST_ID); len(id) != 32 {
+		t.Fatal(string(id))
+	}
+}
@@ -0,0 +1,262 @@
+package http
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lxf9601/go-common/logc"
+)
+
+// 负载均衡策略
+const (
+	BALANCE_ROUND_ROBIN       = iota // 轮询
+	BALANCE_LEAST_OUTSTANDING        // 最少未完成请求
+	BALANCE_CONSISTENT_HASH          // 一致性哈希, 按ApiRequest.HashKey选择实例
+)
+
+const (
+	defaultEjectionFailures   = 5
+	defaultEjectionTime       = 30 * time.Second
+	defaultMaxEjectionTime    = 5 * time.Minute
+	defaultMaxEjectionPercent = 50
+	hashRingReplicas          = 100
+)
+
+// 被动健康检查配置, 连续失败的实例暂时移出负载均衡
+type EjectionOptions struct {
+	ConsecutiveFailures int           // 连续失败次数达到后移出, 默认5
+	BaseEjectionTime    time.Duration // 移出时长, 每次移出递增, 默认30秒
+	MaxEjectionTime     time.Duration // 最长移出时长, 默认5分钟
+	MaxEjectionPercent  int           // 最多移出实例的百分比, 默认50
+}
+
+// 服务实例
+type endpoint struct {
+	url          string
+	host         string
+	outstanding  int32
+	failures     int
+	ejections    int
+	ejectedUntil time.Time
+}
+
+type hashNode struct {
+	hash     uint32
+	endpoint *endpoint
+}
+
+// 负载均衡器, 从服务发现获取实例并选择
+type balancer struct {
+	discovery Discovery
+	policy    int
+	ejection  EjectionOptions
+	available func(host string) bool
+	removed   func(hosts []string) // 服务发现不再返回的主机, 用于清理按主机保存的状态
+	lock      sync.Mutex
+	urls      []string
+	endpoints []*endpoint
+	ring      []hashNode
+	next      uint32
+}
+
+func newBalancer(discovery Discovery, policy int, ejection *EjectionOptions, available func(host string) bool) *balancer {
+	opts := EjectionOptions{}
+	if ejection != nil {
+		opts = *ejection
+	}
+	if opts.ConsecutiveFailures <= 0 {
+		opts.ConsecutiveFailures = defaultEjectionFailures
+	}
+	if opts.BaseEjectionTime <= 0 {
+		opts.BaseEjectionTime = defaultEjectionTime
+	}
+	if opts.MaxEjectionTime <= 0 {
+		opts.MaxEjectionTime = defaultMaxEjectionTime
+	}
+	if opts.MaxEjectionPercent <= 0 {
+		opts.MaxEjectionPercent = defaultMaxEjectionPercent
+	}
+	return &balancer{discovery: discovery, policy: policy, ejection: opts, available: available}
+}
+
+// refresh 服务发现结果变化时重建实例列表, 保留已有实例的状态, 需持有锁
+func (this *balancer) refresh(urls []string) {
+	if len(urls) == len(this.urls) {
+		same := true
+		for i := range urls {
+			if urls[i] != this.urls[i] {
+				same = false
+				break
+			}
+		}
+		if same {
+			return
+		}
+	}
+	old := make(map[string]*endpoint, len(this.endpoints))
+	for _, e := range this.endpoints {
+		old[e.url] = e
+	}
+	endpoints := make([]*endpoint, 0, len(urls))
+	for _, u := range urls {
+		e, ok := old[u]
+		if !ok {
+			e = &endpoint{url: u, host: requestHost(u)}
+		}
+		endpoints = append(endpoints, e)
+	}
+	if this.removed != nil {
+		hosts := make(map[string]bool, len(endpoints))
+		for _, e := range endpoints {
+			hosts[e.host] = true
+		}
+		removed := make([]string, 0)
+		for _, e := range this.endpoints {
+			if !hosts[e.host] {
+				hosts[e.host] = true
+				removed = append(removed, e.host)
+			}
+		}
+		if len(removed) > 0 {
+			this.removed(removed)
+		}
+	}
+	this.urls = append([]string(nil), urls...)
+	this.endpoints = endpoints
+	this.ring = nil
+	if this.policy == BALANCE_CONSISTENT_HASH {
+		ring := make([]hashNode, 0, len(endpoints)*hashRingReplicas)
+		for _, e := range endpoints {
+			for i := 0; i < hashRingReplicas; i++ {
+				ring = append(ring, hashNode{hash: crc32.ChecksumIEEE([]byte(e.url + "#" + strconv.Itoa(i))), endpoint: e})
+			}
+		}
+		sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+		this.ring = ring
+	}
+}
+
+// healthy 实例未被移出且熔断器未打开, 需持有锁
+func (this *balancer) healthy(e *endpoint, now time.Time) bool {
+	if now.Before(e.ejectedUntil) {
+		return false
+	}
+	return this.available == nil || this.available(e.host)
+}
+
+// pick 选择实例, 所有实例都不健康时仍按策略选择以免完全不可用
+func (this *balancer) pick(key string) (*endpoint, error) {
+	urls, err := this.discovery.Endpoints()
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if err != nil {
+		if len(this.endpoints) == 0 {
+			return nil, err
+		}
+		logc.Warnf("service discovery: %s, using last endpoints", err)
+	} else {
+		this.refresh(urls)
+	}
+	if len(this.endpoints) == 0 {
+		return nil, ErrNoEndpoint
+	}
+	now := time.Now()
+	for _, strict := range []bool{true, false} {
+		var e *endpoint
+		switch this.policy {
+		case BALANCE_CONSISTENT_HASH:
+			e = this.pickHash(key, now, strict)
+		case BALANCE_LEAST_OUTSTANDING:
+			e = this.pickLeast(now, strict)
+		default:
+			e = this.pickRoundRobin(now, strict)
+		}
+		if e != nil {
+			atomic.AddInt32(&e.outstanding, 1)
+			return e, nil
+		}
+	}
+	return nil, ErrNoEndpoint
+}
+
+func (this *balancer) pickRoundRobin(now time.Time, strict bool) *endpoint {
+	n := len(this.endpoints)
+	start := int(this.next % uint32(n))
+	this.next++
+	for i := 0; i < n; i++ {
+		e := this.endpoints[(start+i)%n]
+		if !strict || this.healthy(e, now) {
+			return e
+		}
+	}
+	return nil
+}
+
+func (this *balancer) pickLeast(now time.Time, strict bool) *endpoint {
+	n := len(this.endpoints)
+	start := int(this.next % uint32(n))
+	this.next++
+	var best *endpoint
+	for i := 0; i < n; i++ {
+		e := this.endpoints[(start+i)%n]
+		if strict && !this.healthy(e, now) {
+			continue
+		}
+		if best == nil || atomic.LoadInt32(&e.outstanding) < atomic.LoadInt32(&best.outstanding) {
+			best = e
+		}
+	}
+	return best
+}
+
+func (this *balancer) pickHash(key string, now time.Time, strict bool) *endpoint {
+	hash := crc32.ChecksumIEEE([]byte(key))
+	n := len(this.ring)
+	i := sort.Search(n, func(i int) bool { return this.ring[i].hash >= hash })
+	for j := 0; j < n; j++ {
+		e := this.ring[(i+j)%n].endpoint
+		if !strict || this.healthy(e, now) {
+			return e
+		}
+	}
+	return nil
+}
+
+// done 报告请求结果, 连续失败达到阈值时移出实例
+func (this *balancer) done(e *endpoint, failure bool) {
+	atomic.AddInt32(&e.outstanding, -1)
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if !failure {
+		e.failures = 0
+		return
+	}
+	now := time.Now()
+	if now.Before(e.ejectedUntil) {
+		return
+	}
+	if e.failures++; e.failures < this.ejection.ConsecutiveFailures {
+		return
+	}
+	ejected := 0
+	for _, other := range this.endpoints {
+		if now.Before(other.ejectedUntil) {
+			ejected++
+		}
+	}
+	if (ejected+1)*100 > len(this.endpoints)*this.ejection.MaxEjectionPercent {
+		return
+	}
+	e.failures = 0
+	e.ejections++
+	duration := this.ejection.BaseEjectionTime * time.Duration(e.ejections)
+	if duration > this.ejection.MaxEjectionTime || duration <= 0 {
+		duration = this.ejection.MaxEjectionTime
+	}
+	e.ejectedUntil = now.Add(duration)
+	logc.Warnf("endpoint %s ejected for %s", e.url, duration)
+}
@@ -0,0 +1,118 @@
+package http
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestBalancerRoundRobin(t *testing.T) {
+	b := newBalancer(StaticDiscovery{"http://a", "http://b", "http://c"}, BALANCE_ROUND_ROBIN, nil, nil)
+	counts := map[string]int{}
+	for i := 0; i < 30; i++ {
+		e, err := b.pick("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[e.url]++
+		b.done(e, false)
+	}
+	if counts["http://a"] != 10 || counts["http://b"] != 10 || counts["http://c"] != 10 {
+		t.Fatal(counts)
+	}
+}
+
+func TestBalancerLeastOutstanding(t *testing.T) {
+	b := newBalancer(StaticDiscovery{"http://a", "http://b"}, BALANCE_LEAST_OUTSTANDING, nil, nil)
+	first, _ := b.pick("")
+	for i := 0; i < 5; i++ {
+		e, _ := b.pick("")
+		if e == first {
+			t.Fatal("busy endpoint picked", e.url)
+		}
+		b.done(e, false)
+	}
+}
+
+func TestBalancerConsistentHash(t *testing.T) {
+	b := newBalancer(StaticDiscovery{"http://a", "http://b", "http://c"}, BALANCE_CONSISTENT_HASH, nil, nil)
+	keys := map[string]string{}
+	for _, key := range []string{"u1", "u2", "u3", "u4", "u5", "u6"} {
+		e, _ := b.pick(key)
+		b.done(e, false)
+		keys[key] = e.url
+	}
+	for key, u := range keys {
+		if e, _ := b.pick(key); e.url != u {
+			t.Fatal(key, e.url, u)
+		}
+	}
+
+	// 移除一个实例只影响落在该实例上的键
+	b.discovery = StaticDiscovery{"http://a", "http://b"}
+	for key, u := range keys {
+		e, _ := b.pick(key)
+		if u != "http://c" && e.url != u {
+			t.Fatal(key, e.url, u)
+		}
+	}
+}
+
+func TestBalancerEjection(t *testing.T) {
+	b := newBalancer(StaticDiscovery{"http://a", "http://b"}, BALANCE_ROUND_ROBIN,
+		&EjectionOptions{ConsecutiveFailures: 2, BaseEjectionTime: time.Minute}, nil)
+	for i := 0; i < 4; i++ {
+		e, _ := b.pick("")
+		b.done(e, e.url == "http://a")
+	}
+	for i := 0; i < 4; i++ {
+		if e, _ := b.pick(""); e.url != "http://b" {
+			t.Fatal("ejected endpoint picked")
+		}
+	}
+	// 超过MaxEjectionPercent时不再移出, 避免所有实例不可用
+	for i := 0; i < 4; i++ {
+		e, _ := b.pick("")
+		b.done(e, true)
+	}
+	if e, _ := b.pick(""); e.url != "http://b" {
+		t.Fatal(e.url)
+	}
+}
+
+func TestMicroSrvApiEndpoints(t *testing.T) {
+	dials := map[string]fasthttp.DialFunc{}
+	var calls [2]int32
+	for i, host := range []string{"10.0.0.1:80", "10.0.0.2:80"} {
+		i := i
+		dial, closeFn := newTestServer(func(ctx *fasthttp.RequestCtx) {
+			atomic.AddInt32(&calls[i], 1)
+			if i == 0 {
+				ctx.SetStatusCode(500)
+				return
+			}
+			ctx.SetBodyString(`{"ret":0,"msg":"","data":"` + string(ctx.Path()) + `"}`)
+		})
+		defer closeFn()
+		dials[host] = dial
+	}
+	api := NewMicroSrvApi(&MicroSrvApiOptions{Endpoints: []string{"http://10.0.0.1/api", "http://10.0.0.2/api"},
+		Retry:    &RetryOptions{MaxAttempts: 2, BaseDelay: time.Millisecond, RetryStatus: []int{500}},
+		Ejection: &EjectionOptions{ConsecutiveFailures: 1, BaseEjectionTime: time.Minute}})
+	api.client.Dial = func(addr string) (net.Conn, error) {
+		return dials[addr](addr)
+	}
+	for i := 0; i < 5; i++ {
+		var data string
+		if _, err := api.NewRequest("GET", "/user").Do(context.Background(), &data); err != nil || data != "/api/user" {
+			t.Fatal(err, data)
+		}
+	}
+	if calls[0] != 1 || calls[1] != 5 {
+		t.Fatal(calls)
+	}
+}
@@ -0,0 +1,201 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/lxf9601/go-common/logc"
+)
+
+// 熔断器状态
+type BreakerState int
+
+const (
+	BREAKER_CLOSED BreakerState = iota
+	BREAKER_OPEN
+	BREAKER_HALF_OPEN
+)
+
+func (this BreakerState) String() string {
+	switch this {
+	case BREAKER_CLOSED:
+		return "closed"
+	case BREAKER_OPEN:
+		return "open"
+	case BREAKER_HALF_OPEN:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+const (
+	defaultBreakerFailureThreshold = 5
+	defaultBreakerOpenTimeout      = 30 * time.Second
+)
+
+var (
+	ErrCircuitOpen  = errors.New("circuit breaker is open")
+	ErrBulkheadFull = errors.New("bulkhead is full")
+)
+
+// 熔断配置
+type BreakerOptions struct {
+	FailureThreshold int                                                   // 连续失败次数达到后打开, 默认5
+	SuccessThreshold int                                                   // 半开状态连续成功次数达到后关闭, 默认1
+	OpenTimeout      time.Duration                                         // 打开后经过该时间进入半开, 默认30秒
+	HalfOpenRequests int                                                   // 半开状态允许同时进行的探测请求数, 默认1
+	OnStateChange    func(name string, from BreakerState, to BreakerState) // 状态变化回调, 状态变化总会记录到日志
+}
+
+// 熔断器, 连续失败后拒绝请求, 超时后放行少量请求探测是否恢复
+type CircuitBreaker struct {
+	name             string
+	options          BreakerOptions
+	lock             sync.Mutex
+	state            BreakerState
+	failures         int
+	successes        int
+	halfOpenInFlight int
+	openedAt         time.Time
+	now              func() time.Time
+}
+
+// NewCircuitBreaker 创建熔断器, name用于日志及回调
+func NewCircuitBreaker(name string, options *BreakerOptions) *CircuitBreaker {
+	opts := *options
+	if opts.FailureThreshold <= 0 {
+		opts.FailureThreshold = defaultBreakerFailureThreshold
+	}
+	if opts.SuccessThreshold <= 0 {
+		opts.SuccessThreshold = 1
+	}
+	if opts.OpenTimeout <= 0 {
+		opts.OpenTimeout = defaultBreakerOpenTimeout
+	}
+	if opts.HalfOpenRequests <= 0 {
+		opts.HalfOpenRequests = 1
+	}
+	return &CircuitBreaker{name: name, options: opts, now: time.Now}
+}
+
+// State 当前状态
+func (this *CircuitBreaker) State() BreakerState {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.state == BREAKER_OPEN && this.now().Sub(this.openedAt) >= this.options.OpenTimeout {
+		return BREAKER_HALF_OPEN
+	}
+	return this.state
+}
+
+// Allow 判断是否放行请求, 放行后须调用Done报告结果
+func (this *CircuitBreaker) Allow() error {
+	this.lock.Lock()
+	from := this.state
+	if this.state == BREAKER_OPEN && this.now().Sub(this.openedAt) >= this.options.OpenTimeout {
+		this.setState(BREAKER_HALF_OPEN)
+	}
+	var err error
+	switch this.state {
+	case BREAKER_OPEN:
+		err = ErrCircuitOpen
+	case BREAKER_HALF_OPEN:
+		if this.halfOpenInFlight >= this.options.HalfOpenRequests {
+			err = ErrCircuitOpen
+		} else {
+			this.halfOpenInFlight++
+		}
+	}
+	to := this.state
+	this.lock.Unlock()
+	this.notify(from, to)
+	return err
+}
+
+// Done 报告请求结果
+func (this *CircuitBreaker) Done(success bool) {
+	this.lock.Lock()
+	from := this.state
+	switch this.state {
+	case BREAKER_CLOSED:
+		if success {
+			this.failures = 0
+		} else if this.failures++; this.failures >= this.options.FailureThreshold {
+			this.setState(BREAKER_OPEN)
+		}
+	case BREAKER_HALF_OPEN:
+		if this.halfOpenInFlight > 0 {
+			this.halfOpenInFlight--
+		}
+		if !success {
+			this.setState(BREAKER_OPEN)
+		} else if this.successes++; this.successes >= this.options.SuccessThreshold {
+			this.setState(BREAKER_CLOSED)
+		}
+	}
+	to := this.state
+	this.lock.Unlock()
+	this.notify(from, to)
+}
+
+// setState 需持有锁
+func (this *CircuitBreaker) setState(state BreakerState) {
+	this.state = state
+	this.failures = 0
+	this.successes = 0
+	this.halfOpenInFlight = 0
+	if state == BREAKER_OPEN {
+		this.openedAt = this.now()
+	}
+}
+
+func (this *CircuitBreaker) notify(from BreakerState, to BreakerState) {
+	if from == to {
+		return
+	}
+	logc.Warnf("circuit breaker %s: %s -> %s", this.name, from, to)
+	if this.options.OnStateChange != nil {
+		this.options.OnStateChange(this.name, from, to)
+	}
+}
+
+// 舱壁, 限制同时进行的请求数
+type bulkhead struct {
+	slots chan struct{}
+	wait  time.Duration
+}
+
+func newBulkhead(maxConcurrent int, wait time.Duration) *bulkhead {
+	if maxConcurrent <= 0 {
+		return nil
+	}
+	return &bulkhead{slots: make(chan struct{}, maxConcurrent), wait: wait}
+}
+
+// acquire 获取执行名额, 最多等待wait, 返回释放函数
+func (this *bulkhead) acquire(ctx context.Context) (func(), error) {
+	if this == nil {
+		return func() {}, nil
+	}
+	release := func() { <-this.slots }
+	select {
+	case this.slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+	if this.wait <= 0 {
+		return nil, ErrBulkheadFull
+	}
+	timer := time.NewTimer(this.wait)
+	defer timer.Stop()
+	select {
+	case this.slots <- struct{}{}:
+		return release, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timer.C:
+		return nil, ErrBulkheadFull
+	}
+}
@@ -0,0 +1,179 @@
+package http
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var changes []string
+	breaker := NewCircuitBreaker("svc", &BreakerOptions{FailureThreshold: 2, OpenTimeout: time.Minute,
+		OnStateChange: func(name string, from BreakerState, to BreakerState) {
+			changes = append(changes, name+":"+from.String()+"->"+to.String())
+		}})
+	now := time.Now()
+	breaker.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if err := breaker.Allow(); err != nil {
+			t.Fatal(err)
+		}
+		breaker.Done(false)
+	}
+	if breaker.State() != BREAKER_OPEN || breaker.Allow() != ErrCircuitOpen {
+		t.Fatal(breaker.State())
+	}
+
+	now = now.Add(time.Minute)
+	if err := breaker.Allow(); err != nil {
+		t.Fatal(err)
+	}
+	if breaker.Allow() != ErrCircuitOpen {
+		t.Fatal("half-open must admit a single probe")
+	}
+	breaker.Done(false)
+	if breaker.State() != BREAKER_OPEN {
+		t.Fatal(breaker.State())
+	}
+
+	now = now.Add(time.Minute)
+	if err := breaker.Allow(); err != nil {
+		t.Fatal(err)
+	}
+	breaker.Done(true)
+	if breaker.State() != BREAKER_CLOSED {
+		t.Fatal(breaker.State())
+	}
+	expected := []string{"svc:closed->open", "svc:open->half-open", "svc:half-open->open",
+		"svc:open->half-open", "svc:half-open->closed"}
+	if len(changes) != len(expected) {
+		t.Fatal(changes)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Fatal(changes)
+		}
+	}
+}
+
+func TestMicroSrvApiRetry(t *testing.T) {
+	var calls int32
+	api, closeFn := newMicroSrvTestApi(t, func(ctx *fasthttp.RequestCtx) {
+		n := atomic.AddInt32(&calls, 1)
+		if string(ctx.Path()) == "/api/flaky" && n%3 != 0 {
+			ctx.SetStatusCode(503)
+			return
+		}
+		if string(ctx.Path()) == "/api/down" {
+			ctx.SetStatusCode(500)
+			return
+		}
+		if string(ctx.Path()) == "/api/busy" {
+			ctx.Response.Header.Set("Retry-After", "1")
+			ctx.SetStatusCode(503)
+			return
+		}
+		ctx.SetBodyString(`{"ret":0,"msg":"","data":"ok"}`)
+	})
+	defer closeFn()
+	api.retry = normalizeRetryOptions(&RetryOptions{MaxAttempts: 3, BaseDelay: time.Millisecond})
+
+	var data string
+	if _, err := api.NewRequest("GET", "/flaky").Do(context.Background(), &data); err != nil || data != "ok" || calls != 3 {
+		t.Fatal(err, data, calls)
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	_, err := api.NewRequest("POST", "/flaky").Do(context.Background(), nil)
+	if e, ok := err.(*StatusError); !ok || e.StatusCode != 503 || calls != 1 {
+		t.Fatal("non-idempotent requests must not be retried", err, calls)
+	}
+
+	atomic.StoreInt32(&calls, 1)
+	req := api.NewRequest("POST", "/flaky").Idempotent("k1")
+	if _, err := req.Do(context.Background(), nil); err != nil || calls != 3 || req.header[HEADER_IDEMPOTENCY_KEY] != "k1" {
+		t.Fatal(err, calls)
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	if _, err := api.NewRequest("GET", "/down").Do(context.Background(), nil); err == nil || calls != 1 {
+		t.Fatal("500 is not in the retry status list", err, calls)
+	}
+
+	// 退避等待期间取消时返回ctx的错误而非上一次的失败
+	atomic.StoreInt32(&calls, 0)
+	api.retry = normalizeRetryOptions(&RetryOptions{MaxAttempts: 3, MaxDelay: time.Second})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := api.NewRequest("GET", "/busy").Do(ctx, nil); err != context.DeadlineExceeded || calls != 1 {
+		t.Fatal(err, calls)
+	}
+}
+
+func TestMicroSrvApiBreaker(t *testing.T) {
+	var calls int32
+	api, closeFn := newMicroSrvTestApi(t, func(ctx *fasthttp.RequestCtx) {
+		atomic.AddInt32(&calls, 1)
+		ctx.SetStatusCode(502)
+	})
+	defer closeFn()
+	api.retry = normalizeRetryOptions(&RetryOptions{MaxAttempts: 5, BaseDelay: time.Millisecond})
+	api.breaker = &BreakerOptions{FailureThreshold: 2, OpenTimeout: time.Minute}
+
+	if _, err := api.NewRequest("GET", "/user").Do(context.Background(), nil); err != ErrCircuitOpen || calls != 2 {
+		t.Fatal(err, calls)
+	}
+	if api.Breaker("user-service").State() != BREAKER_OPEN {
+		t.Fatal(api.Breaker("user-service").State())
+	}
+	if _, err := api.NewRequest("GET", "/user").Do(context.Background(), nil); err != ErrCircuitOpen || calls != 2 {
+		t.Fatal(err, calls)
+	}
+}
+
+func TestMicroSrvApiBulkhead(t *testing.T) {
+	release := make(chan struct{})
+	api, closeFn := newMicroSrvTestApi(t, func(ctx *fasthttp.RequestCtx) {
+		<-release
+		ctx.SetBodyString(`{"ret":0,"msg":"","data":null}`)
+	})
+	defer closeFn()
+	api.maxConcurrent = 1
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if _, err := api.NewRequest("GET", "/user").Do(context.Background(), nil); err != nil {
+			t.Error(err)
+		}
+	}()
+	for api.guard("user-service").bulkhead == nil || len(api.guard("user-service").bulkhead.slots) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := api.NewRequest("GET", "/user").Do(context.Background(), nil); err != ErrBulkheadFull {
+		t.Fatal(err)
+	}
+	close(release)
+	wg.Wait()
+}
+
+func TestRetryBackoff(t *testing.T) {
+	retry := normalizeRetryOptions(&RetryOptions{MaxAttempts: 10, BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond})
+	for attempt := 1; attempt < 40; attempt++ {
+		if d := retry.backoff(attempt, nil); d < 0 || d > 50*time.Millisecond {
+			t.Fatal(attempt, d)
+		}
+	}
+	if d := retry.backoff(1, &StatusError{RetryAfter: time.Second}); d != 50*time.Millisecond {
+		t.Fatal(d)
+	}
+	if parseRetryAfter([]byte("2")) != 2*time.Second || parseRetryAfter([]byte("x")) != 0 {
+		t.Fatal("retry-after")
+	}
+}
@@ -0,0 +1,461 @@
+package http
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/lxf9601/go-common/db"
+	"github.com/lxf9601/go-common/logc"
+)
+
+var errCacheNamespace = errors.New("micro service cache: Namespace is required with Discovery")
+
+const (
+	defaultMemoryCacheEntries = 1000
+	defaultCacheMaxStale      = time.Hour
+	defaultRedisCachePrefix   = "http:cache:"
+)
+
+// 缓存的响应
+type CachedResponse struct {
+	Body                 []byte        `json:"body"`
+	ETag                 string        `json:"etag,omitempty"`
+	LastModified         string        `json:"last_modified,omitempty"`
+	Stored               time.Time     `json:"stored"`
+	MaxAge               time.Duration `json:"max_age"`                // 新鲜期
+	StaleWhileRevalidate time.Duration `json:"stale_while_revalidate"` // 过期后仍可返回并在后台再验证的时间
+}
+
+// 响应缓存存储, 存取失败时应记录日志并视为未命中
+// 多实例共享的存储可实现Shared() bool返回true, 此时不缓存Cache-Control: private的响应
+type CacheStore interface {
+	Get(key string) *CachedResponse
+	Set(key string, response *CachedResponse, ttl time.Duration)
+	Delete(key string)
+}
+
+type sharedCacheStore interface {
+	Shared() bool
+}
+
+// 进程内LRU缓存
+type MemoryCache struct {
+	maxEntries int
+	lock       sync.Mutex
+	ll         *list.List
+	items      map[string]*list.Element
+}
+
+type memoryCacheItem struct {
+	key      string
+	response *CachedResponse
+	expires  time.Time
+}
+
+// NewMemoryCache 创建LRU缓存, maxEntries为最大条目数, 默认1000
+func NewMemoryCache(maxEntries int) *MemoryCache {
+	if maxEntries <= 0 {
+		maxEntries = defaultMemoryCacheEntries
+	}
+	return &MemoryCache{maxEntries: maxEntries, ll: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (this *MemoryCache) Get(key string) *CachedResponse {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	e, ok := this.items[key]
+	if !ok {
+		return nil
+	}
+	item := e.Value.(*memoryCacheItem)
+	if time.Now().After(item.expires) {
+		this.ll.Remove(e)
+		delete(this.items, key)
+		return nil
+	}
+	this.ll.MoveToFront(e)
+	return item.response
+}
+
+func (this *MemoryCache) Set(key string, response *CachedResponse, ttl time.Duration) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	item := &memoryCacheItem{key: key, response: response, expires: time.Now().Add(ttl)}
+	if e, ok := this.items[key]; ok {
+		e.Value = item
+		this.ll.MoveToFront(e)
+		return
+	}
+	this.items[key] = this.ll.PushFront(item)
+	for this.ll.Len() > this.maxEntries {
+		oldest := this.ll.Back()
+		this.ll.Remove(oldest)
+		delete(this.items, oldest.Value.(*memoryCacheItem).key)
+	}
+}
+
+func (this *MemoryCache) Delete(key string) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if e, ok := this.items[key]; ok {
+		this.ll.Remove(e)
+		delete(this.items, key)
+	}
+}
+
+// Len 缓存条目数
+func (this *MemoryCache) Len() int {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return this.ll.Len()
+}
+
+// Redis缓存配置
+type RedisCacheOptions struct {
+	Redis  *db.Redis // Redis服务
+	Prefix string    // 键前缀, 默认http:cache:
+}
+
+// Redis缓存, 多实例共享
+type RedisCache struct {
+	redis  *db.Redis
+	prefix string
+}
+
+func NewRedisCache(options *RedisCacheOptions) *RedisCache {
+	prefix := options.Prefix
+	if prefix == "" {
+		prefix = defaultRedisCachePrefix
+	}
+	return &RedisCache{redis: options.Redis, prefix: prefix}
+}
+
+func (this *RedisCache) Get(key string) *CachedResponse {
+	b, err := this.redis.Get(this.prefix + key).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			logc.Warnf("http cache get %s: %s", key, err)
+		}
+		return nil
+	}
+	response := new(CachedResponse)
+	if err := json.Unmarshal(b, response); err != nil {
+		logc.Warnf("http cache decode %s: %s", key, err)
+		return nil
+	}
+	return response
+}
+
+func (this *RedisCache) Set(key string, response *CachedResponse, ttl time.Duration) {
+	j, err := json.Marshal(response)
+	if err == nil {
+		err = this.redis.Set(this.prefix+key, j, ttl)
+	}
+	if err != nil {
+		logc.Warnf("http cache set %s: %s", key, err)
+	}
+}
+
+func (this *RedisCache) Delete(key string) {
+	if err := this.redis.Del(this.prefix + key).Err(); err != nil {
+		logc.Warnf("http cache delete %s: %s", key, err)
+	}
+}
+
+// Shared 多实例共享, 不缓存private响应
+func (this *RedisCache) Shared() bool {
+	return true
+}
+
+// 响应缓存配置
+type CacheOptions struct {
+	Store         CacheStore    // 缓存存储, 默认NewMemoryCache(1000)
+	Namespace     string        // 缓存键前缀, 默认为服务接口地址或Endpoints, 使用Discovery时必须设置
+	DefaultMaxAge time.Duration // 响应没有Cache-Control max-age时的新鲜期, 默认0, 无ETag或Last-Modified时不缓存
+	MaxStale      time.Duration // 有ETag或Last-Modified的响应过期后保留用于再验证的时间, 默认1小时
+}
+
+// Cache-Control指令
+type cacheDirectives struct {
+	maxAge               time.Duration
+	hasMaxAge            bool
+	noStore              bool
+	noCache              bool
+	private              bool
+	mustRevalidate       bool
+	staleWhileRevalidate time.Duration
+}
+
+// parseCacheControl 解析Cache-Control响应头, s-maxage忽略
+func parseCacheControl(value string) cacheDirectives {
+	d := cacheDirectives{}
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		name, arg := part, ""
+		if i := strings.IndexByte(part, '='); i >= 0 {
+			name, arg = part[:i], strings.Trim(part[i+1:], `"`)
+		}
+		seconds, err := strconv.Atoi(arg)
+		switch strings.ToLower(name) {
+		case "max-age":
+			if err == nil && seconds >= 0 {
+				d.maxAge = time.Duration(seconds) * time.Second
+				d.hasMaxAge = true
+			}
+		case "no-store":
+			d.noStore = true
+		case "no-cache":
+			d.noCache = true
+		case "private":
+			d.private = true
+		case "must-revalidate":
+			d.mustRevalidate = true
+		case "stale-while-revalidate":
+			if err == nil && seconds > 0 {
+				d.staleWhileRevalidate = time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	return d
+}
+
+// GET响应缓存, 相同请求并发时只向上游发送一次
+type responseCache struct {
+	store         CacheStore
+	namespace     string
+	defaultMaxAge time.Duration
+	maxStale      time.Duration
+	shared        bool // 存储多实例共享
+	flight        flightGroup
+}
+
+func newResponseCache(options *CacheOptions, namespace string) *responseCache {
+	cache := &responseCache{store: options.Store, namespace: options.Namespace,
+		defaultMaxAge: options.DefaultMaxAge, maxStale: options.MaxStale}
+	if cache.store == nil {
+		cache.store = NewMemoryCache(defaultMemoryCacheEntries)
+	}
+	if cache.namespace == "" {
+		cache.namespace = namespace
+	}
+	if cache.maxStale <= 0 {
+		cache.maxStale = defaultCacheMaxStale
+	}
+	if store, ok := cache.store.(sharedCacheStore); ok {
+		cache.shared = store.Shared()
+	}
+	return cache
+}
+
+// key 缓存键, 请求级请求头不同的响应分别缓存, 请求头摘要后加入键以免鉴权信息写入存储
+func (this *responseCache) key(req *ApiRequest) string {
+	key := this.namespace + " " + joinUrl("", req.uri, req.query)
+	if len(req.header) == 0 {
+		return key
+	}
+	names := make([]string, 0, len(req.header))
+	for name := range req.header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	h := sha1.New()
+	for _, name := range names {
+		h.Write([]byte(strings.ToLower(name) + ": " + req.header[name] + "\n"))
+	}
+	return key + " " + hex.EncodeToString(h.Sum(nil))
+}
+
+// do 返回新鲜的缓存, 在stale-while-revalidate期内返回过期缓存并后台再验证, 否则请求上游
+func (this *responseCache) do(ctx context.Context, req *ApiRequest) ([]byte, string, error) {
+	key := this.key(req)
+	var entry *CachedResponse
+	if !req.noCache {
+		entry = this.store.Get(key)
+	}
+	if entry != nil {
+		age := time.Since(entry.Stored)
+		if age < entry.MaxAge {
+			return entry.Body, key, nil
+		}
+		if age < entry.MaxAge+entry.StaleWhileRevalidate {
+			this.flight.doAsync(key, this.sharedFetch(ctx, req, key, entry))
+			return entry.Body, key, nil
+		}
+	}
+	return this.flight.do(ctx, key, this.sharedFetch(ctx, req, key, entry))
+}
+
+// sharedFetch 返回合并调用共享的上游请求, 不受发起方ctx取消和请求级超时影响, 使用服务默认超时
+func (this *responseCache) sharedFetch(ctx context.Context, req *ApiRequest, key string, entry *CachedResponse) func() ([]byte, string, error) {
+	r := *req
+	r.timeout = 0
+	parent := detachedContext{ctx}
+	return func() ([]byte, string, error) {
+		ctx, cancel := context.WithTimeout(parent, r.api.Timeout)
+		defer cancel()
+		return this.fetch(ctx, &r, key, entry)
+	}
+}
+
+// fetch 请求上游并更新缓存, 有缓存时发送条件请求
+func (this *responseCache) fetch(ctx context.Context, req *ApiRequest, key string, entry *CachedResponse) ([]byte, string, error) {
+	r := *req
+	if entry != nil && (entry.ETag != "" || entry.LastModified != "") {
+		r.revalidate = entry
+	}
+	resp, reqUri, err := r.execute(ctx)
+	if err != nil {
+		return nil, reqUri, err
+	}
+	if resp.notModified {
+		updated := *entry
+		if resp.etag != "" {
+			updated.ETag = resp.etag
+		}
+		if resp.lastModified != "" {
+			updated.LastModified = resp.lastModified
+		}
+		if resp.cacheControl != "" {
+			this.save(key, &updated, resp)
+		} else {
+			updated.Stored = time.Now()
+			this.store.Set(key, &updated, this.ttl(&updated))
+		}
+		return updated.Body, reqUri, nil
+	}
+	this.save(key, &CachedResponse{Body: resp.body, ETag: resp.etag, LastModified: resp.lastModified}, resp)
+	return resp.body, reqUri, nil
+}
+
+// save 按响应头计算新鲜期后保存, no-store以及共享存储遇到private时删除已有缓存
+func (this *responseCache) save(key string, entry *CachedResponse, resp *upstreamResponse) {
+	d := parseCacheControl(resp.cacheControl)
+	if d.noStore || d.private && this.shared {
+		this.store.Delete(key)
+		return
+	}
+	entry.Stored = time.Now()
+	entry.MaxAge = this.defaultMaxAge
+	if d.hasMaxAge {
+		entry.MaxAge = d.maxAge
+		if age, err := strconv.Atoi(resp.age); err == nil && age > 0 {
+			entry.MaxAge -= time.Duration(age) * time.Second
+		}
+	}
+	if d.noCache || entry.MaxAge < 0 {
+		entry.MaxAge = 0
+	}
+	entry.StaleWhileRevalidate = 0
+	if !d.mustRevalidate && !d.noCache {
+		entry.StaleWhileRevalidate = d.staleWhileRevalidate
+	}
+	if entry.MaxAge == 0 && entry.StaleWhileRevalidate == 0 && entry.ETag == "" && entry.LastModified == "" {
+		return
+	}
+	this.store.Set(key, entry, this.ttl(entry))
+}
+
+// ttl 存储时间, 有校验器的响应额外保留MaxStale用于再验证
+func (this *responseCache) ttl(entry *CachedResponse) time.Duration {
+	ttl := entry.MaxAge + entry.StaleWhileRevalidate
+	if (entry.ETag != "" || entry.LastModified != "") && ttl < this.maxStale {
+		ttl = this.maxStale
+	}
+	return ttl
+}
+
+// 合并相同键的并发调用
+type flightGroup struct {
+	lock  sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	done   chan struct{}
+	body   []byte
+	reqUri string
+	err    error
+}
+
+// do 后台执行fn并等待结果, 相同键已在执行时等待其结果, ctx取消时不再等待但不中止fn
+func (this *flightGroup) do(ctx context.Context, key string, fn func() ([]byte, string, error)) ([]byte, string, error) {
+	this.lock.Lock()
+	if this.calls == nil {
+		this.calls = make(map[string]*flightCall)
+	}
+	call, ok := this.calls[key]
+	if !ok {
+		call = &flightCall{done: make(chan struct{})}
+		this.calls[key] = call
+		go this.run(key, call, fn)
+	}
+	this.lock.Unlock()
+	select {
+	case <-call.done:
+		return call.body, call.reqUri, call.err
+	case <-ctx.Done():
+		return nil, "", ctx.Err()
+	}
+}
+
+// doAsync 后台执行fn, 相同键已在执行时忽略
+func (this *flightGroup) doAsync(key string, fn func() ([]byte, string, error)) {
+	this.lock.Lock()
+	if this.calls == nil {
+		this.calls = make(map[string]*flightCall)
+	}
+	if _, ok := this.calls[key]; ok {
+		this.lock.Unlock()
+		return
+	}
+	call := &flightCall{done: make(chan struct{})}
+	this.calls[key] = call
+	this.lock.Unlock()
+	go func() {
+		this.run(key, call, fn)
+		if call.err != nil {
+			logc.Warnf("http cache revalidate %s: %s", key, call.err)
+		}
+	}()
+}
+
+func (this *flightGroup) run(key string, call *flightCall, fn func() ([]byte, string, error)) {
+	defer func() {
+		this.lock.Lock()
+		delete(this.calls, key)
+		this.lock.Unlock()
+		close(call.done)
+	}()
+	call.body, call.reqUri, call.err = fn()
+}
+
+// detachedContext 保留父ctx的值, 不继承其截止时间和取消
+type detachedContext struct {
+	parent context.Context
+}
+
+func (this detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (this detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (this detachedContext) Err() error {
+	return nil
+}
+
+func (this detachedContext) Value(key interface{}) interface{} {
+	return this.parent.Value(key)
+}
@@ -0,0 +1,311 @@
+package http
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+	"github.com/lxf9601/go-common/db"
+	"github.com/valyala/fasthttp"
+)
+
+func TestMicroSrvApiCache(t *testing.T) {
+	var calls, notModified int32
+	api, closeFn := newMicroSrvTestApi(t, func(ctx *fasthttp.RequestCtx) {
+		atomic.AddInt32(&calls, 1)
+		switch string(ctx.Path()) {
+		case "/api/fresh":
+			ctx.Response.Header.Set("Cache-Control", "max-age=60")
+		case "/api/nostore":
+			ctx.Response.Header.Set("Cache-Control", "no-store")
+		case "/api/etag":
+			if string(ctx.Request.Header.Peek("If-None-Match")) == `"v1"` {
+				atomic.AddInt32(&notModified, 1)
+				ctx.SetStatusCode(fasthttp.StatusNotModified)
+				return
+			}
+			ctx.Response.Header.Set("Cache-Control", "no-cache")
+			ctx.Response.Header.Set("ETag", `"v1"`)
+		}
+		ctx.SetBodyString(`{"ret":0,"msg":"","data":"ok"}`)
+	})
+	defer closeFn()
+	api.cache = newResponseCache(&CacheOptions{}, api.Url)
+
+	get := func(uri string) {
+		var s string
+		if _, err := api.NewRequest("GET", uri).Do(context.Background(), &s); err != nil || s != "ok" {
+			t.Fatal(uri, s, err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		get("/fresh")
+	}
+	if calls != 1 {
+		t.Fatal("max-age response not cached", calls)
+	}
+	var s string
+	if _, err := api.NewRequest("GET", "/fresh").NoCache().Do(context.Background(), &s); err != nil || calls != 2 {
+		t.Fatal("NoCache must bypass the cache", calls, err)
+	}
+
+	calls = 0
+	get("/nostore")
+	get("/nostore")
+	if calls != 2 {
+		t.Fatal("no-store response cached", calls)
+	}
+
+	calls = 0
+	get("/etag")
+	get("/etag")
+	get("/etag")
+	if calls != 3 || notModified != 2 {
+		t.Fatal("etag revalidation", calls, notModified)
+	}
+}
+
+func TestMicroSrvApiCacheStaleWhileRevalidate(t *testing.T) {
+	var calls int32
+	api, closeFn := newMicroSrvTestApi(t, func(ctx *fasthttp.RequestCtx) {
+		n := atomic.AddInt32(&calls, 1)
+		ctx.Response.Header.Set("Cache-Control", "max-age=0, stale-while-revalidate=60")
+		if n == 1 {
+			ctx.SetBodyString(`{"ret":0,"msg":"","data":"v1"}`)
+		} else {
+			ctx.SetBodyString(`{"ret":0,"msg":"","data":"v2"}`)
+		}
+	})
+	defer closeFn()
+	api.cache = newResponseCache(&CacheOptions{}, api.Url)
+
+	get := func() string {
+		var s string
+		if _, err := api.NewRequest("GET", "/config").Do(context.Background(), &s); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	if s := get(); s != "v1" {
+		t.Fatal(s)
+	}
+	if s := get(); s != "v1" {
+		t.Fatal("stale response must be served while revalidating", s)
+	}
+	for i := 0; i < 100 && atomic.LoadInt32(&calls) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	for i := 0; i < 100; i++ {
+		if s := get(); s == "v2" {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("background revalidation did not refresh the cache")
+}
+
+func TestMicroSrvApiCacheCoalesce(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	api, closeFn := newMicroSrvTestApi(t, func(ctx *fasthttp.RequestCtx) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		ctx.Response.Header.Set("Cache-Control", "max-age=60")
+		ctx.SetBodyString(`{"ret":0,"msg":"","data":"ok"}`)
+	})
+	defer closeFn()
+	api.cache = newResponseCache(&CacheOptions{}, api.Url)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var s string
+			if _, err := api.NewRequest("GET", "/slow").Do(context.Background(), &s); err != nil || s != "ok" {
+				t.Error(s, err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if atomic.LoadInt32(&calls) != 1 {
+		t.Fatal("concurrent requests not coalesced", calls)
+	}
+}
+
+func TestMicroSrvApiCacheFollowerContext(t *testing.T) {
+	release := make(chan struct{})
+	api, closeFn := newMicroSrvTestApi(t, func(ctx *fasthttp.RequestCtx) {
+		<-release
+		ctx.Response.Header.Set("Cache-Control", "max-age=60")
+		ctx.SetBodyString(`{"ret":0,"msg":"","data":"ok"}`)
+	})
+	defer closeFn()
+	defer close(release)
+	api.cache = newResponseCache(&CacheOptions{}, api.Url)
+
+	leader := make(chan error, 1)
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	go func() {
+		var s string
+		_, err := api.NewRequest("GET", "/slow").Timeout(10*time.Millisecond).Do(leaderCtx, &s)
+		leader <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	// 跟随者在等待时取消应立即返回
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	var s string
+	if _, err := api.NewRequest("GET", "/slow").Do(ctx, &s); err != context.DeadlineExceeded {
+		t.Fatal("follower must return on its own ctx", err)
+	}
+	// 发起方取消和请求级超时不影响共享的上游请求
+	cancelLeader()
+	if err := <-leader; err != context.Canceled {
+		t.Fatal(err)
+	}
+	follower := make(chan error, 1)
+	go func() {
+		var s string
+		_, err := api.NewRequest("GET", "/slow").Do(context.Background(), &s)
+		follower <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	release <- struct{}{}
+	if err := <-follower; err != nil {
+		t.Fatal("shared fetch cancelled with the leader", err)
+	}
+}
+
+func TestMicroSrvApiCacheHeaders(t *testing.T) {
+	var calls int32
+	api, closeFn := newMicroSrvTestApi(t, func(ctx *fasthttp.RequestCtx) {
+		atomic.AddInt32(&calls, 1)
+		ctx.Response.Header.Set("Cache-Control", "max-age=60")
+		if string(ctx.Path()) == "/api/private" {
+			ctx.Response.Header.Set("Cache-Control", "private, max-age=60")
+		}
+		ctx.SetBodyString(`{"ret":0,"msg":"","data":"` + string(ctx.Request.Header.Peek("Authorization")) + `"}`)
+	})
+	defer closeFn()
+	api.cache = newResponseCache(&CacheOptions{}, api.Url)
+
+	get := func(uri string, token string) {
+		var s string
+		if _, err := api.NewRequest("GET", uri).Header("Authorization", token).Do(context.Background(), &s); err != nil || s != token {
+			t.Fatal(uri, token, s, err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		get("/me", "alice")
+		get("/me", "bob")
+	}
+	if calls != 2 {
+		t.Fatal("responses must be cached per request header", calls)
+	}
+	if key := api.cache.key(api.NewRequest("GET", "/me").Header("Authorization", "alice")); strings.Contains(key, "alice") {
+		t.Fatal("request headers must not appear in the cache key", key)
+	}
+
+	calls = 0
+	get("/private", "alice")
+	get("/private", "alice")
+	if calls != 1 {
+		t.Fatal("private response must be cached by a private store", calls)
+	}
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+	api.cache = newResponseCache(&CacheOptions{Store: NewRedisCache(&RedisCacheOptions{Redis: &db.Redis{Client: client}})}, api.Url)
+	calls = 0
+	get("/private", "alice")
+	get("/private", "alice")
+	get("/me", "alice")
+	get("/me", "alice")
+	if calls != 3 {
+		t.Fatal("private response must not be cached by a shared store", calls)
+	}
+}
+
+func TestCacheNamespace(t *testing.T) {
+	api := NewMicroSrvApi(&MicroSrvApiOptions{Endpoints: []string{"http://b/api", "http://a/api"}, Cache: &CacheOptions{}})
+	if api.err != nil || api.cache.namespace != "http://a/api,http://b/api" {
+		t.Fatal(api.err, api.cache)
+	}
+	discovery := StaticDiscovery{"http://a/api"}
+	api = NewMicroSrvApi(&MicroSrvApiOptions{Discovery: discovery, Cache: &CacheOptions{}})
+	if _, err := api.NewRequest("GET", "/user").Do(context.Background(), nil); err != errCacheNamespace {
+		t.Fatal(err)
+	}
+	api = NewMicroSrvApi(&MicroSrvApiOptions{Discovery: discovery, Cache: &CacheOptions{Namespace: "user"}})
+	if api.err != nil || api.cache.namespace != "user" {
+		t.Fatal(api.err, api.cache)
+	}
+}
+
+func TestParseCacheControl(t *testing.T) {
+	d := parseCacheControl(`public, max-age="120", stale-while-revalidate=30, must-revalidate`)
+	if !d.hasMaxAge || d.maxAge != 2*time.Minute || d.staleWhileRevalidate != 30*time.Second || !d.mustRevalidate {
+		t.Fatal(d)
+	}
+	if d := parseCacheControl("No-Store"); !d.noStore || d.hasMaxAge {
+		t.Fatal(d)
+	}
+}
+
+func TestMemoryCache(t *testing.T) {
+	cache := NewMemoryCache(2)
+	cache.Set("a", &CachedResponse{Body: []byte("a")}, time.Minute)
+	cache.Set("b", &CachedResponse{Body: []byte("b")}, time.Minute)
+	cache.Get("a")
+	cache.Set("c", &CachedResponse{Body: []byte("c")}, time.Minute)
+	if cache.Len() != 2 || cache.Get("b") != nil || cache.Get("a") == nil || cache.Get("c") == nil {
+		t.Fatal("least recently used entry not evicted")
+	}
+	cache.Set("d", &CachedResponse{}, -time.Second)
+	if cache.Get("d") != nil {
+		t.Fatal("expired entry returned")
+	}
+	cache.Delete("a")
+	if cache.Get("a") != nil {
+		t.Fatal("deleted entry returned")
+	}
+}
+
+func TestRedisCache(t *testing.T) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+	cache := NewRedisCache(&RedisCacheOptions{Redis: &db.Redis{Client: client, KeyPrefix: "test:"}})
+
+	if cache.Get("k") != nil {
+		t.Fatal("missing key returned")
+	}
+	cache.Set("k", &CachedResponse{Body: []byte("body"), ETag: `"e"`, MaxAge: time.Minute}, time.Minute)
+	if !server.Exists("test:http:cache:k") || server.TTL("test:http:cache:k") != time.Minute {
+		t.Fatal(server.Keys())
+	}
+	got := cache.Get("k")
+	if got == nil || string(got.Body) != "body" || got.ETag != `"e"` || got.MaxAge != time.Minute {
+		t.Fatal(got)
+	}
+	cache.Delete("k")
+	if cache.Get("k") != nil {
+		t.Fatal("deleted key returned")
+	}
+}
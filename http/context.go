@@ -0,0 +1,97 @@
+package http
+
+import (
+	"context"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/valyala/fasthttp"
+)
+
+type contextKey int
+
+const (
+	requestIdContextKey contextKey = iota
+	claimsContextKey
+)
+
+// 请求上下文, 请求ID和鉴权信息从HttpContext实时读取, 中间件后设置的值同样可见
+type requestContext struct {
+	context.Context
+	c *HttpContext
+}
+
+func (this *requestContext) Value(key interface{}) interface{} {
+	switch key {
+	case requestIdContextKey:
+		return this.c.RequestID()
+	case claimsContextKey:
+		return this.c.Claims()
+	}
+	return this.Context.Value(key)
+}
+
+// Context 返回请求的context.Context, 请求结束或服务关闭时取消
+// fasthttp无法在处理过程中感知客户端断开, 客户端断开不会取消, 超时需配合Timeout中间件
+func (this *HttpContext) Context() context.Context {
+	if this.ctx == nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		this.ctx = &requestContext{Context: ctx, c: this}
+		this.cancel = cancel
+		shutdown := this.serverDone()
+		if shutdown == nil {
+			// 未经Server或Init初始化的RequestCtx无法获取服务关闭信号
+			return this.ctx
+		}
+		go func() {
+			select {
+			case <-shutdown:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+	return this.ctx
+}
+
+// SetContext 替换请求上下文, 新上下文应由Context()派生
+func (this *HttpContext) SetContext(ctx context.Context) {
+	this.ctx = ctx
+}
+
+// serverDone 服务关闭信号, Timeout的副本沿用原请求的信号
+func (this *HttpContext) serverDone() <-chan struct{} {
+	if this.shutdown != nil {
+		return this.shutdown
+	}
+	if this.RawCtx.Conn() == nil {
+		return nil
+	}
+	return this.RawCtx.Done()
+}
+
+// release 请求结束时取消上下文, 流式响应在写入结束后调用
+func (this *HttpContext) release() {
+	if this.cancel != nil {
+		this.cancel()
+	}
+}
+
+// response 返回实际发送的响应, 超时后为超时响应
+func (this *HttpContext) response() *fasthttp.Response {
+	if this.timeoutResponse != nil {
+		return this.timeoutResponse
+	}
+	return &this.RawCtx.Response
+}
+
+// RequestIDFromContext 从请求上下文获取请求ID
+func RequestIDFromContext(ctx context.Context) string {
+	requestId, _ := ctx.Value(requestIdContextKey).(string)
+	return requestId
+}
+
+// ClaimsFromContext 从请求上下文获取鉴权信息
+func ClaimsFromContext(ctx context.Context) jwt.MapClaims {
+	claims, _ := ctx.Value(claimsContextKey).(jwt.MapClaims)
+	return claims
+}
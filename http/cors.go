@@ -0,0 +1,138 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// 跨域配置
+type CorsOptions struct {
+	AllowOrigins     []string // 允许的来源, 支持"*"及"https://*.example.com"通配子域名
+	AllowMethods     []string // 允许的方法, 为空时使用默认方法
+	AllowHeaders     []string // 允许的请求头, 为空时回显预检请求的请求头
+	ExposeHeaders    []string // 暴露给浏览器的响应头
+	AllowCredentials bool     // 是否允许携带Cookie
+	MaxAge           int      // 预检结果缓存秒数
+}
+
+var defaultCorsMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut,
+	http.MethodPatch, http.MethodDelete, http.MethodHead}
+
+type corsOrigin struct {
+	prefix   string
+	suffix   string
+	wildcard bool
+}
+
+func (this *corsOrigin) match(origin string) bool {
+	if !this.wildcard {
+		return origin == this.prefix
+	}
+	return len(origin) > len(this.prefix)+len(this.suffix) &&
+		strings.HasPrefix(origin, this.prefix) && strings.HasSuffix(origin, this.suffix)
+}
+
+// Cors 跨域中间件, 应答预检请求并为实际请求设置Access-Control-*响应头
+func Cors(options *CorsOptions) Middleware {
+	allowAll := false
+	origins := make([]*corsOrigin, 0, len(options.AllowOrigins))
+	for _, o := range options.AllowOrigins {
+		o = strings.ToLower(o)
+		if o == "*" {
+			allowAll = true
+		} else if i := strings.Index(o, "*"); i != -1 {
+			origins = append(origins, &corsOrigin{prefix: o[:i], suffix: o[i+1:], wildcard: true})
+		} else {
+			origins = append(origins, &corsOrigin{prefix: o})
+		}
+	}
+	methods := options.AllowMethods
+	if len(methods) == 0 {
+		methods = defaultCorsMethods
+	}
+	allowMethods := strings.ToUpper(strings.Join(methods, ", "))
+	allowHeaders := strings.Join(options.AllowHeaders, ", ")
+	exposeHeaders := strings.Join(options.ExposeHeaders, ", ")
+	maxAge := ""
+	if options.MaxAge > 0 {
+		maxAge = strconv.Itoa(options.MaxAge)
+	}
+	isAllowed := func(origin string) bool {
+		if allowAll {
+			return true
+		}
+		origin = strings.ToLower(origin)
+		for _, o := range origins {
+			if o.match(origin) {
+				return true
+			}
+		}
+		return false
+	}
+	isMethodAllowed := func(method string) bool {
+		for _, m := range methods {
+			if strings.EqualFold(m, method) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(next HandlerFunc) HandlerFunc {
+		return func(c *HttpContext) {
+			ctx := c.RawCtx
+			header := &ctx.Response.Header
+			header.Add("Vary", "Origin")
+			origin := string(ctx.Request.Header.Peek("Origin"))
+			preflight := ctx.IsOptions() && len(ctx.Request.Header.Peek("Access-Control-Request-Method")) > 0
+			if origin == "" {
+				next(c)
+				return
+			}
+			if !isAllowed(origin) {
+				if preflight {
+					ctx.SetStatusCode(http.StatusForbidden)
+					return
+				}
+				next(c)
+				return
+			}
+			if allowAll && !options.AllowCredentials {
+				header.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				header.Set("Access-Control-Allow-Origin", origin)
+			}
+			if options.AllowCredentials {
+				header.Set("Access-Control-Allow-Credentials", "true")
+			}
+			if !preflight {
+				if exposeHeaders != "" {
+					header.Set("Access-Control-Expose-Headers", exposeHeaders)
+				}
+				next(c)
+				return
+			}
+
+			// 预检请求
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+			if !isMethodAllowed(string(ctx.Request.Header.Peek("Access-Control-Request-Method"))) {
+				header.Del("Access-Control-Allow-Origin")
+				header.Del("Access-Control-Allow-Credentials")
+				ctx.SetStatusCode(http.StatusForbidden)
+				return
+			}
+			header.Set("Access-Control-Allow-Methods", allowMethods)
+			if allowHeaders != "" {
+				header.Set("Access-Control-Allow-Headers", allowHeaders)
+			} else if reqHeaders := ctx.Request.Header.Peek("Access-Control-Request-Headers"); len(reqHeaders) > 0 {
+				header.SetBytesV("Access-Control-Allow-Headers", reqHeaders)
+			}
+			if maxAge != "" {
+				header.Set("Access-Control-Max-Age", maxAge)
+			}
+			ctx.SetStatusCode(http.StatusNoContent)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package http
+
+import (
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+type corsTestController struct {
+	Controller
+}
+
+func (this *corsTestController) Hello(ctx *HttpContext) *ApiResponse {
+	return this.Success("hello")
+}
+
+func newCorsTestHandler() fasthttp.RequestHandler {
+	router := new(Router)
+	router.Init()
+	var controller interface{} = &corsTestController{}
+	router.Group("/api", nil, func(group *RouterGroup) {
+		group.Use(Cors(&CorsOptions{
+			AllowOrigins:     []string{"https://app.example.com", "https://*.example.org"},
+			AllowHeaders:     []string{"Authorization", "Content-Type"},
+			ExposeHeaders:    []string{"X-Request-ID"},
+			AllowCredentials: true,
+			MaxAge:           600,
+		}))
+		group.Get("/hello", &controller, "Hello")
+	})
+	return HttpHandler("", router)
+}
+
+func doCorsRequest(handler fasthttp.RequestHandler, method string, origin string, reqMethod string) *fasthttp.RequestCtx {
+	req := fasthttp.AcquireRequest()
+	req.Header.SetMethod(method)
+	req.SetRequestURI("/api/hello")
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	if reqMethod != "" {
+		req.Header.Set("Access-Control-Request-Method", reqMethod)
+	}
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Init(req, nil, nil)
+	handler(ctx)
+	return ctx
+}
+
+func TestCorsPreflight(t *testing.T) {
+	handler := newCorsTestHandler()
+	ctx := doCorsRequest(handler, "OPTIONS", "https://app.example.com", "POST")
+	if ctx.Response.StatusCode() != 204 {
+		t.Fatalf("status %d", ctx.Response.StatusCode())
+	}
+	h := &ctx.Response.Header
+	if string(h.Peek("Access-Control-Allow-Origin")) != "https://app.example.com" ||
+		string(h.Peek("Access-Control-Allow-Credentials")) != "true" ||
+		string(h.Peek("Access-Control-Allow-Headers")) != "Authorization, Content-Type" ||
+		string(h.Peek("Access-Control-Max-Age")) != "600" {
+		t.Error(h.String())
+	}
+	if len(ctx.Response.Body()) != 0 {
+		t.Error(string(ctx.Response.Body()))
+	}
+
+	ctx = doCorsRequest(handler, "OPTIONS", "https://app.example.com", "TRACE")
+	if ctx.Response.StatusCode() != 403 {
+		t.Errorf("status %d", ctx.Response.StatusCode())
+	}
+	ctx = doCorsRequest(handler, "OPTIONS", "https://evil.com", "POST")
+	if ctx.Response.StatusCode() != 403 || len(ctx.Response.Header.Peek("Access-Control-Allow-Origin")) != 0 {
+		t.Errorf("status %d", ctx.Response.StatusCode())
+	}
+}
+
+func TestCorsActualRequest(t *testing.T) {
+	handler := newCorsTestHandler()
+	ctx := doCorsRequest(handler, "GET", "https://a.b.example.org", "")
+	h := &ctx.Response.Header
+	if string(h.Peek("Access-Control-Allow-Origin")) != "https://a.b.example.org" ||
+		string(h.Peek("Access-Control-Expose-Headers")) != "X-Request-ID" ||
+		string(h.Peek("Vary")) != "Origin" {
+		t.Error(h.String())
+	}
+	if string(ctx.Response.Body()) != `{"ret":0,"msg":"","data":"hello"}` {
+		t.Error(string(ctx.Response.Body()))
+	}
+
+	ctx = doCorsRequest(handler, "GET", "https://example.org", "")
+	if len(ctx.Response.Header.Peek("Access-Control-Allow-Origin")) != 0 {
+		t.Error(ctx.Response.Header.String())
+	}
+}
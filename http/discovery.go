@@ -0,0 +1,213 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lxf9601/go-common/db"
+	"github.com/lxf9601/go-common/logc"
+)
+
+const (
+	defaultDnsSrvRefresh     = 30 * time.Second
+	defaultDiscoveryInterval = 5 * time.Second
+)
+
+var ErrNoEndpoint = errors.New("no endpoint available")
+
+// 服务发现, 返回服务实例地址列表, 地址格式同MicroSrvApi.Url, 如http://10.0.0.1:8080/api
+// 实现需并发安全, 每次选择实例时都会调用, 应自行缓存
+type Discovery interface {
+	Endpoints() ([]string, error)
+}
+
+// 静态地址列表
+type StaticDiscovery []string
+
+func (this StaticDiscovery) Endpoints() ([]string, error) {
+	return this, nil
+}
+
+// DNS SRV服务发现配置
+type DnsSrvOptions struct {
+	Service string        // 服务名, 如http, 为空时直接查询Name
+	Proto   string        // 协议, 默认tcp
+	Name    string        // 域名, 如user.service.consul
+	Scheme  string        // 地址协议, 默认http
+	Path    string        // 地址路径, 如/api
+	Refresh time.Duration // 刷新间隔, 默认30秒
+}
+
+// DNS SRV服务发现, 只使用优先级最高(Priority最小)的记录
+type DnsSrvDiscovery struct {
+	options   DnsSrvOptions
+	lock      sync.Mutex
+	endpoints []string
+	expires   time.Time
+	lookup    func(service, proto, name string) (string, []*net.SRV, error)
+}
+
+func NewDnsSrvDiscovery(options *DnsSrvOptions) *DnsSrvDiscovery {
+	opts := *options
+	if opts.Proto == "" {
+		opts.Proto = "tcp"
+	}
+	if opts.Scheme == "" {
+		opts.Scheme = "http"
+	}
+	if opts.Refresh <= 0 {
+		opts.Refresh = defaultDnsSrvRefresh
+	}
+	return &DnsSrvDiscovery{options: opts, lookup: net.LookupSRV}
+}
+
+// Endpoints 缓存过期后重新查询, 查询失败时沿用上次结果
+func (this *DnsSrvDiscovery) Endpoints() ([]string, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if time.Now().Before(this.expires) {
+		return this.endpoints, nil
+	}
+	_, records, err := this.lookup(this.options.Service, this.options.Proto, this.options.Name)
+	if err == nil && len(records) == 0 {
+		err = fmt.Errorf("dns srv %s: no records", this.options.Name)
+	}
+	if err != nil {
+		if this.endpoints != nil {
+			logc.Warnf("dns srv %s: %s, using cached endpoints", this.options.Name, err)
+			this.expires = time.Now().Add(this.options.Refresh)
+			return this.endpoints, nil
+		}
+		return nil, err
+	}
+	priority := records[0].Priority
+	for _, record := range records {
+		if record.Priority < priority {
+			priority = record.Priority
+		}
+	}
+	endpoints := make([]string, 0, len(records))
+	for _, record := range records {
+		if record.Priority == priority {
+			host := net.JoinHostPort(strings.TrimSuffix(record.Target, "."), fmt.Sprint(record.Port))
+			endpoints = append(endpoints, this.options.Scheme+"://"+host+this.options.Path)
+		}
+	}
+	sort.Strings(endpoints)
+	this.endpoints = endpoints
+	this.expires = time.Now().Add(this.options.Refresh)
+	return endpoints, nil
+}
+
+// 文件服务发现配置
+type FileDiscoveryOptions struct {
+	Path     string        // 文件路径, 每行一个地址, 忽略空行和#开头的注释
+	Interval time.Duration // 检查文件修改的间隔, 默认5秒
+}
+
+// 文件服务发现, 文件修改后自动重新加载
+type FileDiscovery struct {
+	options   FileDiscoveryOptions
+	lock      sync.Mutex
+	endpoints []string
+	modTime   time.Time
+	checked   time.Time
+}
+
+func NewFileDiscovery(options *FileDiscoveryOptions) *FileDiscovery {
+	opts := *options
+	if opts.Interval <= 0 {
+		opts.Interval = defaultDiscoveryInterval
+	}
+	return &FileDiscovery{options: opts}
+}
+
+// Endpoints 按间隔检查文件修改时间, 变化时重新读取, 读取失败时沿用上次结果
+func (this *FileDiscovery) Endpoints() ([]string, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if !this.checked.IsZero() && time.Since(this.checked) < this.options.Interval {
+		return this.endpoints, nil
+	}
+	this.checked = time.Now()
+	info, err := os.Stat(this.options.Path)
+	if err == nil && info.ModTime().Equal(this.modTime) && this.endpoints != nil {
+		return this.endpoints, nil
+	}
+	var content []byte
+	if err == nil {
+		content, err = ioutil.ReadFile(this.options.Path)
+	}
+	if err != nil {
+		if this.endpoints != nil {
+			logc.Warnf("file discovery %s: %s, using cached endpoints", this.options.Path, err)
+			return this.endpoints, nil
+		}
+		return nil, err
+	}
+	endpoints := make([]string, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			endpoints = append(endpoints, line)
+		}
+	}
+	this.endpoints = endpoints
+	this.modTime = info.ModTime()
+	return endpoints, nil
+}
+
+// Redis服务发现配置
+type RedisDiscoveryOptions struct {
+	Redis    *db.Redis     // Redis服务
+	Key      string        // 保存地址的集合, 由服务实例SAdd/SRem维护
+	Interval time.Duration // 刷新间隔, 默认5秒
+}
+
+// Redis集合服务发现
+type RedisDiscovery struct {
+	options   RedisDiscoveryOptions
+	lock      sync.Mutex
+	endpoints []string
+	expires   time.Time
+}
+
+func NewRedisDiscovery(options *RedisDiscoveryOptions) *RedisDiscovery {
+	opts := *options
+	if opts.Interval <= 0 {
+		opts.Interval = defaultDiscoveryInterval
+	}
+	return &RedisDiscovery{options: opts}
+}
+
+// Endpoints 缓存过期后重新读取集合, 读取失败时沿用上次结果
+func (this *RedisDiscovery) Endpoints() ([]string, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if time.Now().Before(this.expires) {
+		return this.endpoints, nil
+	}
+	endpoints, err := this.options.Redis.SMembers(this.options.Key).Result()
+	if err != nil {
+		if this.endpoints != nil {
+			logc.Warnf("redis discovery %s: %s, using cached endpoints", this.options.Key, err)
+			this.expires = time.Now().Add(this.options.Interval)
+			return this.endpoints, nil
+		}
+		return nil, err
+	}
+	sort.Strings(endpoints)
+	this.endpoints = endpoints
+	this.expires = time.Now().Add(this.options.Interval)
+	return endpoints, nil
+}
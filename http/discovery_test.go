@@ -0,0 +1,119 @@
+package http
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+	"github.com/lxf9601/go-common/db"
+)
+
+func TestDnsSrvDiscovery(t *testing.T) {
+	discovery := NewDnsSrvDiscovery(&DnsSrvOptions{Service: "http", Name: "user.service", Path: "/api"})
+	lookups := 0
+	discovery.lookup = func(service, proto, name string) (string, []*net.SRV, error) {
+		lookups++
+		if lookups > 1 {
+			return "", nil, errors.New("dns down")
+		}
+		return "", []*net.SRV{
+			{Target: "b.node.", Port: 8080, Priority: 1},
+			{Target: "a.node.", Port: 8080, Priority: 1},
+			{Target: "backup.node.", Port: 8080, Priority: 2},
+		}, nil
+	}
+	endpoints, err := discovery.Endpoints()
+	if err != nil || len(endpoints) != 2 || endpoints[0] != "http://a.node:8080/api" || endpoints[1] != "http://b.node:8080/api" {
+		t.Fatal(endpoints, err)
+	}
+	discovery.Endpoints()
+	if lookups != 1 {
+		t.Fatal("cached endpoints must not be looked up again", lookups)
+	}
+	discovery.expires = time.Time{}
+	if endpoints, err := discovery.Endpoints(); err != nil || len(endpoints) != 2 || lookups != 2 {
+		t.Fatal("lookup failures keep the cached endpoints", endpoints, err)
+	}
+}
+
+func TestFileDiscovery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "discovery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "endpoints")
+	if _, err := NewFileDiscovery(&FileDiscoveryOptions{Path: path}).Endpoints(); err == nil {
+		t.Fatal("missing file must fail")
+	}
+
+	ioutil.WriteFile(path, []byte("# user service\nhttp://a/api\n\n  http://b/api  \n"), 0644)
+	discovery := NewFileDiscovery(&FileDiscoveryOptions{Path: path, Interval: time.Millisecond})
+	endpoints, err := discovery.Endpoints()
+	if err != nil || len(endpoints) != 2 || endpoints[1] != "http://b/api" {
+		t.Fatal(endpoints, err)
+	}
+
+	ioutil.WriteFile(path, []byte("http://c/api\n"), 0644)
+	os.Chtimes(path, time.Now(), time.Now().Add(time.Second))
+	time.Sleep(2 * time.Millisecond)
+	if endpoints, err := discovery.Endpoints(); err != nil || len(endpoints) != 1 || endpoints[0] != "http://c/api" {
+		t.Fatal(endpoints, err)
+	}
+}
+
+func TestRedisDiscovery(t *testing.T) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+	r := &db.Redis{Client: client, KeyPrefix: "test:"}
+	r.SAdd("svc:user", "http://b:8080/api", "http://a:8080/api")
+	discovery := NewRedisDiscovery(&RedisDiscoveryOptions{Redis: r, Key: "svc:user", Interval: time.Minute})
+	endpoints, err := discovery.Endpoints()
+	if err != nil || len(endpoints) != 2 || endpoints[0] != "http://a:8080/api" || endpoints[1] != "http://b:8080/api" {
+		t.Fatal(endpoints, err)
+	}
+
+	// 下线的实例在缓存过期后移除, 同时清理其熔断器和舱壁
+	api := NewMicroSrvApi(&MicroSrvApiOptions{Discovery: discovery, Breaker: &BreakerOptions{}})
+	for i := 0; i < 2; i++ {
+		e, err := api.balancer.pick("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		api.balancer.done(e, false)
+	}
+	if len(api.guards) != 2 {
+		t.Fatal(api.guards)
+	}
+	r.SRem("svc:user", "http://b:8080/api")
+	if endpoints, _ := discovery.Endpoints(); len(endpoints) != 2 {
+		t.Fatal("cached endpoints must be used before the interval", endpoints)
+	}
+	discovery.expires = time.Time{}
+	if _, err := api.balancer.pick(""); err != nil {
+		t.Fatal(err)
+	}
+	if len(api.guards) != 1 || api.guards["a:8080"] == nil {
+		t.Fatal("guards of removed hosts not pruned", api.guards)
+	}
+
+	server.Close()
+	discovery.expires = time.Time{}
+	if endpoints, err := discovery.Endpoints(); err != nil || len(endpoints) != 1 || endpoints[0] != "http://a:8080/api" {
+		t.Fatal("redis failures keep the cached endpoints", endpoints, err)
+	}
+	if _, err := NewRedisDiscovery(&RedisDiscoveryOptions{Redis: r, Key: "svc:user"}).Endpoints(); err == nil {
+		t.Fatal("redis failure without cached endpoints must fail")
+	}
+}
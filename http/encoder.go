@@ -0,0 +1,393 @@
+package http
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	CONTENT_TYPE_XML      = "application/xml; charset=utf-8"
+	CONTENT_TYPE_MSGPACK  = "application/msgpack"
+	CONTENT_TYPE_PROTOBUF = "application/x-protobuf"
+)
+
+// JSON字段命名方式, 只作用于没有json标签的字段
+const (
+	CASING_DEFAULT = iota // 使用字段名
+	CASING_SNAKE          // user_name
+	CASING_CAMEL          // userName
+)
+
+// 编码器不支持该类型的返回值, 此时改用默认编码器
+var ErrUnsupportedValue = errors.New("encoder: unsupported value")
+
+// 响应编码器
+type Encoder interface {
+	ContentType() string
+	Encode(w io.Writer, v interface{}) error
+}
+
+// 默认编码器, 与原有json.Marshal输出一致
+var DefaultEncoder Encoder = NewJSONEncoder(&JSONEncoderOptions{})
+
+// Accept中的别名
+var mediaTypeAliases = map[string]string{
+	"text/xml":               "application/xml",
+	"application/x-msgpack":  "application/msgpack",
+	"application/protobuf":   "application/x-protobuf",
+	"application/x-protobuf": "application/x-protobuf",
+}
+
+// JSON编码配置
+type JSONEncoderOptions struct {
+	Fast   bool // 使用json-iterator编码, 输出与标准库兼容
+	Casing int  // 字段命名方式, 非CASING_DEFAULT时使用json-iterator
+}
+
+// JSON编码器
+type JSONEncoder struct {
+	api jsoniter.API
+}
+
+// NewJSONEncoder 创建JSON编码器
+func NewJSONEncoder(options *JSONEncoderOptions) *JSONEncoder {
+	encoder := new(JSONEncoder)
+	if options.Fast || options.Casing != CASING_DEFAULT {
+		encoder.api = jsoniter.Config{EscapeHTML: true, SortMapKeys: true, ValidateJsonRawMessage: true}.Froze()
+		if options.Casing != CASING_DEFAULT {
+			encoder.api.RegisterExtension(&casingExtension{casing: options.Casing})
+		}
+	}
+	return encoder
+}
+
+func (this *JSONEncoder) ContentType() string {
+	return CONTENT_TYPE_JSON
+}
+
+func (this *JSONEncoder) Encode(w io.Writer, v interface{}) error {
+	if this.api == nil {
+		j, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(j)
+		return err
+	}
+	stream := this.api.BorrowStream(w)
+	defer this.api.ReturnStream(stream)
+	stream.WriteVal(v)
+	if stream.Error != nil {
+		return stream.Error
+	}
+	return stream.Flush()
+}
+
+// 按命名方式修改未设置json标签的字段名
+type casingExtension struct {
+	jsoniter.DummyExtension
+	casing int
+}
+
+func (this *casingExtension) UpdateStructDescriptor(structDescriptor *jsoniter.StructDescriptor) {
+	for _, binding := range structDescriptor.Fields {
+		if name := strings.SplitN(binding.Field.Tag().Get("json"), ",", 2)[0]; name != "" {
+			continue
+		}
+		name := binding.Field.Name()
+		if this.casing == CASING_SNAKE {
+			name = snakeCase(name)
+		} else if this.casing == CASING_CAMEL {
+			name = lowerCamelCase(name)
+		}
+		binding.ToNames = []string{name}
+		binding.FromNames = []string{name}
+	}
+}
+
+// snakeCase UserID -> user_id
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// lowerCamelCase UserID -> userID, ID -> id
+func lowerCamelCase(name string) string {
+	runes := []rune(name)
+	for i := range runes {
+		if !unicode.IsUpper(runes[i]) || (i > 0 && i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+			break
+		}
+		runes[i] = unicode.ToLower(runes[i])
+	}
+	return string(runes)
+}
+
+// XML编码器, 含map等无法编码的类型时返回ErrUnsupportedValue
+type XMLEncoder struct{}
+
+func (this *XMLEncoder) ContentType() string {
+	return CONTENT_TYPE_XML
+}
+
+func (this *XMLEncoder) Encode(w io.Writer, v interface{}) error {
+	// 先编码到缓冲区, 类型不支持时不留下部分输出
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	if err := xml.NewEncoder(&buf).Encode(v); err != nil {
+		if _, ok := err.(*xml.UnsupportedTypeError); ok {
+			return ErrUnsupportedValue
+		}
+		return err
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// MessagePack编码器, 字段名使用json标签
+type MsgpackEncoder struct{}
+
+func (this *MsgpackEncoder) ContentType() string {
+	return CONTENT_TYPE_MSGPACK
+}
+
+func (this *MsgpackEncoder) Encode(w io.Writer, v interface{}) error {
+	encoder := msgpack.NewEncoder(w)
+	encoder.SetCustomStructTag("json")
+	return encoder.Encode(v)
+}
+
+// Protobuf编码器, 返回值或ApiResponse.Data须为proto.Message
+type ProtobufEncoder struct{}
+
+func (this *ProtobufEncoder) ContentType() string {
+	return CONTENT_TYPE_PROTOBUF
+}
+
+func (this *ProtobufEncoder) Encode(w io.Writer, v interface{}) error {
+	m, ok := unwrapApiResponse(v).(proto.Message)
+	if !ok {
+		return ErrUnsupportedValue
+	}
+	b, err := proto.Marshal(m)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// CSV编码器, 返回值或ApiResponse.Data须为结构体切片或[][]string, 表头使用json标签
+type CSVEncoder struct{}
+
+func (this *CSVEncoder) ContentType() string {
+	return CONTENT_TYPE_CSV
+}
+
+func (this *CSVEncoder) Encode(w io.Writer, v interface{}) error {
+	v = unwrapApiResponse(v)
+	if records, ok := v.([][]string); ok {
+		writer := csv.NewWriter(w)
+		writer.WriteAll(records)
+		return writer.Error()
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return ErrUnsupportedValue
+	}
+	elemType := rv.Type().Elem()
+	if elemType.Kind() == reflect.Ptr {
+		elemType = elemType.Elem()
+	}
+	if elemType.Kind() != reflect.Struct {
+		return ErrUnsupportedValue
+	}
+	header, fields := csvFields(elemType)
+	writer := csv.NewWriter(w)
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	record := make([]string, len(fields))
+	for i := 0; i < rv.Len(); i++ {
+		elem := reflect.Indirect(rv.Index(i))
+		for j, field := range fields {
+			if !elem.IsValid() {
+				record[j] = ""
+			} else {
+				record[j] = csvValue(elem.Field(field))
+			}
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// csvFields 导出字段的表头和下标
+func csvFields(t reflect.Type) ([]string, []int) {
+	header := make([]string, 0, t.NumField())
+	fields := make([]int, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		header = append(header, name)
+		fields = append(fields, i)
+	}
+	return header, fields
+}
+
+func csvValue(v reflect.Value) string {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	switch x := v.Interface().(type) {
+	case time.Time:
+		if x.IsZero() {
+			return ""
+		}
+		return x.Format(time.RFC3339)
+	case fmt.Stringer:
+		return x.String()
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	case reflect.Map, reflect.Slice, reflect.Struct:
+		j, _ := json.Marshal(v.Interface())
+		return string(j)
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// unwrapApiResponse 不支持信封结构的格式直接编码Data
+func unwrapApiResponse(v interface{}) interface{} {
+	if res, ok := v.(*ApiResponse); ok && res != nil {
+		return res.Data
+	}
+	return v
+}
+
+// SetEncoders 设置可协商的响应编码器, 第一个为默认编码器, 需在HttpHandler之前调用
+func (this *Router) SetEncoders(encoders ...Encoder) {
+	this.encoders = encoders
+}
+
+// Encoders 设置路由的响应编码器, 覆盖Router的设置
+func (this *RouterLocation) Encoders(encoders ...Encoder) *RouterLocation {
+	this.encoders = encoders
+	return this
+}
+
+// Encode 按Accept请求头选择编码器写入响应体, 无匹配时使用第一个编码器, 编码失败时响应500
+func (this *HttpContext) Encode(v interface{}) error {
+	encoders := this.encoders
+	if this.route != nil && this.route.encoders != nil {
+		encoders = this.route.encoders
+	}
+	if len(encoders) == 0 {
+		encoders = []Encoder{DefaultEncoder}
+	} else if len(encoders) > 1 {
+		this.RawCtx.Response.Header.Add("Vary", "Accept")
+	}
+	encoder := negotiate(string(this.RawCtx.Request.Header.Peek("Accept")), encoders)
+	this.SetContentType(encoder.ContentType())
+	err := encoder.Encode(this.RawCtx.Response.BodyWriter(), v)
+	if err == ErrUnsupportedValue && encoder != encoders[0] {
+		this.RawCtx.Response.ResetBody()
+		this.SetContentType(encoders[0].ContentType())
+		err = encoders[0].Encode(this.RawCtx.Response.BodyWriter(), v)
+	}
+	if err != nil {
+		writePanicResponse(this, http.StatusInternalServerError, "internal server error")
+	}
+	return err
+}
+
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+// negotiate 按q值从高到低匹配编码器
+func negotiate(accept string, encoders []Encoder) Encoder {
+	if accept == "" {
+		return encoders[0]
+	}
+	ranges := make([]acceptRange, 0)
+	for _, item := range strings.Split(accept, ",") {
+		params := strings.Split(item, ";")
+		r := acceptRange{mediaType: strings.ToLower(strings.TrimSpace(params[0])), q: 1}
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					r.q = q
+				}
+			}
+		}
+		if alias, ok := mediaTypeAliases[r.mediaType]; ok {
+			r.mediaType = alias
+		}
+		if r.q > 0 && r.mediaType != "" {
+			ranges = append(ranges, r)
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].q > ranges[j].q
+	})
+	for _, r := range ranges {
+		if r.mediaType == "*/*" {
+			return encoders[0]
+		}
+		for _, encoder := range encoders {
+			mediaType := strings.TrimSpace(strings.SplitN(encoder.ContentType(), ";", 2)[0])
+			if mediaType == r.mediaType ||
+				(strings.HasSuffix(r.mediaType, "/*") && strings.HasPrefix(mediaType, r.mediaType[:len(r.mediaType)-1])) {
+				return encoder
+			}
+		}
+	}
+	return encoders[0]
+}
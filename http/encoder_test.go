@@ -0,0 +1,123 @@
+package http
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type encoderTestUser struct {
+	UserID  int       `json:"id"`
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+	Note    *string   `json:"note"`
+}
+
+type encoderTestController struct {
+	Controller
+}
+
+func (this *encoderTestController) List(ctx *HttpContext) *ApiResponse {
+	return this.Success([]*encoderTestUser{{UserID: 1, Name: "a,b", Created: time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)}})
+}
+
+func (this *encoderTestController) Map(ctx *HttpContext) *ApiResponse {
+	return this.Success(map[string]int{"a": 1})
+}
+
+func (this *encoderTestController) Broken(ctx *HttpContext) *ApiResponse {
+	return this.Success(func() {})
+}
+
+func (this *encoderTestController) Proto(ctx *HttpContext) *ApiResponse {
+	return this.Success(wrapperspb.String("hello"))
+}
+
+func TestEncoderNegotiation(t *testing.T) {
+	router := new(Router)
+	router.Init()
+	router.SetEncoders(DefaultEncoder, &XMLEncoder{}, &MsgpackEncoder{}, &CSVEncoder{})
+	var controller interface{} = &encoderTestController{}
+	router.Get("/list", &controller, "List")
+	router.Get("/map", &controller, "Map")
+	router.Get("/broken", &controller, "Broken")
+	router.Get("/proto", &controller, "Proto").Encoders(&ProtobufEncoder{}, DefaultEncoder)
+	handler := HttpHandler("", router)
+	do := func(uri string, accept string) *fasthttp.RequestCtx {
+		req := fasthttp.AcquireRequest()
+		req.SetRequestURI(uri)
+		req.Header.Set("Accept", accept)
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Init(req, nil, nil)
+		handler(ctx)
+		return ctx
+	}
+
+	ctx := do("/list", "")
+	if string(ctx.Response.Body()) != `{"ret":0,"msg":"","data":[{"id":1,"name":"a,b","created":"2021-01-02T03:04:05Z","note":null}]}` {
+		t.Fatal(string(ctx.Response.Body()))
+	}
+	ctx = do("/list", "text/csv, application/json;q=0.5")
+	if string(ctx.Response.Body()) != "id,name,created,note\n1,\"a,b\",2021-01-02T03:04:05Z,\n" ||
+		string(ctx.Response.Header.ContentType()) != CONTENT_TYPE_CSV {
+		t.Fatal(string(ctx.Response.Body()))
+	}
+	ctx = do("/list", "application/x-msgpack")
+	res := make(map[string]interface{})
+	if err := msgpack.Unmarshal(ctx.Response.Body(), &res); err != nil || res["data"].([]interface{})[0].(map[string]interface{})["name"] != "a,b" {
+		t.Fatal(res, err)
+	}
+	ctx = do("/list", "text/xml;q=0.9, image/png")
+	if !bytes.Contains(ctx.Response.Body(), []byte("<Ret>0</Ret>")) {
+		t.Fatal(string(ctx.Response.Body()))
+	}
+	// XML无法编码map时改用默认编码器
+	ctx = do("/map", "application/xml")
+	if string(ctx.Response.Body()) != `{"ret":0,"msg":"","data":{"a":1}}` ||
+		string(ctx.Response.Header.ContentType()) != CONTENT_TYPE_JSON {
+		t.Fatal(string(ctx.Response.Body()))
+	}
+	ctx = do("/broken", "")
+	if ctx.Response.StatusCode() != 500 || !bytes.Contains(ctx.Response.Body(), []byte(`"ret":500`)) {
+		t.Fatal("encode failure must not leave a partial 200", ctx.Response.StatusCode(), string(ctx.Response.Body()))
+	}
+
+	ctx = do("/proto", "")
+	value := new(wrapperspb.StringValue)
+	if err := proto.Unmarshal(ctx.Response.Body(), value); err != nil || value.Value != "hello" ||
+		string(ctx.Response.Header.ContentType()) != CONTENT_TYPE_PROTOBUF {
+		t.Fatal(value, err)
+	}
+	ctx = do("/proto", "application/json")
+	if string(ctx.Response.Header.ContentType()) != CONTENT_TYPE_JSON {
+		t.Fatal(string(ctx.Response.Body()))
+	}
+}
+
+func TestJSONEncoderCasing(t *testing.T) {
+	type user struct {
+		UserID   int
+		HTTPPort int
+		Name     string `json:"full_name"`
+	}
+	var buf bytes.Buffer
+	NewJSONEncoder(&JSONEncoderOptions{Casing: CASING_SNAKE}).Encode(&buf, &user{1, 2, "a"})
+	if buf.String() != `{"user_id":1,"http_port":2,"full_name":"a"}` {
+		t.Fatal(buf.String())
+	}
+	buf.Reset()
+	NewJSONEncoder(&JSONEncoderOptions{Casing: CASING_CAMEL}).Encode(&buf, &user{1, 2, "a"})
+	if buf.String() != `{"userID":1,"httpPort":2,"full_name":"a"}` {
+		t.Fatal(buf.String())
+	}
+	buf.Reset()
+	NewJSONEncoder(&JSONEncoderOptions{Fast: true}).Encode(&buf, map[string]string{"b": "<", "a": ""})
+	if buf.String() != `{"a":"","b":"\u003c"}` {
+		t.Fatal(buf.String())
+	}
+}
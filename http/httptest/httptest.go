@@ -0,0 +1,277 @@
+// Package httptest 在内存中运行Router, 用于测试控制器和中间件
+package httptest
+
+import (
+	"encoding/json"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/lxf9601/go-common/http"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+)
+
+// 测试服务配置
+type Options struct {
+	AppPath   string            // 应用路径, 用于静态文件和模板
+	JWTSecret string            // JWT密钥, Request.Auth据此签发令牌
+	Headers   map[string]string // 每个请求默认携带的请求头
+	Timeout   time.Duration     // 单个请求超时, 默认10秒
+}
+
+// 内存中的测试服务
+type Server struct {
+	options *Options
+	ln      *fasthttputil.InmemoryListener
+	client  *fasthttp.HostClient
+	done    chan struct{}
+}
+
+// NewServer 启动测试服务, Router的中间件须在此之前注册, options可为空
+func NewServer(router *http.Router, options *Options) *Server {
+	opts := Options{}
+	if options != nil {
+		opts = *options
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	ln := fasthttputil.NewInmemoryListener()
+	server := &Server{options: &opts, ln: ln, done: make(chan struct{})}
+	server.client = &fasthttp.HostClient{
+		Addr: "test",
+		Dial: func(addr string) (net.Conn, error) {
+			return ln.Dial()
+		},
+	}
+	go func() {
+		defer close(server.done)
+		fasthttp.Serve(ln, http.HttpHandler(opts.AppPath, router))
+	}()
+	return server
+}
+
+// Close 停止测试服务
+func (this *Server) Close() {
+	this.ln.Close()
+	<-this.done
+}
+
+// NewRequest 创建请求, path可包含查询参数
+func (this *Server) NewRequest(method string, path string) *Request {
+	req := &Request{server: this, req: new(fasthttp.Request), query: make(url.Values), form: make(url.Values)}
+	req.req.Header.SetMethod(method)
+	req.req.SetRequestURI("http://test" + path)
+	for k, v := range this.options.Headers {
+		req.req.Header.Set(k, v)
+	}
+	return req
+}
+
+func (this *Server) Get(path string) *Request {
+	return this.NewRequest(fasthttp.MethodGet, path)
+}
+
+func (this *Server) Post(path string) *Request {
+	return this.NewRequest(fasthttp.MethodPost, path)
+}
+
+func (this *Server) Put(path string) *Request {
+	return this.NewRequest(fasthttp.MethodPut, path)
+}
+
+func (this *Server) Delete(path string) *Request {
+	return this.NewRequest(fasthttp.MethodDelete, path)
+}
+
+// 测试请求, 通过链式调用设置参数
+type Request struct {
+	server *Server
+	req    *fasthttp.Request
+	query  url.Values
+	form   url.Values
+	err    error
+}
+
+// Query 添加查询参数
+func (this *Request) Query(key string, value string) *Request {
+	this.query.Add(key, value)
+	return this
+}
+
+// Header 设置请求头
+func (this *Request) Header(key string, value string) *Request {
+	this.req.Header.Set(key, value)
+	return this
+}
+
+// Cookie 设置Cookie
+func (this *Request) Cookie(key string, value string) *Request {
+	this.req.Header.SetCookie(key, value)
+	return this
+}
+
+// Form 添加表单字段, 以application/x-www-form-urlencoded提交
+func (this *Request) Form(key string, value string) *Request {
+	this.form.Add(key, value)
+	return this
+}
+
+// JSON 以JSON作为请求体
+func (this *Request) JSON(v interface{}) *Request {
+	j, err := json.Marshal(v)
+	if err != nil {
+		this.err = err
+		return this
+	}
+	return this.Body("application/json", j)
+}
+
+// Body 设置原始请求体
+func (this *Request) Body(contentType string, body []byte) *Request {
+	this.req.Header.SetContentType(contentType)
+	this.req.SetBody(body)
+	return this
+}
+
+// Bearer 设置Authorization: Bearer令牌
+func (this *Request) Bearer(token string) *Request {
+	return this.Header("Authorization", "Bearer "+token)
+}
+
+// Auth 使用Options.JWTSecret签发令牌, 用于通过comm.JWTParse校验Bearer令牌的路由
+func (this *Request) Auth(claims jwt.MapClaims) *Request {
+	signed := jwt.MapClaims{"exp": time.Now().Add(time.Hour).Unix()}
+	for k, v := range claims {
+		signed[k] = v
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, signed).SignedString([]byte(this.server.options.JWTSecret))
+	if err != nil {
+		this.err = err
+		return this
+	}
+	return this.Bearer(token)
+}
+
+// Login 设置登录Cookie, 用于IsAuth路由
+func (this *Request) Login(userName string) *Request {
+	return this.Cookie("user_name", userName)
+}
+
+// Do 发送请求, 错误记录在Response.Err中
+func (this *Request) Do() *Response {
+	if this.err != nil {
+		return &Response{Err: this.err}
+	}
+	args := this.req.URI().QueryArgs()
+	for k, vs := range this.query {
+		for _, v := range vs {
+			args.Add(k, v)
+		}
+	}
+	if len(this.form) > 0 {
+		this.req.Header.SetContentType("application/x-www-form-urlencoded")
+		this.req.SetBodyString(this.form.Encode())
+	}
+	resp := new(fasthttp.Response)
+	if err := this.server.client.DoTimeout(this.req, resp, this.server.options.Timeout); err != nil {
+		return &Response{Err: err}
+	}
+	return &Response{StatusCode: resp.StatusCode(), Body: resp.Body(), raw: resp}
+}
+
+// 测试响应
+type Response struct {
+	StatusCode int
+	Body       []byte
+	Err        error
+	raw        *fasthttp.Response
+}
+
+// Header 获取响应头
+func (this *Response) Header(key string) string {
+	if this.raw == nil {
+		return ""
+	}
+	return string(this.raw.Header.Peek(key))
+}
+
+// Cookie 获取响应设置的Cookie值
+func (this *Response) Cookie(key string) string {
+	if this.raw == nil {
+		return ""
+	}
+	cookie := fasthttp.AcquireCookie()
+	defer fasthttp.ReleaseCookie(cookie)
+	cookie.SetKey(key)
+	if !this.raw.Header.Cookie(cookie) {
+		return ""
+	}
+	return string(cookie.Value())
+}
+
+// JSON 将响应体解码到v
+func (this *Response) JSON(v interface{}) error {
+	if this.Err != nil {
+		return this.Err
+	}
+	return json.Unmarshal(this.Body, v)
+}
+
+// ApiResponse 解码ApiResponse, data不为空时将Data解码到data
+func (this *Response) ApiResponse(data interface{}) (*http.ApiResponse, error) {
+	res := new(struct {
+		Ret  int             `json:"ret"`
+		Msg  string          `json:"msg"`
+		Data json.RawMessage `json:"data"`
+	})
+	if err := this.JSON(res); err != nil {
+		return nil, err
+	}
+	apiResponse := &http.ApiResponse{Ret: res.Ret, Msg: res.Msg, Data: res.Data}
+	if data != nil && len(res.Data) > 0 {
+		if err := json.Unmarshal(res.Data, data); err != nil {
+			return nil, err
+		}
+		apiResponse.Data = data
+	}
+	return apiResponse, nil
+}
+
+// AssertStatus 断言状态码
+func (this *Response) AssertStatus(t testing.TB, status int) *Response {
+	t.Helper()
+	if this.Err != nil {
+		t.Fatalf("request failed: %s", this.Err)
+	}
+	if this.StatusCode != status {
+		t.Fatalf("status %d, expect %d: %s", this.StatusCode, status, this.Body)
+	}
+	return this
+}
+
+// AssertHeader 断言响应头
+func (this *Response) AssertHeader(t testing.TB, key string, value string) *Response {
+	t.Helper()
+	if this.Header(key) != value {
+		t.Fatalf("header %s is %q, expect %q", key, this.Header(key), value)
+	}
+	return this
+}
+
+// AssertRet 断言ApiResponse.Ret, data不为空时解码Data
+func (this *Response) AssertRet(t testing.TB, ret int, data interface{}) *http.ApiResponse {
+	t.Helper()
+	res, err := this.ApiResponse(data)
+	if err != nil {
+		t.Fatalf("decode ApiResponse: %s: %s", err, this.Body)
+	}
+	if res.Ret != ret {
+		t.Fatalf("ret %d, expect %d: %s", res.Ret, ret, res.Msg)
+	}
+	return res
+}
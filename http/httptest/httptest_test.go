@@ -0,0 +1,56 @@
+package httptest
+
+import (
+	"strings"
+	"testing"
+
+	comm "github.com/lxf9601/go-common"
+	"github.com/lxf9601/go-common/http"
+)
+
+type testController struct {
+	http.Controller
+}
+
+func (this *testController) Echo(ctx *http.HttpContext) *http.ApiResponse {
+	return this.Success(map[string]string{
+		"q":      ctx.FormString("q"),
+		"name":   ctx.FormString("name"),
+		"sub":    ctx.ClaimString("sub"),
+		"header": string(ctx.RawCtx.Request.Header.Peek("X-Test")),
+		"cookie": string(ctx.RawCtx.Request.Header.Cookie("c")),
+	})
+}
+
+func TestServer(t *testing.T) {
+	router := new(http.Router)
+	router.Init()
+	var controller interface{} = &testController{}
+	router.Group("/api", nil, func(group *http.RouterGroup) {
+		group.Use(func(next http.HandlerFunc) http.HandlerFunc {
+			return func(c *http.HttpContext) {
+				token := strings.TrimPrefix(string(c.RawCtx.Request.Header.Peek("Authorization")), "Bearer ")
+				claims, err := comm.JWTParse(token, "secret")
+				if err != nil || claims == nil {
+					c.RawCtx.SetStatusCode(401)
+					return
+				}
+				c.SetClaims(claims)
+				next(c)
+			}
+		})
+		group.Post("/echo", &controller, "Echo")
+	})
+	server := NewServer(router, &Options{JWTSecret: "secret", Headers: map[string]string{"X-Test": "1"}})
+	defer server.Close()
+
+	server.Post("/api/echo").Do().AssertStatus(t, 401)
+
+	data := make(map[string]string)
+	server.Post("/api/echo").Query("q", "a b").Form("name", "n").Cookie("c", "v").
+		Auth(map[string]interface{}{"sub": "u1"}).Do().
+		AssertStatus(t, 200).AssertHeader(t, "Content-Type", http.CONTENT_TYPE_JSON).AssertRet(t, 0, &data)
+	if data["q"] != "a b" || data["name"] != "n" || data["sub"] != "u1" || data["header"] != "1" || data["cookie"] != "v" {
+		t.Fatal(data)
+	}
+}
@@ -0,0 +1,47 @@
+package http
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/lxf9601/go-common/metrics"
+)
+
+// 未匹配路由时的route标签, 避免按原始路径产生过多序列
+const unmatchedRoute = "unmatched"
+
+// Metrics HTTP指标中间件, 按路由、方法及状态码统计请求数和耗时
+func Metrics(registry *metrics.Registry) Middleware {
+	requests := registry.NewCounter("http_requests_total",
+		"Total number of HTTP requests.", "method", "route", "status")
+	duration := registry.NewHistogram("http_request_duration_seconds",
+		"HTTP request latency in seconds.", nil, "method", "route", "status")
+	inFlight := registry.NewGauge("http_requests_in_flight",
+		"Number of HTTP requests being served.")
+	return func(next HandlerFunc) HandlerFunc {
+		return func(c *HttpContext) {
+			start := time.Now()
+			inFlight.Inc()
+			defer inFlight.Dec()
+			next(c)
+			route := c.RoutePattern()
+			if route == "" {
+				route = unmatchedRoute
+			}
+			method := string(c.RawCtx.Method())
+			status := strconv.Itoa(c.response().StatusCode())
+			requests.Inc(method, route, status)
+			duration.Observe(time.Since(start).Seconds(), method, route, status)
+		}
+	}
+}
+
+// MetricsHandler 以Prometheus文本格式输出指标, 可通过Router.HandleFunc挂载到/metrics
+func MetricsHandler(registry *metrics.Registry) HandlerFunc {
+	return func(c *HttpContext) {
+		c.SetContentType(metrics.CONTENT_TYPE)
+		if err := registry.WritePrometheus(c.RawCtx.Response.BodyWriter()); err != nil {
+			c.Logger().Errorf("write metrics: %s", err)
+		}
+	}
+}
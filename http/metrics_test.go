@@ -0,0 +1,47 @@
+package http
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lxf9601/go-common/metrics"
+	"github.com/valyala/fasthttp"
+)
+
+func TestMetricsScrape(t *testing.T) {
+	registry := metrics.NewRegistry()
+	router := new(Router)
+	router.Init()
+	router.Use(Metrics(registry))
+	router.HandleFunc("/user/info", func(c *HttpContext) {
+		c.RawCtx.SetStatusCode(201)
+	})
+	router.HandleFunc("/metrics", MetricsHandler(registry))
+	handler := HttpHandler("", router)
+
+	do := func(uri string) *fasthttp.RequestCtx {
+		req := fasthttp.AcquireRequest()
+		req.SetRequestURI(uri)
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Init(req, nil, nil)
+		handler(ctx)
+		return ctx
+	}
+	do("/user/info")
+	do("/user/info")
+	ctx := do("/metrics")
+	if string(ctx.Response.Header.ContentType()) != metrics.CONTENT_TYPE {
+		t.Fatal(string(ctx.Response.Header.ContentType()))
+	}
+	body := string(ctx.Response.Body())
+	for _, line := range []string{
+		`http_requests_total{method="GET",route="/user/info",status="201"} 2`,
+		`http_request_duration_seconds_count{method="GET",route="/user/info",status="201"} 2`,
+		`# TYPE http_requests_in_flight gauge`,
+		`http_requests_in_flight 1`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("missing %q in:\n%s", line, body)
+		}
+	}
+}
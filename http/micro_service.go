@@ -1,55 +1,553 @@
 package http
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
-	"strconv"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/lxf9601/go-common/logc"
+	"github.com/lxf9601/go-common/trace"
 	"github.com/valyala/fasthttp"
 )
 
+const (
+	defaultMicroSrvTimeout = 60 * time.Second
+	HEADER_IDEMPOTENCY_KEY = "Idempotency-Key"
+)
+
+// 业务错误, 接口正常返回但ApiResponse.Ret不为0
+type ApiError struct {
+	Ret int
+	Msg string
+}
+
+func (this *ApiError) Error() string {
+	return fmt.Sprintf("api error %d: %s", this.Ret, this.Msg)
+}
+
+// 状态码错误, 接口返回非2xx状态码
+type StatusError struct {
+	StatusCode int
+	Url        string
+	Body       []byte
+	RetryAfter time.Duration // Retry-After响应头, 未设置为0
+}
+
+func (this *StatusError) Error() string {
+	body := this.Body
+	if len(body) > 256 {
+		body = body[:256]
+	}
+	return fmt.Sprintf("http %s status %d: %s", this.Url, this.StatusCode, body)
+}
+
 // 微服务API
 type MicroSrvApi struct {
-	client fasthttp.Client // http客户端
-	Url    string          // 服务接口地址
+	client        fasthttp.Client   // http客户端
+	Url           string            // 服务接口地址
+	Timeout       time.Duration     // 默认请求超时
+	Headers       map[string]string // 每个请求携带的请求头
+	retry         *RetryOptions
+	breaker       *BreakerOptions
+	maxConcurrent int
+	bulkheadWait  time.Duration
+	balancer      *balancer
+	cache         *responseCache
+	signer        *SignerOptions
+	err           error // 配置错误, 如TLS证书加载失败, 每次请求时返回
+	guards        map[string]*hostGuard
+	guardsLock    sync.Mutex
 }
 
 type MicroSrvApiOptions struct {
-	Url string // 服务接口地址
+	Url           string            // 服务接口地址, 设置Endpoints或Discovery时不使用
+	Endpoints     []string          // 多个服务实例地址, 客户端负载均衡
+	Discovery     Discovery         // 服务发现, 优先于Endpoints
+	Balance       int               // 负载均衡策略, 默认轮询
+	Ejection      *EjectionOptions  // 被动健康检查配置, 为空使用默认值
+	Timeout       time.Duration     // 默认请求超时, 默认60秒
+	Headers       map[string]string // 每个请求携带的请求头, 如服务间鉴权
+	Retry         *RetryOptions     // 重试配置, 为空不重试
+	Breaker       *BreakerOptions   // 熔断配置, 按主机熔断, 为空不熔断
+	MaxConcurrent int               // 每个主机同时进行的最大请求数, 0不限制
+	BulkheadWait  time.Duration     // 达到最大请求数时的等待时间, 0直接返回ErrBulkheadFull
+	Signer        *SignerOptions    // 请求签名密钥, 为空不签名
+	TLS           *TLSOptions       // https时的TLS配置, 设置CertFile时启用双向TLS
+	Cache         *CacheOptions     // GET响应缓存, 为空不缓存
+}
+
+// 单个主机的熔断器和舱壁
+type hostGuard struct {
+	breaker  *CircuitBreaker
+	bulkhead *bulkhead
 }
 
 func NewMicroSrvApi(options *MicroSrvApiOptions) *MicroSrvApi {
-	api := &MicroSrvApi{client: fasthttp.Client{}, Url: options.Url}
+	api := &MicroSrvApi{client: fasthttp.Client{}, Url: options.Url, Timeout: options.Timeout, Headers: options.Headers,
+		retry: normalizeRetryOptions(options.Retry), breaker: options.Breaker,
+		maxConcurrent: options.MaxConcurrent, bulkheadWait: options.BulkheadWait, signer: options.Signer,
+		guards: make(map[string]*hostGuard)}
+	if api.Timeout <= 0 {
+		api.Timeout = defaultMicroSrvTimeout
+	}
+	if options.TLS != nil {
+		config, err := options.TLS.ClientConfig()
+		if err != nil {
+			logc.Errorf("micro service tls: %s", err)
+			api.err = err
+		}
+		api.client.TLSConfig = config
+	}
+	if options.Cache != nil {
+		namespace := options.Url
+		if options.Discovery != nil {
+			// 服务发现的地址会变化, 无法作为缓存键前缀
+			namespace = ""
+		} else if len(options.Endpoints) > 0 {
+			endpoints := append([]string(nil), options.Endpoints...)
+			sort.Strings(endpoints)
+			namespace = strings.Join(endpoints, ",")
+		}
+		if options.Cache.Namespace == "" && namespace == "" {
+			logc.Error(errCacheNamespace)
+			api.err = errCacheNamespace
+		} else {
+			api.cache = newResponseCache(options.Cache, namespace)
+		}
+	}
+	discovery := options.Discovery
+	if discovery == nil && len(options.Endpoints) > 0 {
+		discovery = StaticDiscovery(options.Endpoints)
+	}
+	if discovery != nil {
+		api.balancer = newBalancer(discovery, options.Balance, options.Ejection, api.available)
+		api.balancer.removed = api.removeGuards
+	}
 	return api
 }
 
-// Get 获取资源
-func (this *MicroSrvApi) Get(uri string) (*ApiResponse, error) {
+// available 主机的熔断器未打开
+func (this *MicroSrvApi) available(host string) bool {
+	breaker := this.guard(host).breaker
+	return breaker == nil || breaker.State() != BREAKER_OPEN
+}
+
+// removeGuards 移除已下线主机的熔断器和舱壁
+func (this *MicroSrvApi) removeGuards(hosts []string) {
+	this.guardsLock.Lock()
+	defer this.guardsLock.Unlock()
+	for _, host := range hosts {
+		delete(this.guards, host)
+	}
+}
+
+// Breaker 获取主机的熔断器, 未配置熔断时返回nil
+func (this *MicroSrvApi) Breaker(host string) *CircuitBreaker {
+	return this.guard(host).breaker
+}
+
+// guard 获取或创建主机的熔断器和舱壁
+func (this *MicroSrvApi) guard(host string) *hostGuard {
+	this.guardsLock.Lock()
+	defer this.guardsLock.Unlock()
+	if this.guards == nil {
+		this.guards = make(map[string]*hostGuard)
+	}
+	guard, ok := this.guards[host]
+	if !ok {
+		guard = &hostGuard{bulkhead: newBulkhead(this.maxConcurrent, this.bulkheadWait)}
+		if this.breaker != nil {
+			guard.breaker = NewCircuitBreaker(host, this.breaker)
+		}
+		this.guards[host] = guard
+	}
+	return guard
+}
+
+// 微服务请求, 通过链式调用设置参数
+type ApiRequest struct {
+	api         *MicroSrvApi
+	method      string
+	uri         string
+	query       url.Values
+	header      map[string]string
+	body        []byte
+	contentType string
+	timeout     time.Duration
+	idempotent  bool
+	hashKey     string
+	noCache     bool
+	revalidate  *CachedResponse // 再验证的缓存, 发送条件请求头
+	err         error
+}
+
+// NewRequest 创建请求, uri为相对服务接口地址的路径
+func (this *MicroSrvApi) NewRequest(method string, uri string) *ApiRequest {
+	return &ApiRequest{api: this, method: method, uri: uri, query: make(url.Values), header: make(map[string]string)}
+}
+
+// Query 添加查询参数
+func (this *ApiRequest) Query(key string, value string) *ApiRequest {
+	this.query.Add(key, value)
+	return this
+}
+
+// Header 设置请求头
+func (this *ApiRequest) Header(key string, value string) *ApiRequest {
+	this.header[key] = value
+	return this
+}
+
+// Timeout 设置本次请求超时, 不超过ctx的截止时间
+func (this *ApiRequest) Timeout(timeout time.Duration) *ApiRequest {
+	this.timeout = timeout
+	return this
+}
+
+// Idempotent 标记请求幂等, 失败时允许重试, key不为空时设置Idempotency-Key请求头
+func (this *ApiRequest) Idempotent(key string) *ApiRequest {
+	this.idempotent = true
+	if key != "" {
+		this.header[HEADER_IDEMPOTENCY_KEY] = key
+	}
+	return this
+}
+
+// NoCache 不使用缓存的响应, 响应仍会更新缓存
+func (this *ApiRequest) NoCache() *ApiRequest {
+	this.noCache = true
+	return this
+}
+
+// HashKey 设置一致性哈希的键, 默认为请求路径
+func (this *ApiRequest) HashKey(key string) *ApiRequest {
+	this.hashKey = key
+	return this
+}
+
+// JSON 以JSON作为请求体
+func (this *ApiRequest) JSON(v interface{}) *ApiRequest {
+	j, err := json.Marshal(v)
+	if err != nil {
+		this.err = err
+		return this
+	}
+	return this.Body("application/json", j)
+}
+
+// Form 以表单作为请求体
+func (this *ApiRequest) Form(form url.Values) *ApiRequest {
+	return this.Body("application/x-www-form-urlencoded", []byte(form.Encode()))
+}
+
+// Body 设置原始请求体
+func (this *ApiRequest) Body(contentType string, body []byte) *ApiRequest {
+	this.contentType = contentType
+	this.body = body
+	return this
+}
+
+// joinUrl 拼接服务地址、路径和查询参数
+func joinUrl(base string, uri string, query url.Values) string {
+	reqUri := base + uri
+	if len(query) > 0 {
+		if strings.Contains(reqUri, "?") {
+			reqUri += "&" + query.Encode()
+		} else {
+			reqUri += "?" + query.Encode()
+		}
+	}
+	return reqUri
+}
+
+// Do 发送请求并将ApiResponse.Data解码到out, out为空时Data保持原始JSON
+// 网络错误和非2xx状态码返回传输错误(StatusError), Ret不为0时同时返回带Data的响应和*ApiError
+// 配置重试时, 幂等请求遇到网络错误或指定状态码按指数退避重试
+func (this *ApiRequest) Do(ctx context.Context, out interface{}) (*ApiResponse, error) {
+	if this.err != nil {
+		return nil, this.err
+	}
+	if this.api.err != nil {
+		return nil, this.api.err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var body []byte
+	var reqUri string
+	var err error
+	if this.api.cache != nil && this.method == fasthttp.MethodGet {
+		body, reqUri, err = this.api.cache.do(ctx, this)
+	} else {
+		var resp *upstreamResponse
+		if resp, reqUri, err = this.execute(ctx); err == nil {
+			body = resp.body
+		}
+	}
+	if err != nil {
+		logc.WithContext(ctx).Errorf("http %s %s: %s", this.method, reqUri, err)
+		return nil, err
+	}
+	raw := new(struct {
+		Ret  int             `json:"ret"`
+		Msg  string          `json:"msg"`
+		Data json.RawMessage `json:"data"`
+	})
+	if err := json.Unmarshal(body, raw); err != nil {
+		logc.WithContext(ctx).Errorf("http %s %s decode: %s: %s", this.method, reqUri, err, body)
+		return nil, fmt.Errorf("http %s decode: %s: %s", reqUri, err, body)
+	}
+	response := &ApiResponse{Ret: raw.Ret, Msg: raw.Msg}
+	if out == nil {
+		response.Data = raw.Data
+	} else {
+		response.Data = out
+		if len(raw.Data) > 0 && !bytes.Equal(raw.Data, []byte("null")) {
+			if err := json.Unmarshal(raw.Data, out); err != nil {
+				if raw.Ret == 0 {
+					logc.WithContext(ctx).Errorf("http %s %s decode data: %s", this.method, reqUri, err)
+					return nil, fmt.Errorf("http %s decode data: %s", reqUri, err)
+				}
+				// 业务错误的Data结构可能与成功时不同, 无法解码时保留原始JSON
+				response.Data = raw.Data
+			}
+		}
+	}
+	if raw.Ret != 0 {
+		return response, &ApiError{Ret: raw.Ret, Msg: raw.Msg}
+	}
+	return response, nil
+}
+
+// 上游响应
+type upstreamResponse struct {
+	body         []byte
+	notModified  bool // 再验证时返回304
+	cacheControl string
+	etag         string
+	lastModified string
+	age          string
+}
+
+// execute 按重试配置发送请求, 返回2xx响应和最后一次请求的地址
+func (this *ApiRequest) execute(ctx context.Context) (*upstreamResponse, string, error) {
+	retry := this.api.retry
+	attempts := 1
+	if retry != nil && (this.idempotent || retry.RetryNonIdempotent || idempotentMethod(this.method)) {
+		attempts = retry.MaxAttempts
+	}
+	var resp *upstreamResponse
+	var reqUri string
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			if e := sleepContext(ctx, retry.backoff(attempt-1, err)); e != nil {
+				return nil, reqUri, e
+			}
+		}
+		resp, reqUri, err = this.attempt(ctx)
+		if err == nil || attempt == attempts {
+			break
+		}
+		// 多实例时熔断的实例会被跳过, 重试可能选到其他实例
+		if !retry.retryable(err) && !(err == ErrCircuitOpen && this.api.balancer != nil) {
+			break
+		}
+		logc.WithContext(ctx).Warnf("http %s %s: %s, retry %d/%d", this.method, reqUri, err, attempt, attempts-1)
+	}
+	return resp, reqUri, err
+}
+
+// attempt 选择实例, 经过舱壁和熔断器发送一次请求
+func (this *ApiRequest) attempt(ctx context.Context) (resp *upstreamResponse, reqUri string, err error) {
+	base := this.api.Url
+	if this.api.balancer != nil {
+		key := this.hashKey
+		if key == "" {
+			key = this.uri
+		}
+		var e *endpoint
+		if e, err = this.api.balancer.pick(key); err != nil {
+			return nil, joinUrl("", this.uri, this.query), err
+		}
+		base = e.url
+		defer func() { this.api.balancer.done(e, requestFailure(err)) }()
+	}
+	reqUri = joinUrl(base, this.uri, this.query)
+	guard := this.api.guard(requestHost(reqUri))
+	release, err := guard.bulkhead.acquire(ctx)
+	if err != nil {
+		return nil, reqUri, err
+	}
+	defer release()
+	if guard.breaker != nil {
+		if err = guard.breaker.Allow(); err != nil {
+			return nil, reqUri, err
+		}
+	}
+	resp, err = this.roundTrip(ctx, reqUri)
+	if guard.breaker != nil {
+		guard.breaker.Done(!requestFailure(err))
+	}
+	return resp, reqUri, err
+}
+
+// requestFailure 网络错误和5xx计为失败, 4xx、调用方取消以及熔断和舱壁拒绝不计
+func requestFailure(err error) bool {
+	switch e := err.(type) {
+	case nil:
+		return false
+	case *StatusError:
+		return e.StatusCode >= 500
+	}
+	switch err {
+	case context.Canceled, ErrCircuitOpen, ErrBulkheadFull:
+		return false
+	}
+	return true
+}
+
+// requestHost 请求地址的主机, 作为熔断和舱壁的键
+func requestHost(reqUri string) string {
+	if u, err := url.Parse(reqUri); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return reqUri
+}
+
+// roundTrip 发送一次请求, 非2xx状态码返回StatusError, 再验证缓存时304不视为错误
+// ctx中有链路上下文时创建客户端Span并写入traceparent请求头
+func (this *ApiRequest) roundTrip(ctx context.Context, reqUri string) (resp *upstreamResponse, err error) {
+	status := 0
+	if trace.SpanContextFromContext(ctx).IsValid() {
+		var span *trace.Span
+		ctx, span = trace.Start(ctx, this.method+" "+this.uri, trace.SPAN_KIND_CLIENT)
+		span.SetAttribute("http.method", this.method)
+		span.SetAttribute("http.url", reqUri)
+		defer func() {
+			if status > 0 {
+				span.SetAttribute("http.status_code", status)
+			}
+			span.SetError(err)
+			span.End()
+		}()
+	}
 	req := fasthttp.AcquireRequest()
 	rep := fasthttp.AcquireResponse()
 	defer fasthttp.ReleaseRequest(req)
 	defer fasthttp.ReleaseResponse(rep)
-	req.Header.SetMethodBytes([]byte("GET"))
-	reqUri := this.Url + uri
-	req.Header.SetRequestURI(reqUri)
-	err := this.client.DoTimeout(req, rep, 60*time.Second)
+	req.Header.SetMethod(this.method)
+	req.SetRequestURI(reqUri)
+	for k, v := range this.api.Headers {
+		req.Header.Set(k, v)
+	}
+	for k, v := range this.header {
+		req.Header.Set(k, v)
+	}
+	if requestId := RequestIDFromContext(ctx); requestId != "" {
+		req.Header.Set(HEADER_REQUEST_ID, requestId)
+	}
+	trace.Inject(ctx, req.Header.Set)
+	if this.body != nil {
+		req.Header.SetContentType(this.contentType)
+		req.SetBody(this.body)
+	}
+	if cached := this.revalidate; cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+	if signer := this.api.signer; signer != nil {
+		SignRequest(req, signer.KeyID, signer.Secret)
+	}
+	timeout := this.timeout
+	if timeout <= 0 {
+		timeout = this.api.Timeout
+	}
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	err = this.api.client.DoDeadline(req, rep, deadline)
+	if err == fasthttp.ErrTimeout && ctx.Err() != nil {
+		err = ctx.Err()
+	}
 	if err != nil {
-		logc.Error(err)
 		return nil, err
 	}
-	if rep.StatusCode() != 200 {
-		err := "http " + reqUri + "error:" + strconv.Itoa(rep.StatusCode())
-		logc.Error(err)
-		return nil, errors.New(err)
+	status = rep.StatusCode()
+	resp = &upstreamResponse{
+		body:         append([]byte(nil), rep.Body()...),
+		cacheControl: string(rep.Header.Peek("Cache-Control")),
+		etag:         string(rep.Header.Peek("ETag")),
+		lastModified: string(rep.Header.Peek("Last-Modified")),
+		age:          string(rep.Header.Peek("Age")),
 	}
-	response := new(ApiResponse)
-	err = json.Unmarshal(rep.Body(), response)
-	if err != nil {
-		err := "http " + reqUri + "error:" + string(rep.Body())
-		logc.Error(err)
-		return nil, errors.New(err)
+	if status == fasthttp.StatusNotModified && this.revalidate != nil {
+		resp.notModified = true
+		return resp, nil
+	}
+	if status < 200 || status >= 300 {
+		return nil, &StatusError{StatusCode: status, Url: reqUri, Body: resp.body,
+			RetryAfter: parseRetryAfter(rep.Header.Peek("Retry-After"))}
+	}
+	return resp, nil
+}
+
+// Get 获取资源, Data解码为interface{}, Ret不为0时不返回错误
+func (this *MicroSrvApi) Get(uri string) (*ApiResponse, error) {
+	return this.GetContext(context.Background(), uri)
+}
+
+// GetContext 获取资源, 使用ctx的截止时间并传递请求ID
+func (this *MicroSrvApi) GetContext(ctx context.Context, uri string) (*ApiResponse, error) {
+	var data interface{}
+	response, err := this.NewRequest(fasthttp.MethodGet, uri).Do(ctx, &data)
+	if _, ok := err.(*ApiError); !ok && err != nil {
+		return nil, err
 	}
+	response.Data = data
 	return response, nil
 }
+
+// Post 提交资源, body为url.Values时以表单提交, 其他以JSON提交, Data解码到out
+func (this *MicroSrvApi) Post(ctx context.Context, uri string, body interface{}, out interface{}) error {
+	return this.send(ctx, fasthttp.MethodPost, uri, body, out)
+}
+
+// Put 替换资源
+func (this *MicroSrvApi) Put(ctx context.Context, uri string, body interface{}, out interface{}) error {
+	return this.send(ctx, fasthttp.MethodPut, uri, body, out)
+}
+
+// Patch 修改资源
+func (this *MicroSrvApi) Patch(ctx context.Context, uri string, body interface{}, out interface{}) error {
+	return this.send(ctx, fasthttp.MethodPatch, uri, body, out)
+}
+
+// Delete 删除资源
+func (this *MicroSrvApi) Delete(ctx context.Context, uri string, out interface{}) error {
+	return this.send(ctx, fasthttp.MethodDelete, uri, nil, out)
+}
+
+func (this *MicroSrvApi) send(ctx context.Context, method string, uri string, body interface{}, out interface{}) error {
+	req := this.NewRequest(method, uri)
+	switch v := body.(type) {
+	case nil:
+	case url.Values:
+		req.Form(v)
+	default:
+		req.JSON(v)
+	}
+	_, err := req.Do(ctx, out)
+	return err
+}
@@ -0,0 +1,96 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+type microSrvTestUser struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func newMicroSrvTestApi(t *testing.T, handler fasthttp.RequestHandler) (*MicroSrvApi, func()) {
+	dial, closeFn := newTestServer(handler)
+	api := NewMicroSrvApi(&MicroSrvApiOptions{Url: "http://user-service/api", Headers: map[string]string{"X-Token": "t"}})
+	api.client.Dial = dial
+	return api, closeFn
+}
+
+func TestMicroSrvApi(t *testing.T) {
+	api, closeFn := newMicroSrvTestApi(t, func(ctx *fasthttp.RequestCtx) {
+		switch string(ctx.Path()) {
+		case "/api/user":
+			if string(ctx.Request.Header.Peek("X-Token")) != "t" || string(ctx.QueryArgs().Peek("id")) != "1" ||
+				string(ctx.Request.Header.Peek(HEADER_REQUEST_ID)) != "req-1" {
+				ctx.SetStatusCode(400)
+				return
+			}
+			ctx.SetBodyString(`{"ret":0,"msg":"","data":{"id":1,"name":"a"}}`)
+		case "/api/user/save":
+			if string(ctx.Method()) != "PUT" || string(ctx.PostBody()) != `{"id":2,"name":"b"}` {
+				ctx.SetStatusCode(400)
+				return
+			}
+			ctx.SetBodyString(`{"ret":0,"msg":"","data":null}`)
+		case "/api/user/form":
+			ctx.SetBodyString(`{"ret":0,"msg":"","data":"` + string(ctx.PostArgs().Peek("name")) + `"}`)
+		case "/api/fail":
+			ctx.SetBodyString(`{"ret":1001,"msg":"user not found","data":{"id":"x"}}`)
+		case "/api/slow":
+			time.Sleep(200 * time.Millisecond)
+		default:
+			ctx.SetStatusCode(502)
+			ctx.SetBodyString("bad gateway")
+		}
+	})
+	defer closeFn()
+
+	ctx := (&HttpContext{RawCtx: new(fasthttp.RequestCtx), requestId: "req-1"}).Context()
+	user := new(microSrvTestUser)
+	res, err := api.NewRequest("GET", "/user").Query("id", "1").Do(ctx, user)
+	if err != nil || res.Data != user || user.Name != "a" {
+		t.Fatal(res, err)
+	}
+	if err := api.Put(context.Background(), "/user/save", &microSrvTestUser{Id: 2, Name: "b"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	var name string
+	if err := api.Post(context.Background(), "/user/form", url.Values{"name": {"c"}}, &name); err != nil || name != "c" {
+		t.Fatal(name, err)
+	}
+
+	err = api.Delete(context.Background(), "/fail", nil)
+	apiErr := new(ApiError)
+	if !errors.As(err, &apiErr) || apiErr.Ret != 1001 || apiErr.Msg != "user not found" {
+		t.Fatal(err)
+	}
+	if res, err := api.Get("/fail"); err != nil || res.Ret != 1001 || res.Data.(map[string]interface{})["id"] != "x" {
+		t.Fatal(res, err)
+	}
+	// 业务错误的Data无法解码到out时保留原始JSON
+	res, err = api.NewRequest("GET", "/fail").Do(context.Background(), user)
+	if !errors.As(err, &apiErr) || res == nil || string(res.Data.(json.RawMessage)) != `{"id":"x"}` {
+		t.Fatal(res, err)
+	}
+	_, err = api.NewRequest("GET", "/missing").Do(context.Background(), nil)
+	statusErr := new(StatusError)
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != 502 || string(statusErr.Body) != "bad gateway" {
+		t.Fatal(err)
+	}
+	timeoutCtx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := api.NewRequest("GET", "/slow").Do(timeoutCtx, nil); err != context.DeadlineExceeded {
+		t.Fatal(err)
+	}
+	if _, err := api.NewRequest("GET", "/slow").Timeout(50*time.Millisecond).Do(context.Background(), nil); err != fasthttp.ErrTimeout {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,31 @@
+package http
+
+// HandlerFunc 请求处理函数
+type HandlerFunc func(ctx *HttpContext)
+
+// Middleware 中间件, 包装下一个处理函数, 不调用next即中断请求
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// Use 添加全局中间件, 需在HttpHandler之前调用
+func (this *Router) Use(middlewares ...Middleware) {
+	this.middlewares = append(this.middlewares, middlewares...)
+}
+
+// Use 添加分组中间件, 在拦截器之前执行
+func (this *RouterGroup) Use(middlewares ...Middleware) {
+	this.Middlewares = append(this.Middlewares, middlewares...)
+}
+
+// Use 添加路由级中间件, 在分组中间件之后执行
+func (this *RouterLocation) Use(middlewares ...Middleware) *RouterLocation {
+	this.middlewares = append(this.middlewares, middlewares...)
+	return this
+}
+
+// chain 按添加顺序包装中间件, 先添加的先执行
+func chain(handler HandlerFunc, middlewares []Middleware) HandlerFunc {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
@@ -2,14 +2,17 @@ package http
 
 import (
 	"bytes"
-	"compress/gzip"
+	"context"
 	"encoding/json"
+	"fmt"
 	"html/template"
+	"net"
 	"net/http"
 	"os"
 	"path"
 	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -17,6 +20,7 @@ import (
 	comm "github.com/lxf9601/go-common"
 	"github.com/lxf9601/go-common/logc"
 
+	"github.com/dgrijalva/jwt-go"
 	"github.com/valyala/fasthttp"
 )
 
@@ -57,8 +61,21 @@ func (this *Controller) Fail(ret int, msg string) *ApiResponse {
 }
 
 type HttpContext struct {
-	RawCtx      *fasthttp.RequestCtx
-	contentType string
+	RawCtx          *fasthttp.RequestCtx
+	contentType     string
+	claims          jwt.MapClaims
+	requestId       string
+	logger          *logc.Logger
+	route           *RouterLocation
+	streaming       bool
+	encoders        []Encoder
+	trustedProxies  []*net.IPNet
+	ctx             context.Context
+	cancel          context.CancelFunc
+	shutdown        <-chan struct{} // 服务关闭信号, 为空时从RawCtx获取
+	timeoutResponse *fasthttp.Response
+	apiVersion      int
+	signatureKey    string
 }
 
 func (this *HttpContext) BindForm(objValue reflect.Value, tag string) {
@@ -90,6 +107,129 @@ func (this *HttpContext) SetContentType(contentType string) {
 	this.RawCtx.Response.Header.Set("Content-Type", contentType)
 }
 
+// RequestID 获取请求ID, 未启用RequestID中间件时为空
+func (this *HttpContext) RequestID() string {
+	return this.requestId
+}
+
+// SetRequestID 设置请求ID, 并为请求日志附加request_id字段, 保留已有字段
+func (this *HttpContext) SetRequestID(requestId string) {
+	this.requestId = requestId
+	this.logger = this.Logger().WithField("request_id", requestId)
+}
+
+// Logger 获取请求日志
+func (this *HttpContext) Logger() *logc.Logger {
+	if this.logger == nil {
+		this.logger = logc.WithFields(logc.Fields{})
+	}
+	return this.logger
+}
+
+// SetLogger 替换请求日志, 用于附加更多关联字段
+func (this *HttpContext) SetLogger(logger *logc.Logger) {
+	this.logger = logger
+}
+
+// Route 获取匹配的路由, 未匹配时为nil
+func (this *HttpContext) Route() *RouterLocation {
+	return this.route
+}
+
+// RoutePattern 获取匹配的路由路径, 未匹配时为空
+func (this *HttpContext) RoutePattern() string {
+	if this.route == nil {
+		return ""
+	}
+	return this.route.Path
+}
+
+// SetClaims 设置当前用户的鉴权信息, 通常由鉴权拦截器或中间件调用
+func (this *HttpContext) SetClaims(claims jwt.MapClaims) {
+	this.claims = claims
+}
+
+// Claims 获取当前用户的鉴权信息, 未鉴权时为nil
+func (this *HttpContext) Claims() jwt.MapClaims {
+	return this.claims
+}
+
+// ClaimString 获取鉴权信息中的字段, 不存在时为空字符串
+func (this *HttpContext) ClaimString(name string) string {
+	if this.claims == nil {
+		return ""
+	}
+	v, ok := this.claims[name]
+	if !ok || v == nil {
+		return ""
+	}
+	switch val := v.(type) {
+	case string:
+		return val
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// ClientIP 获取客户端IP, 默认为连接的对端地址
+// 对端是Router.TrustProxies设置的可信代理时, 从右向左取X-Forwarded-For中第一个非可信代理的地址, 没有时使用X-Real-IP
+func (this *HttpContext) ClientIP() string {
+	remote := this.RawCtx.RemoteIP()
+	if !trustedProxy(this.trustedProxies, remote) {
+		return remote.String()
+	}
+	if xff := this.RawCtx.Request.Header.Peek("X-Forwarded-For"); len(xff) > 0 {
+		hops := strings.Split(string(xff), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(hops[i]))
+			if ip == nil {
+				break
+			}
+			if i == 0 || !trustedProxy(this.trustedProxies, ip) {
+				return ip.String()
+			}
+		}
+	}
+	if ip := net.ParseIP(string(this.RawCtx.Request.Header.Peek("X-Real-IP"))); ip != nil {
+		return ip.String()
+	}
+	return remote.String()
+}
+
+// trustedProxy ip是否属于可信代理网段
+func trustedProxy(proxies []*net.IPNet, ip net.IP) bool {
+	for _, n := range proxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// TrustProxies 设置可信代理的IP或CIDR, 只有来自可信代理的请求才使用X-Forwarded-For和X-Real-IP确定客户端IP
+// 需在HttpHandler之前调用
+func (this *Router) TrustProxies(proxies ...string) error {
+	nets := make([]*net.IPNet, 0, len(proxies))
+	for _, p := range proxies {
+		if !strings.Contains(p, "/") {
+			if ip := net.ParseIP(p); ip != nil && ip.To4() != nil {
+				p += "/32"
+			} else {
+				p += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			return err
+		}
+		nets = append(nets, n)
+	}
+	this.trustedProxies = nets
+	return nil
+}
+
 func (this *HttpContext) FormJSON(key string) map[string]interface{} {
 	var obj interface{}
 	json.Unmarshal(this.RawCtx.FormValue(key), &obj)
@@ -183,22 +323,35 @@ func (this *HttpContext) FormFloat64(key string) float64 {
 type Router struct {
 	routerMap      map[string]*RouterLocation
 	routerRegexMap map[*regexp.Regexp]*RouterLocation
+	prefixRoutes   []*RouterLocation // 前缀路由, 按路径长度降序
+	middlewares    []Middleware
+	encoders       []Encoder
+	trustedProxies []*net.IPNet
+	versioning     *VersionOptions
+	versions       map[int]*ApiVersion
+	versionList    []int // 版本号降序
 }
 
 type RouterGroup struct {
 	Interceptors []Interceptor // 拦截器
+	Middlewares  []Middleware  // 中间件
 	Url          string        // 路径
 	Router       *Router
 }
 
 type RouterLocation struct {
-	Controller *interface{}
-	Handler    string
-	Method     string
-	IsAuth     bool
-	UrlKeys    *[]string
-	UrlParams  *map[string]string
-	group      *RouterGroup
+	Path        string // 路由路径, 如 /user/{id}
+	Controller  *interface{}
+	Handler     string
+	Func        HandlerFunc // 处理函数, 设置时不再反射调用控制器
+	Method      string
+	IsAuth      bool
+	UrlKeys     *[]string
+	UrlParams   *map[string]string
+	group       *RouterGroup
+	doc         routeDoc
+	encoders    []Encoder
+	middlewares []Middleware
 }
 
 // interface definition
@@ -217,14 +370,19 @@ func (this *Router) Group(url string, interceptors []Interceptor, handler func(g
 	handler(group)
 }
 
-func (this *RouterGroup) Get(url string, controller *interface{}, handler string) {
-	this.Router.routerMap[this.Url+url] = &RouterLocation{Controller: controller, Handler: handler,
-		Method: http.MethodGet, group: this}
+func (this *RouterGroup) Get(url string, controller *interface{}, handler string) *RouterLocation {
+	return this.Router.add(&RouterLocation{Path: this.Url + url, Controller: controller, Handler: handler,
+		Method: http.MethodGet, group: this})
+}
+
+func (this *RouterGroup) Post(url string, controller *interface{}, handler string) *RouterLocation {
+	return this.Router.add(&RouterLocation{Path: this.Url + url, Controller: controller, Handler: handler,
+		Method: http.MethodPost, group: this})
 }
 
-func (this *RouterGroup) Post(url string, controller *interface{}, handler string) {
-	this.Router.routerMap[this.Url+url] = &RouterLocation{Controller: controller, Handler: handler,
-		Method: http.MethodPost, group: this}
+// HandleFunc 注册处理函数, 不限请求方法
+func (this *RouterGroup) HandleFunc(url string, handler HandlerFunc) *RouterLocation {
+	return this.Router.add(&RouterLocation{Path: this.Url + url, Func: handler, group: this})
 }
 
 func (this *Router) Match(url string) *RouterLocation {
@@ -235,7 +393,7 @@ func (this *Router) Match(url string) *RouterLocation {
 		for reg, loc := range this.routerRegexMap {
 			if reg.MatchString(url) {
 				urlParams := make(map[string]string)
-				m := reg.FindAllStringSubmatch("/afsadf/1234/5678", -1)
+				m := reg.FindAllStringSubmatch(url, -1)
 				for _, v1 := range m {
 					for k, v2 := range v1 {
 						if k > 0 {
@@ -243,7 +401,14 @@ func (this *Router) Match(url string) *RouterLocation {
 						}
 					}
 				}
-				loc.UrlParams = &urlParams
+				// 复制路由, 避免并发请求互相覆盖路径参数
+				matched := *loc
+				matched.UrlParams = &urlParams
+				return &matched
+			}
+		}
+		for _, loc := range this.prefixRoutes {
+			if url == loc.Path || strings.HasPrefix(url, loc.Path+"/") || loc.Path == "" {
 				return loc
 			}
 		}
@@ -251,32 +416,54 @@ func (this *Router) Match(url string) *RouterLocation {
 	return nil
 }
 
-func (this *Router) Get(url string, controller *interface{}, handler string) {
-	this.routerMap[url] = &RouterLocation{Controller: controller, Handler: handler, Method: http.MethodGet}
+func (this *Router) Get(url string, controller *interface{}, handler string) *RouterLocation {
+	return this.add(&RouterLocation{Path: url, Controller: controller, Handler: handler, Method: http.MethodGet})
+}
+
+func (this *Router) Post(url string, controller *interface{}, handler string) *RouterLocation {
+	return this.add(&RouterLocation{Path: url, Controller: controller, Handler: handler, Method: http.MethodPost})
 }
 
-func (this *Router) Post(url string, controller *interface{}, handler string) {
-	this.routerMap[url] = &RouterLocation{Controller: controller, Handler: handler, Method: http.MethodPost}
+// HandleFunc 注册处理函数, 不限请求方法
+func (this *Router) HandleFunc(url string, handler HandlerFunc) *RouterLocation {
+	return this.add(&RouterLocation{Path: url, Func: handler})
 }
 
-func (this *Router) Any(url string, controller *interface{}, handler string) {
+func (this *Router) Any(url string, controller *interface{}, handler string) *RouterLocation {
+	return this.add(&RouterLocation{Path: url, Controller: controller, Handler: handler, Method: http.MethodPost})
+}
+
+func (this *Router) AnyAuth(url string, controller *interface{}, handler string) *RouterLocation {
+	return this.add(&RouterLocation{Path: url, Controller: controller, Handler: handler, Method: http.MethodPost, IsAuth: true})
+}
+
+// add 注册路由, 含{param}的路径按正则匹配
+func (this *Router) add(loc *RouterLocation) *RouterLocation {
 	reg := regexp.MustCompile("\\{([^\\}]*)\\}")
-	urlKeys := make([]string, 0)
-	if reg.MatchString(url) {
-		m := reg.FindAllStringSubmatch(url, -1)
+	if reg.MatchString(loc.Path) {
+		urlKeys := make([]string, 0)
+		m := reg.FindAllStringSubmatch(loc.Path, -1)
 		for _, v1 := range m {
 			urlKeys = append(urlKeys, v1[1])
 		}
+		loc.UrlKeys = &urlKeys
 		reg = regexp.MustCompile("\\{[^\\}]*\\}")
-		reg = regexp.MustCompile(reg.ReplaceAllString(url, "([^/]*)"))
-		this.routerRegexMap[reg] = &RouterLocation{Controller: controller, Handler: handler, UrlKeys: &urlKeys, Method: http.MethodPost}
+		reg = regexp.MustCompile("^" + reg.ReplaceAllString(loc.Path, "([^/]*)") + "$")
+		this.routerRegexMap[reg] = loc
 	} else {
-		this.routerMap[url] = &RouterLocation{Controller: controller, Handler: handler, Method: http.MethodPost}
+		this.routerMap[loc.Path] = loc
 	}
+	return loc
 }
 
-func (this *Router) AnyAuth(url string, controller *interface{}, handler string) {
-	this.routerMap[url] = &RouterLocation{Controller: controller, Handler: handler, Method: http.MethodPost, IsAuth: true}
+// addPrefix 注册前缀路由, 匹配该路径及其下所有子路径, 优先级低于精确和参数路由
+func (this *Router) addPrefix(loc *RouterLocation) *RouterLocation {
+	loc.Path = strings.TrimSuffix(loc.Path, "/")
+	this.prefixRoutes = append(this.prefixRoutes, loc)
+	sort.SliceStable(this.prefixRoutes, func(i, j int) bool {
+		return len(this.prefixRoutes[i].Path) > len(this.prefixRoutes[j].Path)
+	})
+	return loc
 }
 
 func ShowTime(t time.Time) string {
@@ -284,149 +471,186 @@ func ShowTime(t time.Time) string {
 }
 
 func HttpHandler(appPath string, router *Router) func(ctx *fasthttp.RequestCtx) {
+	handler := chain(func(c *HttpContext) {
+		router.dispatch(appPath, c)
+	}, router.middlewares)
 	return func(ctx *fasthttp.RequestCtx) {
+		c := new(HttpContext)
+		c.RawCtx = ctx
+		c.encoders = router.encoders
+		c.trustedProxies = router.trustedProxies
 		defer func() {
-			if err := recover(); err != nil {
-				logc.Error(err)
-				logc.Error(string(comm.PanicTrace(5)))
+			// 流式响应在处理函数返回后才写入, 由写入结束时取消上下文
+			if !c.streaming {
+				c.release()
 			}
 		}()
-		if bytes.HasPrefix(ctx.Path(), []byte("/static")) {
-			fs := &fasthttp.FS{
-				Root:               appPath + "views",
-				IndexNames:         []string{"index.html"},
-				GenerateIndexPages: true,
-				Compress:           true,
-				AcceptByteRange:    true,
-			}
-			fs.PathRewrite = fasthttp.NewPathSlashesStripper(1)
-			fs.NewRequestHandler()(ctx)
-			return
-		} else if string(ctx.Path()) == "/" || bytes.HasSuffix(ctx.Path(), []byte(".js")) ||
-			bytes.HasSuffix(ctx.Path(), []byte(".png")) ||
-			bytes.HasSuffix(ctx.Path(), []byte(".html")) ||
-			bytes.HasSuffix(ctx.Path(), []byte(".css")) ||
-			bytes.HasPrefix(ctx.Path(), []byte("/fonts")) {
-			fs := &fasthttp.FS{
-				Root:               appPath + "views",
-				IndexNames:         []string{"index.html"},
-				GenerateIndexPages: true,
-				Compress:           true,
-				AcceptByteRange:    true,
+		defer func() {
+			if err := recover(); err != nil {
+				c.Logger().Error(err)
+				c.Logger().Error(string(comm.PanicTrace(5)))
+				writePanicResponse(c, http.StatusInternalServerError, "internal server error")
 			}
-			fs.PathRewrite = fasthttp.NewPathSlashesStripper(0)
-			fs.NewRequestHandler()(ctx)
-			return
+		}()
+		handler(c)
+	}
+}
+
+// dispatch 分发请求到静态文件、模板或路由
+func (this *Router) dispatch(appPath string, c *HttpContext) {
+	ctx := c.RawCtx
+	if bytes.HasPrefix(ctx.Path(), []byte("/static")) {
+		fs := &fasthttp.FS{
+			Root:               appPath + "views",
+			IndexNames:         []string{"index.html"},
+			GenerateIndexPages: true,
+			Compress:           true,
+			AcceptByteRange:    true,
 		}
-		n := router.Match(string(ctx.Path()))
-		if n == nil {
-			view := string(ctx.Path())[1:]
-			tplPath := path.Join(appPath+"views", view+".tpl")
-			f, err := os.Open(tplPath)
-			if err == nil {
-				defer f.Close()
-				ctx.SetContentType(CONTENT_TYPE_HTML)
-				t := template.New("").Funcs(template.
-					FuncMap{"ShowTime": ShowTime})
-				t, err = t.ParseGlob(path.Join(appPath+"views/common", "*.tpl"))
-				t, err = t.ParseFiles(tplPath)
-				err = t.ExecuteTemplate(ctx.Response.BodyWriter(), view+".tpl", nil)
-				if err != nil {
-					ctx.Write(ctx.Path())
-				}
-			} else {
+		fs.PathRewrite = fasthttp.NewPathSlashesStripper(1)
+		fs.NewRequestHandler()(ctx)
+		return
+	} else if string(ctx.Path()) == "/" || bytes.HasSuffix(ctx.Path(), []byte(".js")) ||
+		bytes.HasSuffix(ctx.Path(), []byte(".png")) ||
+		bytes.HasSuffix(ctx.Path(), []byte(".html")) ||
+		bytes.HasSuffix(ctx.Path(), []byte(".css")) ||
+		bytes.HasPrefix(ctx.Path(), []byte("/fonts")) {
+		fs := &fasthttp.FS{
+			Root:               appPath + "views",
+			IndexNames:         []string{"index.html"},
+			GenerateIndexPages: true,
+			Compress:           true,
+			AcceptByteRange:    true,
+		}
+		fs.PathRewrite = fasthttp.NewPathSlashesStripper(0)
+		fs.NewRequestHandler()(ctx)
+		return
+	}
+	n := this.matchVersion(c)
+	if n == nil {
+		view := string(ctx.Path())[1:]
+		tplPath := path.Join(appPath+"views", view+".tpl")
+		f, err := os.Open(tplPath)
+		if err == nil {
+			defer f.Close()
+			ctx.SetContentType(CONTENT_TYPE_HTML)
+			t := template.New("").Funcs(template.
+				FuncMap{"ShowTime": ShowTime})
+			t, err = t.ParseGlob(path.Join(appPath+"views/common", "*.tpl"))
+			t, err = t.ParseFiles(tplPath)
+			err = t.ExecuteTemplate(ctx.Response.BodyWriter(), view+".tpl", nil)
+			if err != nil {
 				ctx.Write(ctx.Path())
 			}
-			return
+		} else {
+			ctx.Write(ctx.Path())
 		}
-		if n.UrlParams != nil {
-			for k, v := range *n.UrlParams {
-				ctx.QueryArgs().Set(k, v)
-			}
+		return
+	}
+	c.route = n
+	if n.UrlParams != nil {
+		for k, v := range *n.UrlParams {
+			ctx.QueryArgs().Set(k, v)
 		}
-		c := new(HttpContext)
-		c.RawCtx = ctx
-		if n.IsAuth {
-			if len(ctx.Request.Header.Cookie("user_name")) == 0 {
-				ctx.Redirect("/m_login", 200)
-				return
-			}
+	}
+	handler := func(c *HttpContext) {
+		n.serve(appPath, c)
+	}
+	if len(n.middlewares) > 0 {
+		handler = chain(handler, n.middlewares)
+	}
+	if n.group != nil {
+		handler = chain(handler, n.group.Middlewares)
+	}
+	handler(c)
+}
+
+// serve 执行拦截器并调用控制器方法
+func (this *RouterLocation) serve(appPath string, c *HttpContext) {
+	ctx := c.RawCtx
+	if this.IsAuth {
+		if len(ctx.Request.Header.Cookie("user_name")) == 0 {
+			ctx.Redirect("/m_login", 200)
+			return
 		}
-		if n.group != nil && n.group.Interceptors != nil {
-			for _, interceptor := range n.group.Interceptors {
-				resp, err := interceptor.BeforeHandle(n.Controller, c)
-				if err != nil {
-					if resp == nil {
-						ctx.SetStatusCode(500)
-						ctx.Response.Reset()
-						ctx.SetBodyString(err.Error())
-					} else if resp.ContentType == CONTENT_TYPE_JSON {
-						j, _ := json.Marshal(resp.Data)
-						ctx.Write(j)
-					}
-					return
+	}
+	if this.group != nil && this.group.Interceptors != nil {
+		for _, interceptor := range this.group.Interceptors {
+			resp, err := interceptor.BeforeHandle(this.Controller, c)
+			if err != nil {
+				if resp == nil {
+					ctx.SetStatusCode(500)
+					ctx.Response.Reset()
+					ctx.SetBodyString(err.Error())
+				} else if resp.ContentType == CONTENT_TYPE_JSON {
+					j, _ := json.Marshal(resp.Data)
+					ctx.Write(j)
 				}
+				return
 			}
 		}
-		if strings.ToLower(string(ctx.Method())) == "options" {
-			return
-		}
-		v := reflect.ValueOf(*n.Controller)
-		m := v.MethodByName(n.Handler)
-		if !m.IsValid() || m.IsZero() {
-			logc.Errorf(string(ctx.Path()))
-			return
-		}
-		if m.IsNil() {
-			ctx.NotFound()
-			return
-		}
-		params := make([]reflect.Value, 1)
-		params[0] = reflect.ValueOf(c)
-		vl := m.Call(params)
-
-		if len(vl) > 0 {
-			if vl[0].Type().String() != "string" {
-				if c.GetContentType() != CONTENT_TYPE_HTML {
-					c.SetContentType(CONTENT_TYPE_JSON)
-					j, _ := json.Marshal(vl[0].Interface())
-					if n.group != nil && n.group.Interceptors != nil {
-						for _, interceptor := range n.group.Interceptors {
-							interceptor.AfterHandle(n.Controller, c, j)
-						}
-					}
-					encoding := string(ctx.Request.Header.Peek("Accept-Encoding"))
-					if len(j) > 1024 && strings.Index(encoding, "gzip") != -1 {
-						ctx.Response.Header.Add("Content-Encoding", "gzip")
-						w := gzip.NewWriter(ctx.Response.BodyWriter())
-						defer w.Close()
-						w.Write(j)
-					} else {
-						ctx.Write(j)
-						if logc.IsDebug() {
-							logc.Debug(ctx.Request.URI().String() + ">>" + string(j))
-						}
-					}
+	}
+	if strings.ToLower(string(ctx.Method())) == "options" {
+		return
+	}
+	if this.Func != nil {
+		this.Func(c)
+		return
+	}
+	v := reflect.ValueOf(*this.Controller)
+	m := v.MethodByName(this.Handler)
+	if !m.IsValid() || m.IsZero() {
+		logc.Errorf(string(ctx.Path()))
+		return
+	}
+	if m.IsNil() {
+		ctx.NotFound()
+		return
+	}
+	params := make([]reflect.Value, 1)
+	params[0] = reflect.ValueOf(c)
+	vl := m.Call(params)
+	if c.streaming {
+		return
+	}
+
+	if len(vl) > 0 {
+		if vl[0].Type().String() != "string" {
+			if c.GetContentType() != CONTENT_TYPE_HTML {
+				if err := c.Encode(vl[0].Interface()); err != nil {
+					c.Logger().Errorf("encode response: %s", err)
 				}
-			} else {
-				c.SetContentType(CONTENT_TYPE_HTML)
-				view, _ := vl[0].Interface().(string)
-				if view != "" {
-					tplPath := appPath + "views/" + view + ".tpl"
-					f, err := os.Open(tplPath)
-					if err == nil {
-						defer f.Close()
-						t := template.New("").Funcs(template.
-							FuncMap{"ShowTime": ShowTime})
-						t.ParseFiles()
-						t, err = t.ParseGlob(path.Join(appPath+"views/common", "*.tpl"))
-						t, err = t.ParseFiles(path.Join(appPath+"views", view+".tpl"))
-						err = t.ExecuteTemplate(ctx.Response.BodyWriter(), view+".tpl", vl[1].Interface())
+				j := ctx.Response.Body()
+				if this.group != nil && this.group.Interceptors != nil {
+					for _, interceptor := range this.group.Interceptors {
+						interceptor.AfterHandle(this.Controller, c, j)
 					}
 				}
+				encoding := string(ctx.Request.Header.Peek("Accept-Encoding"))
+				if len(j) > 1024 && strings.Index(encoding, "gzip") != -1 {
+					ctx.Response.Header.Add("Content-Encoding", "gzip")
+					ctx.Response.SetBody(fasthttp.AppendGzipBytes(nil, j))
+				} else if logc.IsDebug() {
+					logc.Debug(ctx.Request.URI().String() + ">>" + string(j))
+				}
+			}
+		} else {
+			c.SetContentType(CONTENT_TYPE_HTML)
+			view, _ := vl[0].Interface().(string)
+			if view != "" {
+				tplPath := appPath + "views/" + view + ".tpl"
+				f, err := os.Open(tplPath)
+				if err == nil {
+					defer f.Close()
+					t := template.New("").Funcs(template.
+						FuncMap{"ShowTime": ShowTime})
+					t.ParseFiles()
+					t, err = t.ParseGlob(path.Join(appPath+"views/common", "*.tpl"))
+					t, err = t.ParseFiles(path.Join(appPath+"views", view+".tpl"))
+					err = t.ExecuteTemplate(ctx.Response.BodyWriter(), view+".tpl", vl[1].Interface())
+				}
 			}
-
 		}
-	}
 
+	}
 }
@@ -0,0 +1,458 @@
+package http
+
+import (
+	"encoding/json"
+	"html/template"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+const OPENAPI_VERSION = "3.0.3"
+
+// 路由文档信息
+type routeDoc struct {
+	summary      string
+	description  string
+	tags         []string
+	requestType  reflect.Type
+	responseType reflect.Type
+	hidden       bool
+}
+
+// Doc 设置接口说明
+func (this *RouterLocation) Doc(summary string, description string) *RouterLocation {
+	this.doc.summary = summary
+	this.doc.description = description
+	return this
+}
+
+// Tags 设置接口分组标签, 默认使用路由分组路径
+func (this *RouterLocation) Tags(tags ...string) *RouterLocation {
+	this.doc.tags = tags
+	return this
+}
+
+// Request 设置请求参数结构体, 即控制器中BindForm的目标
+func (this *RouterLocation) Request(obj interface{}) *RouterLocation {
+	this.doc.requestType = reflect.TypeOf(obj)
+	return this
+}
+
+// Response 设置响应数据结构体, 即ApiResponse.Data
+func (this *RouterLocation) Response(obj interface{}) *RouterLocation {
+	this.doc.responseType = reflect.TypeOf(obj)
+	return this
+}
+
+// Hide 不在接口文档中显示
+func (this *RouterLocation) Hide() *RouterLocation {
+	this.doc.hidden = true
+	return this
+}
+
+// OpenAPI文档配置
+type OpenApiOptions struct {
+	Title         string   // 文档标题
+	Version       string   // 接口版本
+	Description   string   // 文档说明
+	Servers       []string // 服务地址
+	Path          string   // 文档路由, 默认/openapi.json
+	BindTag       string   // 请求结构体字段名使用的标签, 默认form, 缺省时使用json标签
+	SwaggerUIPath string   // Swagger UI路由前缀, 为空时不挂载
+	SwaggerUIDir  string   // Swagger UI静态文件目录, 即swagger-ui-dist
+}
+
+type OpenApiDoc struct {
+	OpenApi    string                                  `json:"openapi"`
+	Info       OpenApiInfo                             `json:"info"`
+	Servers    []OpenApiServer                         `json:"servers,omitempty"`
+	Paths      map[string]map[string]*OpenApiOperation `json:"paths"`
+	Components OpenApiComponents                       `json:"components"`
+}
+
+type OpenApiInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type OpenApiServer struct {
+	Url string `json:"url"`
+}
+
+type OpenApiComponents struct {
+	Schemas         map[string]*OpenApiSchema         `json:"schemas,omitempty"`
+	SecuritySchemes map[string]*OpenApiSecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type OpenApiSecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	In           string `json:"in,omitempty"`
+	Name         string `json:"name,omitempty"`
+}
+
+type OpenApiOperation struct {
+	Summary     string                      `json:"summary,omitempty"`
+	Description string                      `json:"description,omitempty"`
+	Tags        []string                    `json:"tags,omitempty"`
+	Parameters  []*OpenApiParameter         `json:"parameters,omitempty"`
+	RequestBody *OpenApiRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*OpenApiResponse `json:"responses"`
+	Security    []map[string][]string       `json:"security,omitempty"`
+}
+
+type OpenApiParameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Description string         `json:"description,omitempty"`
+	Required    bool           `json:"required,omitempty"`
+	Schema      *OpenApiSchema `json:"schema"`
+}
+
+type OpenApiRequestBody struct {
+	Required bool                         `json:"required,omitempty"`
+	Content  map[string]*OpenApiMediaType `json:"content"`
+}
+
+type OpenApiResponse struct {
+	Description string                       `json:"description"`
+	Content     map[string]*OpenApiMediaType `json:"content,omitempty"`
+}
+
+type OpenApiMediaType struct {
+	Schema *OpenApiSchema `json:"schema"`
+}
+
+type OpenApiSchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Description          string                    `json:"description,omitempty"`
+	Items                *OpenApiSchema            `json:"items,omitempty"`
+	Properties           map[string]*OpenApiSchema `json:"properties,omitempty"`
+	AdditionalProperties *OpenApiSchema            `json:"additionalProperties,omitempty"`
+	Minimum              *float64                  `json:"minimum,omitempty"`
+}
+
+const securityCookie = "cookieAuth"
+
+// OpenApi 根据已注册的路由生成OpenAPI 3文档
+// 未设置文档信息的HandleFunc路由(如健康检查、指标)不会出现在文档中
+func (this *Router) OpenApi(options *OpenApiOptions) *OpenApiDoc {
+	bindTag := options.BindTag
+	if bindTag == "" {
+		bindTag = "form"
+	}
+	doc := &OpenApiDoc{
+		OpenApi: OPENAPI_VERSION,
+		Info:    OpenApiInfo{Title: options.Title, Version: options.Version, Description: options.Description},
+		Paths:   make(map[string]map[string]*OpenApiOperation),
+		Components: OpenApiComponents{
+			Schemas:         make(map[string]*OpenApiSchema),
+			SecuritySchemes: make(map[string]*OpenApiSecurityScheme),
+		},
+	}
+	for _, url := range options.Servers {
+		doc.Servers = append(doc.Servers, OpenApiServer{Url: url})
+	}
+	schemas := &schemaBuilder{components: doc.Components.Schemas, names: make(map[reflect.Type]string)}
+
+	for _, loc := range this.routes() {
+		if loc.doc.hidden || (loc.Func != nil && loc.doc.summary == "" &&
+			loc.doc.requestType == nil && loc.doc.responseType == nil) {
+			continue
+		}
+		method := strings.ToLower(loc.Method)
+		if method == "" {
+			method = "get"
+		}
+		op := &OpenApiOperation{
+			Summary:     loc.doc.summary,
+			Description: loc.doc.description,
+			Tags:        loc.doc.tags,
+			Responses:   make(map[string]*OpenApiResponse),
+		}
+		if len(op.Tags) == 0 && loc.group != nil && strings.Trim(loc.group.Url, "/") != "" {
+			op.Tags = []string{strings.Trim(loc.group.Url, "/")}
+		}
+
+		pathKeys := make(map[string]bool)
+		if loc.UrlKeys != nil {
+			for _, key := range *loc.UrlKeys {
+				pathKeys[key] = true
+				op.Parameters = append(op.Parameters, &OpenApiParameter{Name: key, In: "path",
+					Required: true, Schema: &OpenApiSchema{Type: "string"}})
+			}
+		}
+		if loc.doc.requestType != nil {
+			if method == "get" || method == "delete" {
+				for _, f := range structFields(loc.doc.requestType, bindTag) {
+					if pathKeys[f.name] {
+						continue
+					}
+					op.Parameters = append(op.Parameters, &OpenApiParameter{Name: f.name, In: "query",
+						Description: f.description, Schema: schemas.schema(f.typ)})
+				}
+			} else {
+				schema := schemas.inlineStruct(loc.doc.requestType, bindTag)
+				op.RequestBody = &OpenApiRequestBody{Required: true, Content: map[string]*OpenApiMediaType{
+					"application/x-www-form-urlencoded": {Schema: schema},
+					"multipart/form-data":               {Schema: schema},
+				}}
+			}
+		}
+
+		data := &OpenApiSchema{}
+		if loc.doc.responseType != nil {
+			data = schemas.schema(loc.doc.responseType)
+		}
+		op.Responses["200"] = &OpenApiResponse{Description: "OK", Content: map[string]*OpenApiMediaType{
+			"application/json": {Schema: apiResponseSchema(data)},
+		}}
+
+		if loc.IsAuth {
+			doc.Components.SecuritySchemes[securityCookie] = &OpenApiSecurityScheme{Type: "apiKey", In: "cookie", Name: "user_name"}
+			op.Security = []map[string][]string{{securityCookie: {}}}
+		}
+
+		path := loc.Path
+		if path == "" {
+			// 根路径的前缀路由
+			path = "/"
+		}
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(map[string]*OpenApiOperation)
+		}
+		doc.Paths[path][method] = op
+	}
+	return doc
+}
+
+// ServeOpenApi 挂载OpenAPI文档路由, 配置SwaggerUIDir时同时挂载Swagger UI, 需在HttpHandler之前调用
+// 文档在首次请求时生成, 包含此后注册的路由
+func (this *Router) ServeOpenApi(options *OpenApiOptions) {
+	specPath := options.Path
+	if specPath == "" {
+		specPath = "/openapi.json"
+	}
+	var once sync.Once
+	var spec []byte
+	this.HandleFunc(specPath, func(c *HttpContext) {
+		once.Do(func() {
+			spec, _ = json.Marshal(this.OpenApi(options))
+		})
+		c.SetContentType(CONTENT_TYPE_JSON)
+		c.RawCtx.SetBody(spec)
+	})
+	if options.SwaggerUIPath != "" && options.SwaggerUIDir != "" {
+		this.Use(swaggerUI(strings.TrimRight(options.SwaggerUIPath, "/"), options.SwaggerUIDir, specPath))
+	}
+}
+
+var swaggerUITpl = template.Must(template.New("swagger").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>API Docs</title>
+<link rel="stylesheet" href="{{.Prefix}}/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="{{.Prefix}}/swagger-ui-bundle.js"></script>
+<script>
+window.ui = SwaggerUIBundle({url: "{{.Spec}}", dom_id: "#swagger-ui"});
+</script>
+</body>
+</html>`))
+
+// swaggerUI Swagger UI中间件, 在静态文件处理之前拦截前缀下的请求
+func swaggerUI(prefix string, dir string, specPath string) Middleware {
+	fs := &fasthttp.FS{
+		Root:            dir,
+		Compress:        true,
+		AcceptByteRange: true,
+		PathRewrite:     fasthttp.NewPathPrefixStripper(len(prefix)),
+	}
+	fsHandler := fs.NewRequestHandler()
+	return func(next HandlerFunc) HandlerFunc {
+		return func(c *HttpContext) {
+			p := string(c.RawCtx.Path())
+			if p == prefix || p == prefix+"/" || p == prefix+"/index.html" {
+				c.SetContentType(CONTENT_TYPE_HTML)
+				swaggerUITpl.Execute(c.RawCtx.Response.BodyWriter(),
+					map[string]string{"Prefix": prefix, "Spec": specPath})
+				return
+			}
+			if strings.HasPrefix(p, prefix+"/") {
+				fsHandler(c.RawCtx)
+				return
+			}
+			next(c)
+		}
+	}
+}
+
+// routes 按路径排序的全部路由, 包括反向代理等前缀路由
+func (this *Router) routes() []*RouterLocation {
+	list := make([]*RouterLocation, 0, len(this.routerMap)+len(this.routerRegexMap)+len(this.prefixRoutes))
+	for _, loc := range this.routerMap {
+		list = append(list, loc)
+	}
+	for _, loc := range this.routerRegexMap {
+		list = append(list, loc)
+	}
+	list = append(list, this.prefixRoutes...)
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Path != list[j].Path {
+			return list[i].Path < list[j].Path
+		}
+		return list[i].Method < list[j].Method
+	})
+	return list
+}
+
+func apiResponseSchema(data *OpenApiSchema) *OpenApiSchema {
+	return &OpenApiSchema{Type: "object", Properties: map[string]*OpenApiSchema{
+		"ret":  {Type: "integer", Description: "0 success, otherwise error code"},
+		"msg":  {Type: "string"},
+		"data": data,
+	}}
+}
+
+type docField struct {
+	name        string
+	description string
+	typ         reflect.Type
+}
+
+// structFields 获取结构体导出字段, 匿名嵌入的结构体字段会展开
+func structFields(t reflect.Type, tag string) []docField {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	fields := make([]docField, 0, t.NumField())
+	if t.Kind() != reflect.Struct {
+		return fields
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && indirectType(f.Type).Kind() == reflect.Struct {
+			fields = append(fields, structFields(f.Type, tag)...)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		name := fieldName(f, tag)
+		if name == "-" {
+			continue
+		}
+		fields = append(fields, docField{name: name, description: f.Tag.Get("doc"), typ: f.Type})
+	}
+	return fields
+}
+
+// fieldName 按标签获取字段名, 未设置时依次使用json标签和字段名
+func fieldName(f reflect.StructField, tag string) string {
+	for _, t := range []string{tag, "json"} {
+		if v := f.Tag.Get(t); v != "" {
+			if i := strings.Index(v, ","); i != -1 {
+				v = v[:i]
+			}
+			if v != "" {
+				return v
+			}
+		}
+	}
+	return f.Name
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// 结构体生成components中的schema并通过$ref引用
+type schemaBuilder struct {
+	components map[string]*OpenApiSchema
+	names      map[reflect.Type]string
+}
+
+// schema 生成类型的schema, 结构体字段名使用json标签
+func (this *schemaBuilder) schema(t reflect.Type) *OpenApiSchema {
+	t = indirectType(t)
+	if t == timeType {
+		return &OpenApiSchema{Type: "string", Format: "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return &OpenApiSchema{Type: "string"}
+	case reflect.Bool:
+		return &OpenApiSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		return &OpenApiSchema{Type: "integer", Format: "int32"}
+	case reflect.Int64:
+		return &OpenApiSchema{Type: "integer", Format: "int64"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		zero := float64(0)
+		return &OpenApiSchema{Type: "integer", Minimum: &zero}
+	case reflect.Float32:
+		return &OpenApiSchema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &OpenApiSchema{Type: "number", Format: "double"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &OpenApiSchema{Type: "string", Format: "byte"}
+		}
+		return &OpenApiSchema{Type: "array", Items: this.schema(t.Elem())}
+	case reflect.Map:
+		return &OpenApiSchema{Type: "object", AdditionalProperties: this.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return this.inlineStruct(t, "json")
+		}
+		return &OpenApiSchema{Ref: "#/components/schemas/" + this.define(t)}
+	}
+	return &OpenApiSchema{}
+}
+
+// define 注册具名结构体, 同名不同包的结构体加包名前缀
+func (this *schemaBuilder) define(t reflect.Type) string {
+	if name, ok := this.names[t]; ok {
+		return name
+	}
+	name := t.Name()
+	if _, exists := this.components[name]; exists {
+		name = path.Base(t.PkgPath()) + "." + name
+	}
+	this.names[t] = name
+	// 先占位, 避免递归结构体无限展开
+	this.components[name] = &OpenApiSchema{}
+	*this.components[name] = *this.inlineStruct(t, "json")
+	return name
+}
+
+func (this *schemaBuilder) inlineStruct(t reflect.Type, tag string) *OpenApiSchema {
+	schema := &OpenApiSchema{Type: "object", Properties: make(map[string]*OpenApiSchema)}
+	for _, f := range structFields(t, tag) {
+		s := this.schema(f.typ)
+		// $ref不能有同级字段
+		if s.Ref == "" {
+			s.Description = f.description
+		}
+		schema.Properties[f.name] = s
+	}
+	return schema
+}
@@ -0,0 +1,109 @@
+package http
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+type openApiUserQuery struct {
+	Keyword string `form:"keyword" doc:"search keyword"`
+	Page    int    `form:"page"`
+}
+
+type openApiUser struct {
+	Id       uint64        `json:"id"`
+	Name     string        `json:"name"`
+	Created  time.Time     `json:"created"`
+	Friends  []openApiUser `json:"friends"`
+	password string
+}
+
+type openApiTestController struct {
+	Controller
+}
+
+func (this *openApiTestController) List(ctx *HttpContext) *ApiResponse {
+	return this.Success(nil)
+}
+
+func (this *openApiTestController) Info(ctx *HttpContext) *ApiResponse {
+	return this.Success(ctx.ClaimString("sub"))
+}
+
+func newOpenApiTestRouter() *Router {
+	router := new(Router)
+	router.Init()
+	var controller interface{} = &openApiTestController{}
+	router.HandleFunc("/healthz", func(c *HttpContext) {})
+	router.AnyAuth("/user/profile", &controller, "Info").Doc("Current user", "").Response("")
+	router.Proxy("/orders/", NewReverseProxy(&ProxyOptions{Upstreams: []string{"http://orders"}})).
+		Doc("Order service", "proxied to the order service")
+	router.Proxy("/legacy", NewReverseProxy(&ProxyOptions{Upstreams: []string{"http://legacy"}}))
+	router.Group("/user", nil, func(group *RouterGroup) {
+		group.Get("/list", &controller, "List").Doc("List users", "").
+			Request(openApiUserQuery{}).Response([]openApiUser{})
+		group.Post("/{id}/info", &controller, "Info").Request(&openApiUserQuery{}).Response(&openApiUser{})
+	})
+	router.ServeOpenApi(&OpenApiOptions{Title: "test", Version: "1.0"})
+	return router
+}
+
+func TestOpenApi(t *testing.T) {
+	doc := newOpenApiTestRouter().OpenApi(&OpenApiOptions{Title: "test", Version: "1.0"})
+	if _, ok := doc.Paths["/healthz"]; ok {
+		t.Fatal("undocumented func routes must be skipped")
+	}
+	list := doc.Paths["/user/list"]["get"]
+	if list == nil || list.Summary != "List users" || len(list.Parameters) != 2 ||
+		list.Parameters[0].Name != "keyword" || list.Parameters[0].In != "query" ||
+		list.Parameters[0].Description != "search keyword" || list.Tags[0] != "user" {
+		t.Fatalf("%+v", list)
+	}
+	data := list.Responses["200"].Content["application/json"].Schema.Properties["data"]
+	if data.Type != "array" || data.Items.Ref != "#/components/schemas/openApiUser" {
+		t.Fatalf("%+v", data)
+	}
+	if len(list.Security) != 0 {
+		t.Fatalf("%+v", list.Security)
+	}
+	profile := doc.Paths["/user/profile"]["post"]
+	if profile == nil || len(profile.Security) != 1 || doc.Components.SecuritySchemes[securityCookie] == nil {
+		t.Fatalf("%+v", profile)
+	}
+	// 前缀路由同样生成文档
+	if orders := doc.Paths["/orders"]["get"]; orders == nil || orders.Summary != "Order service" {
+		t.Fatalf("%+v", doc.Paths)
+	}
+	if _, ok := doc.Paths["/legacy"]; ok {
+		t.Fatal("undocumented prefix routes must be skipped")
+	}
+
+	info := doc.Paths["/user/{id}/info"]["post"]
+	if info == nil || info.Parameters[0].In != "path" || !info.Parameters[0].Required ||
+		info.RequestBody.Content["application/x-www-form-urlencoded"].Schema.Properties["page"].Type != "integer" {
+		t.Fatalf("%+v", info)
+	}
+
+	user := doc.Components.Schemas["openApiUser"]
+	if user == nil || len(user.Properties) != 4 || user.Properties["created"].Format != "date-time" ||
+		user.Properties["friends"].Items.Ref != "#/components/schemas/openApiUser" {
+		t.Fatalf("%+v", user)
+	}
+}
+
+func TestOpenApiServe(t *testing.T) {
+	handler := HttpHandler("", newOpenApiTestRouter())
+	req := fasthttp.AcquireRequest()
+	req.SetRequestURI("/openapi.json")
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Init(req, nil, nil)
+	handler(ctx)
+	doc := new(OpenApiDoc)
+	if err := json.Unmarshal(ctx.Response.Body(), doc); err != nil || doc.OpenApi != OPENAPI_VERSION ||
+		doc.Paths["/orders"] == nil {
+		t.Fatal(string(ctx.Response.Body()))
+	}
+}
@@ -0,0 +1,322 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lxf9601/go-common/logc"
+	"github.com/lxf9601/go-common/trace"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	HEADER_FORWARDED_FOR   = "X-Forwarded-For"
+	HEADER_FORWARDED_PROTO = "X-Forwarded-Proto"
+	HEADER_FORWARDED_HOST  = "X-Forwarded-Host"
+)
+
+const defaultProxyTimeout = 30 * time.Second
+
+// 逐跳头, 只对单个连接有效, 代理时不转发
+var hopHeaders = []string{"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
+	"Proxy-Connection", "Te", "Trailer", "Transfer-Encoding", "Upgrade"}
+
+// 反向代理配置
+type ProxyOptions struct {
+	Upstreams             []string                    // 上游地址, 如http://10.0.0.1:8080/api, 地址中的路径作为转发路径前缀
+	Discovery             Discovery                   // 服务发现, 优先于Upstreams
+	Balance               int                         // 负载均衡策略, 默认轮询
+	Ejection              *EjectionOptions            // 被动健康检查配置, 为空使用默认值
+	HashKey               func(c *HttpContext) string // 一致性哈希的键, 默认客户端IP
+	StripPrefix           bool                        // 转发前去掉路由前缀
+	Rewrite               func(path string) string    // 路径重写, 在StripPrefix之后执行
+	PreserveHost          bool                        // 保留客户端的Host请求头, 默认使用上游地址
+	TrustForwarded        bool                        // 信任客户端传入的X-Forwarded-*, 网关前还有代理时开启
+	SetHeaders            map[string]string           // 转发时设置的请求头, 如服务间鉴权
+	RemoveHeaders         []string                    // 转发时删除的请求头
+	ResponseHeaders       map[string]string           // 返回时设置的响应头
+	RemoveResponseHeaders []string                    // 返回时删除的响应头
+	Timeout               time.Duration               // 上游请求超时, 默认30秒, 不超过Context()的截止时间
+	Retry                 *RetryOptions               // 重试配置, 为空不重试, 默认只重试幂等请求, 流式请求体无法重放不重试
+	MaxConnsPerHost       int                         // 每个上游的最大连接数, 默认512
+	TLS                   *TLSOptions                 // https上游的TLS配置
+}
+
+// 反向代理, 响应体完整缓存后转发, 服务开启ServerOptions.StreamRequestBody时请求体边读边转发
+type ReverseProxy struct {
+	options     ProxyOptions
+	balancer    *balancer
+	retry       *RetryOptions
+	tlsConfig   *tls.Config
+	err         error // 配置错误, 每次请求时返回502
+	clients     map[string]*fasthttp.HostClient
+	clientsLock sync.Mutex
+	dial        fasthttp.DialFunc
+}
+
+func NewReverseProxy(options *ProxyOptions) *ReverseProxy {
+	proxy := &ReverseProxy{options: *options, retry: normalizeRetryOptions(options.Retry),
+		clients: make(map[string]*fasthttp.HostClient)}
+	if proxy.options.Timeout <= 0 {
+		proxy.options.Timeout = defaultProxyTimeout
+	}
+	if options.TLS != nil {
+		proxy.tlsConfig, proxy.err = options.TLS.ClientConfig()
+		if proxy.err != nil {
+			logc.Errorf("reverse proxy tls: %s", proxy.err)
+		}
+	}
+	discovery := options.Discovery
+	if discovery == nil {
+		discovery = StaticDiscovery(options.Upstreams)
+	}
+	proxy.balancer = newBalancer(discovery, options.Balance, options.Ejection, nil)
+	return proxy
+}
+
+// Proxy 注册反向代理, 转发prefix及其下所有路径, 全局中间件同样生效
+func (this *Router) Proxy(prefix string, proxy *ReverseProxy) *RouterLocation {
+	return this.addPrefix(&RouterLocation{Path: prefix, Func: proxy.Handle})
+}
+
+// Proxy 在分组下注册反向代理, 分组的鉴权、限流等中间件同样生效
+func (this *RouterGroup) Proxy(prefix string, proxy *ReverseProxy) *RouterLocation {
+	return this.Router.addPrefix(&RouterLocation{Path: this.Url + prefix, Func: proxy.Handle, group: this})
+}
+
+// Handle 转发请求到上游, 上游不可用返回502, 超时返回504, 无可用实例返回503
+func (this *ReverseProxy) Handle(c *HttpContext) {
+	if this.err != nil {
+		writeProxyError(c, http.StatusBadGateway, this.err.Error())
+		return
+	}
+	ctx := c.Context()
+	req := fasthttp.AcquireRequest()
+	rep := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(rep)
+	c.RawCtx.Request.CopyTo(req)
+	this.prepare(c, req)
+	// CopyTo只复制已预读的部分请求体, 流式请求体需单独转发
+	streamed := false
+	if stream := c.RawCtx.RequestBodyStream(); stream != nil && c.RawCtx.Request.Header.ContentLength() != 0 {
+		req.SetBodyStream(stream, c.RawCtx.Request.Header.ContentLength())
+		streamed = true
+	}
+	path := this.path(c)
+	method := string(c.RawCtx.Method())
+	attempts := 1
+	if this.retry != nil && !streamed && (this.retry.RetryNonIdempotent || idempotentMethod(method)) {
+		attempts = this.retry.MaxAttempts
+	}
+	var target string
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			if sleepContext(ctx, this.retry.backoff(attempt-1, err)) != nil {
+				break
+			}
+			rep.Reset()
+		}
+		target, err = this.forward(ctx, c, req, rep, path)
+		if err == nil && attempt < attempts {
+			// 最后一次尝试的响应原样返回, 之前的按状态码判断是否重试
+			status := &StatusError{StatusCode: rep.StatusCode(), Url: target,
+				RetryAfter: parseRetryAfter(rep.Header.Peek("Retry-After"))}
+			if this.retry.retryable(status) {
+				err = status
+			}
+		}
+		if err == nil || attempt == attempts || !this.retry.retryable(err) {
+			break
+		}
+		c.Logger().Warnf("proxy %s %s: %s, retry %d/%d", method, target, err, attempt, attempts-1)
+	}
+	if _, ok := err.(*StatusError); ok {
+		err = nil
+	}
+	if err != nil {
+		c.Logger().Errorf("proxy %s %s: %s", method, target, err)
+		switch {
+		case err == ErrNoEndpoint:
+			writeProxyError(c, http.StatusServiceUnavailable, "service unavailable")
+		case err == fasthttp.ErrTimeout || err == context.DeadlineExceeded:
+			writeProxyError(c, http.StatusGatewayTimeout, "gateway timeout")
+		default:
+			writeProxyError(c, http.StatusBadGateway, "bad gateway")
+		}
+		return
+	}
+	this.writeResponse(c, rep)
+}
+
+// prepare 删除逐跳头, 设置X-Forwarded-*、请求ID及链路上下文, 应用请求头配置
+func (this *ReverseProxy) prepare(c *HttpContext, req *fasthttp.Request) {
+	header := &req.Header
+	for _, key := range connectionHeaders(header.Peek("Connection")) {
+		header.Del(key)
+	}
+	for _, key := range hopHeaders {
+		header.Del(key)
+	}
+	trusted := this.options.TrustForwarded
+	clientIp := c.RawCtx.RemoteIP().String()
+	if prior := header.Peek(HEADER_FORWARDED_FOR); trusted && len(prior) > 0 {
+		clientIp = string(prior) + ", " + clientIp
+	}
+	header.Set(HEADER_FORWARDED_FOR, clientIp)
+	if !trusted || len(header.Peek(HEADER_FORWARDED_PROTO)) == 0 {
+		proto := "http"
+		if c.RawCtx.IsTLS() {
+			proto = "https"
+		}
+		header.Set(HEADER_FORWARDED_PROTO, proto)
+	}
+	if !trusted || len(header.Peek(HEADER_FORWARDED_HOST)) == 0 {
+		header.SetBytesV(HEADER_FORWARDED_HOST, c.RawCtx.Host())
+	}
+	if c.RequestID() != "" {
+		header.Set(HEADER_REQUEST_ID, c.RequestID())
+	}
+	trace.Inject(c.Context(), header.Set)
+	for k, v := range this.options.SetHeaders {
+		header.Set(k, v)
+	}
+	for _, k := range this.options.RemoveHeaders {
+		header.Del(k)
+	}
+	req.UseHostHeader = this.options.PreserveHost
+}
+
+// path 转发路径, 按StripPrefix和Rewrite处理
+func (this *ReverseProxy) path(c *HttpContext) string {
+	path := string(c.RawCtx.Path())
+	if this.options.StripPrefix && c.Route() != nil {
+		path = strings.TrimPrefix(path, c.Route().Path)
+	}
+	if this.options.Rewrite != nil {
+		path = this.options.Rewrite(path)
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return path
+}
+
+// forward 选择上游并发送一次请求, 返回上游地址
+func (this *ReverseProxy) forward(ctx context.Context, c *HttpContext, req *fasthttp.Request, rep *fasthttp.Response,
+	path string) (target string, err error) {
+	key := ""
+	if this.balancer.policy == BALANCE_CONSISTENT_HASH {
+		if this.options.HashKey != nil {
+			key = this.options.HashKey(c)
+		} else {
+			key = c.ClientIP()
+		}
+	}
+	e, err := this.balancer.pick(key)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		this.balancer.done(e, err != nil || rep.StatusCode() >= 500)
+	}()
+	upstream, err := url.Parse(e.url)
+	if err != nil {
+		return e.url, err
+	}
+	uri := req.URI()
+	uri.SetScheme(upstream.Scheme)
+	uri.SetHost(upstream.Host)
+	uri.SetPath(strings.TrimSuffix(upstream.Path, "/") + path)
+	target = uri.String()
+	deadline := time.Now().Add(this.options.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	err = this.client(upstream.Scheme, upstream.Host).DoDeadline(req, rep, deadline)
+	if err == fasthttp.ErrTimeout && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	return target, err
+}
+
+// client 获取或创建上游主机的连接池
+func (this *ReverseProxy) client(scheme string, host string) *fasthttp.HostClient {
+	key := scheme + "://" + host
+	this.clientsLock.Lock()
+	defer this.clientsLock.Unlock()
+	client, ok := this.clients[key]
+	if !ok {
+		client = &fasthttp.HostClient{
+			Addr:                     host,
+			IsTLS:                    scheme == "https",
+			TLSConfig:                this.tlsConfig,
+			MaxConns:                 this.options.MaxConnsPerHost,
+			Dial:                     this.dial,
+			NoDefaultUserAgentHeader: true,
+		}
+		this.clients[key] = client
+	}
+	return client
+}
+
+// writeResponse 将上游响应写回客户端, 覆盖中间件已设置的同名响应头
+func (this *ReverseProxy) writeResponse(c *HttpContext, rep *fasthttp.Response) {
+	skip := make(map[string]bool, len(hopHeaders)+1)
+	for _, key := range hopHeaders {
+		skip[key] = true
+	}
+	for _, key := range connectionHeaders(rep.Header.Peek("Connection")) {
+		skip[key] = true
+	}
+	skip[fasthttp.HeaderContentLength] = true
+	resp := &c.RawCtx.Response
+	resp.SetStatusCode(rep.StatusCode())
+	replaced := make(map[string]bool)
+	rep.Header.VisitAll(func(k []byte, v []byte) {
+		key := string(k)
+		if skip[key] {
+			return
+		}
+		if !replaced[key] {
+			resp.Header.Del(key)
+			replaced[key] = true
+		}
+		resp.Header.AddBytesKV(k, v)
+	})
+	resp.SetBody(rep.Body())
+	for k, v := range this.options.ResponseHeaders {
+		resp.Header.Set(k, v)
+	}
+	for _, k := range this.options.RemoveResponseHeaders {
+		resp.Header.Del(k)
+	}
+}
+
+// connectionHeaders Connection头中列出的逐跳头
+func connectionHeaders(value []byte) []string {
+	var keys []string
+	for _, key := range strings.Split(string(value), ",") {
+		if key = strings.TrimSpace(key); key != "" && !strings.EqualFold(key, "close") &&
+			!strings.EqualFold(key, "keep-alive") {
+			keys = append(keys, http.CanonicalHeaderKey(key))
+		}
+	}
+	return keys
+}
+
+func writeProxyError(c *HttpContext, status int, msg string) {
+	j, _ := json.Marshal(&ApiResponse{Ret: status, Msg: msg})
+	c.RawCtx.Response.ResetBody()
+	c.RawCtx.SetStatusCode(status)
+	c.SetContentType(CONTENT_TYPE_JSON)
+	c.RawCtx.SetBody(j)
+}
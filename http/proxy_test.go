@@ -0,0 +1,186 @@
+package http
+
+import (
+	"bytes"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+func proxyTestRequest(handler fasthttp.RequestHandler, method string, uri string, headers map[string]string) *fasthttp.RequestCtx {
+	req := &fasthttp.Request{}
+	req.Header.SetMethod(method)
+	req.SetRequestURI(uri)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Init(req, &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1)}, nil)
+	handler(ctx)
+	return ctx
+}
+
+func TestReverseProxy(t *testing.T) {
+	dial, closeFn := newTestServer(func(ctx *fasthttp.RequestCtx) {
+		h := &ctx.Request.Header
+		if string(ctx.Path()) != "/api/user/1" || string(ctx.QueryArgs().Peek("a")) != "b" ||
+			string(h.Host()) != "user-service" || string(h.Peek(HEADER_FORWARDED_FOR)) != "10.0.0.1" ||
+			string(h.Peek(HEADER_FORWARDED_HOST)) != "gateway" || string(h.Peek(HEADER_FORWARDED_PROTO)) != "http" ||
+			string(h.Peek("X-Token")) != "internal" || len(h.Peek("Cookie")) > 0 || len(h.Peek("X-Hop")) > 0 ||
+			string(h.Peek(HEADER_REQUEST_ID)) != "req-1" {
+			ctx.SetStatusCode(400)
+			ctx.SetBodyString(h.String())
+			return
+		}
+		ctx.Response.Header.Set("X-Upstream", "1")
+		ctx.Response.Header.Set("X-Internal", "secret")
+		ctx.Response.Header.Set(HEADER_REQUEST_ID, "req-1")
+		ctx.SetBodyString(`{"ret":0,"msg":"","data":1}`)
+	})
+	defer closeFn()
+	proxy := NewReverseProxy(&ProxyOptions{
+		Upstreams:             []string{"http://user-service/api"},
+		StripPrefix:           true,
+		SetHeaders:            map[string]string{"X-Token": "internal"},
+		RemoveHeaders:         []string{"Cookie"},
+		RemoveResponseHeaders: []string{"X-Internal"},
+	})
+	proxy.dial = dial
+
+	router := new(Router)
+	router.Init()
+	router.Use(RequestID())
+	router.Proxy("/users/", proxy)
+	router.Group("/admin", nil, func(group *RouterGroup) {
+		group.Use(func(next HandlerFunc) HandlerFunc {
+			return func(c *HttpContext) {
+				c.RawCtx.SetStatusCode(401)
+			}
+		})
+		group.Proxy("/users", proxy)
+	})
+	handler := HttpHandler("", router)
+
+	ctx := proxyTestRequest(handler, "GET", "http://gateway/users/user/1?a=b", map[string]string{
+		HEADER_REQUEST_ID: "req-1", HEADER_FORWARDED_FOR: "1.2.3.4", "Cookie": "sid=1",
+		"Connection": "X-Hop", "X-Hop": "1",
+	})
+	resp := &ctx.Response
+	if resp.StatusCode() != 200 || string(resp.Body()) != `{"ret":0,"msg":"","data":1}` {
+		t.Fatal(resp.StatusCode(), string(resp.Body()))
+	}
+	if string(resp.Header.Peek("X-Upstream")) != "1" || len(resp.Header.Peek("X-Internal")) > 0 {
+		t.Fatal(resp.Header.String())
+	}
+	n := 0
+	resp.Header.VisitAll(func(k []byte, v []byte) {
+		if strings.EqualFold(string(k), HEADER_REQUEST_ID) {
+			n++
+		}
+	})
+	if n != 1 {
+		t.Fatal("duplicated response header", resp.Header.String())
+	}
+	if ctx := proxyTestRequest(handler, "GET", "http://gateway/admin/users/user/1", nil); ctx.Response.StatusCode() != 401 {
+		t.Fatal("group middleware not applied", ctx.Response.StatusCode())
+	}
+	if ctx := proxyTestRequest(handler, "GET", "http://gateway/usersx", nil); ctx.Response.StatusCode() != 200 ||
+		string(ctx.Response.Body()) != "/usersx" {
+		t.Fatal("prefix must match whole path segments", string(ctx.Response.Body()))
+	}
+}
+
+func TestReverseProxyRetry(t *testing.T) {
+	var calls int32
+	dial, closeFn := newTestServer(func(ctx *fasthttp.RequestCtx) {
+		if atomic.AddInt32(&calls, 1)%2 == 1 {
+			ctx.SetStatusCode(503)
+			return
+		}
+		ctx.SetBodyString(string(ctx.Path()))
+	})
+	defer closeFn()
+	proxy := NewReverseProxy(&ProxyOptions{Upstreams: []string{"http://a:8080", "http://b:8080"},
+		Rewrite: func(path string) string { return "/v2" + path },
+		Retry:   &RetryOptions{MaxAttempts: 2, BaseDelay: time.Millisecond}})
+	proxy.dial = dial
+	router := new(Router)
+	router.Init()
+	router.Proxy("/orders", proxy)
+	handler := HttpHandler("", router)
+
+	ctx := proxyTestRequest(handler, "GET", "http://gateway/orders/1", nil)
+	if ctx.Response.StatusCode() != 200 || string(ctx.Response.Body()) != "/v2/orders/1" || calls != 2 {
+		t.Fatal(ctx.Response.StatusCode(), string(ctx.Response.Body()), calls)
+	}
+	calls = 0
+	ctx = proxyTestRequest(handler, "POST", "http://gateway/orders", nil)
+	if ctx.Response.StatusCode() != 503 || calls != 1 {
+		t.Fatal("non-idempotent request retried", ctx.Response.StatusCode(), calls)
+	}
+}
+
+func TestReverseProxyStreamBody(t *testing.T) {
+	var calls int32
+	dial, closeFn := newTestServer(func(ctx *fasthttp.RequestCtx) {
+		atomic.AddInt32(&calls, 1)
+		ctx.SetStatusCode(503)
+		ctx.SetBodyString(strconv.Itoa(len(ctx.PostBody())))
+	})
+	defer closeFn()
+	proxy := NewReverseProxy(&ProxyOptions{Upstreams: []string{"http://upload"},
+		Retry: &RetryOptions{MaxAttempts: 3, BaseDelay: time.Millisecond}})
+	proxy.dial = dial
+	router := new(Router)
+	router.Init()
+	router.Proxy("/upload", proxy)
+
+	// 请求体超过上限时流式读取, 应完整转发且不重试
+	dial, closeGateway := startTestServer(&fasthttp.Server{Handler: HttpHandler("", router), StreamRequestBody: true,
+		MaxRequestBodySize: 64})
+	defer closeGateway()
+	client := &fasthttp.HostClient{Addr: "gateway", Dial: dial}
+	req := new(fasthttp.Request)
+	resp := new(fasthttp.Response)
+	req.Header.SetMethod("PUT")
+	req.SetRequestURI("http://gateway/upload/a")
+	req.SetBody(bytes.Repeat([]byte("x"), 1000))
+	if err := client.Do(req, resp); err != nil || string(resp.Body()) != "1000" || calls != 1 {
+		t.Fatal(string(resp.Body()), calls, err)
+	}
+	calls = 0
+	req.SetBodyStream(bytes.NewReader(bytes.Repeat([]byte("x"), 1000)), -1)
+	if err := client.Do(req, resp); err != nil || string(resp.Body()) != "1000" || calls != 1 {
+		t.Fatal("chunked body", string(resp.Body()), calls, err)
+	}
+}
+
+func TestReverseProxyErrors(t *testing.T) {
+	dial, closeFn := newTestServer(func(ctx *fasthttp.RequestCtx) {
+		time.Sleep(200 * time.Millisecond)
+	})
+	defer closeFn()
+	router := new(Router)
+	router.Init()
+	slow := NewReverseProxy(&ProxyOptions{Upstreams: []string{"http://slow"}, Timeout: 20 * time.Millisecond})
+	slow.dial = dial
+	router.Proxy("/slow", slow)
+	router.Proxy("/none", NewReverseProxy(&ProxyOptions{}))
+	down := NewReverseProxy(&ProxyOptions{Upstreams: []string{"http://down"}})
+	down.dial = func(addr string) (net.Conn, error) {
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: net.UnknownNetworkError("refused")}
+	}
+	router.Proxy("/down", down)
+	handler := HttpHandler("", router)
+
+	for path, status := range map[string]int{"/slow": 504, "/none": 503, "/down": 502} {
+		if ctx := proxyTestRequest(handler, "GET", "http://gateway"+path, nil); ctx.Response.StatusCode() != status {
+			t.Fatal(path, ctx.Response.StatusCode(), string(ctx.Response.Body()))
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lxf9601/go-common/db"
+	"github.com/lxf9601/go-common/logc"
+)
+
+// 限流结果
+type RateLimitResult struct {
+	Allowed    bool          // 是否放行
+	Limit      int64         // 额度上限
+	Remaining  int64         // 剩余额度
+	ResetAfter time.Duration // 额度恢复所需时间
+	RetryAfter time.Duration // 被拒绝时建议的重试等待时间
+}
+
+// 限流器
+type RateLimiter interface {
+	Allow(key string) (*RateLimitResult, error)
+}
+
+// 限流键函数
+type RateLimitKeyFunc func(ctx *HttpContext) string
+
+// RateLimitByIP 按客户端IP限流
+func RateLimitByIP(ctx *HttpContext) string {
+	return "ip:" + ctx.ClientIP()
+}
+
+// RateLimitByClaim 按鉴权信息中的字段限流, 未鉴权时按客户端IP限流
+func RateLimitByClaim(claim string) RateLimitKeyFunc {
+	return func(ctx *HttpContext) string {
+		if v := ctx.ClaimString(claim); v != "" {
+			return claim + ":" + v
+		}
+		return RateLimitByIP(ctx)
+	}
+}
+
+// 限流配置
+type RateLimitOptions struct {
+	Limiter RateLimiter      // 限流器
+	KeyFunc RateLimitKeyFunc // 限流键, 默认按客户端IP
+	Ret     int              // 被限流时ApiResponse的Ret, 默认429
+	Msg     string           // 被限流时ApiResponse的Msg
+}
+
+// RateLimit 限流中间件, 设置X-RateLimit-*响应头, 超出额度时返回429
+func RateLimit(options *RateLimitOptions) Middleware {
+	keyFunc := options.KeyFunc
+	if keyFunc == nil {
+		keyFunc = RateLimitByIP
+	}
+	ret := options.Ret
+	if ret == 0 {
+		ret = http.StatusTooManyRequests
+	}
+	msg := options.Msg
+	if msg == "" {
+		msg = "too many requests"
+	}
+	return func(next HandlerFunc) HandlerFunc {
+		return func(c *HttpContext) {
+			result, err := options.Limiter.Allow(keyFunc(c))
+			if err != nil {
+				// 限流器不可用时放行, 避免影响正常请求
+				logc.Errorf("rate limit error: %s", err)
+				next(c)
+				return
+			}
+			header := &c.RawCtx.Response.Header
+			header.Set("X-RateLimit-Limit", strconv.FormatInt(result.Limit, 10))
+			header.Set("X-RateLimit-Remaining", strconv.FormatInt(result.Remaining, 10))
+			header.Set("X-RateLimit-Reset", strconv.FormatInt(ceilSeconds(result.ResetAfter), 10))
+			if result.Allowed {
+				next(c)
+				return
+			}
+			header.Set("Retry-After", strconv.FormatInt(ceilSeconds(result.RetryAfter), 10))
+			c.RawCtx.SetStatusCode(http.StatusTooManyRequests)
+			c.SetContentType(CONTENT_TYPE_JSON)
+			j, _ := json.Marshal(&ApiResponse{Ret: ret, Msg: msg})
+			c.RawCtx.SetBody(j)
+		}
+	}
+}
+
+func ceilSeconds(d time.Duration) int64 {
+	if d <= 0 {
+		return 0
+	}
+	return int64(math.Ceil(d.Seconds()))
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// 本地令牌桶限流器, 仅在当前进程内生效
+type TokenBucketLimiter struct {
+	rate      float64 // 每秒生成令牌数
+	burst     int64   // 桶容量
+	buckets   map[string]*tokenBucket
+	lock      sync.Mutex
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewTokenBucketLimiter 创建令牌桶限流器, rate为每秒生成令牌数, burst为桶容量
+// 配置错误时panic, 避免启动后所有请求被放行
+func NewTokenBucketLimiter(rate float64, burst int64) *TokenBucketLimiter {
+	if !(rate > 0) || math.IsInf(rate, 1) || burst < 1 {
+		panic(fmt.Sprintf("ratelimit: invalid token bucket rate %v burst %d", rate, burst))
+	}
+	return &TokenBucketLimiter{rate: rate, burst: burst,
+		buckets: make(map[string]*tokenBucket), now: time.Now}
+}
+
+func (this *TokenBucketLimiter) Allow(key string) (*RateLimitResult, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	now := this.now()
+	this.sweep(now)
+	bucket := this.buckets[key]
+	if bucket == nil {
+		bucket = &tokenBucket{tokens: float64(this.burst), updated: now}
+		this.buckets[key] = bucket
+	} else {
+		elapsed := now.Sub(bucket.updated).Seconds()
+		bucket.tokens = math.Min(float64(this.burst), bucket.tokens+elapsed*this.rate)
+		bucket.updated = now
+	}
+	result := &RateLimitResult{Limit: this.burst}
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = this.duration(1 - bucket.tokens)
+	}
+	result.Remaining = int64(bucket.tokens)
+	result.ResetAfter = this.duration(float64(this.burst) - bucket.tokens)
+	return result, nil
+}
+
+func (this *TokenBucketLimiter) duration(tokens float64) time.Duration {
+	return time.Duration(tokens / this.rate * float64(time.Second))
+}
+
+// sweep 定期清理已回满的令牌桶, 防止键无限增长
+func (this *TokenBucketLimiter) sweep(now time.Time) {
+	if now.Sub(this.lastSweep) < time.Minute {
+		return
+	}
+	this.lastSweep = now
+	full := this.duration(float64(this.burst))
+	for key, bucket := range this.buckets {
+		if now.Sub(bucket.updated) >= full {
+			delete(this.buckets, key)
+		}
+	}
+}
+
+// Redis滑动窗口限流器, 多实例共享额度
+type RedisRateLimiter struct {
+	redis  *db.Redis
+	limit  int64
+	window time.Duration
+}
+
+// NewRedisRateLimiter 创建Redis滑动窗口限流器, window时间内最多允许limit次请求
+// 配置错误时panic, 避免启动后所有请求被放行
+func NewRedisRateLimiter(redis *db.Redis, limit int64, window time.Duration) *RedisRateLimiter {
+	if limit < 1 || window < time.Millisecond {
+		panic(fmt.Sprintf("ratelimit: invalid redis limit %d window %s", limit, window))
+	}
+	return &RedisRateLimiter{redis: redis, limit: limit, window: window}
+}
+
+func (this *RedisRateLimiter) Allow(key string) (*RateLimitResult, error) {
+	allowed, remaining, resetAfter, err := this.redis.SlidingWindow("ratelimit:"+key, this.limit, this.window)
+	if err != nil {
+		return nil, err
+	}
+	result := &RateLimitResult{Allowed: allowed, Limit: this.limit, Remaining: remaining, ResetAfter: resetAfter}
+	if !allowed {
+		result.RetryAfter = resetAfter
+	}
+	return result, nil
+}
@@ -0,0 +1,156 @@
+package http
+
+import (
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+	"github.com/lxf9601/go-common/db"
+	"github.com/valyala/fasthttp"
+)
+
+func TestTokenBucketLimiter(t *testing.T) {
+	now := time.Unix(1000, 0)
+	limiter := NewTokenBucketLimiter(1, 2)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if res, _ := limiter.Allow("k"); !res.Allowed {
+			t.Fatalf("request %d rejected", i)
+		}
+	}
+	res, _ := limiter.Allow("k")
+	if res.Allowed || res.Remaining != 0 || res.RetryAfter != time.Second {
+		t.Fatalf("%+v", res)
+	}
+	if res, _ := limiter.Allow("other"); !res.Allowed {
+		t.Fatal("keys must not share buckets")
+	}
+
+	now = now.Add(1500 * time.Millisecond)
+	res, _ = limiter.Allow("k")
+	if !res.Allowed || res.Remaining != 0 || res.ResetAfter != 1500*time.Millisecond {
+		t.Fatalf("%+v", res)
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	limiter := NewTokenBucketLimiter(0.5, 1)
+	handler := chain(func(c *HttpContext) {
+		c.RawCtx.SetBodyString("ok")
+	}, []Middleware{RateLimit(&RateLimitOptions{Limiter: limiter})})
+
+	do := func() *fasthttp.RequestCtx {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Init(&fasthttp.Request{}, &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1)}, nil)
+		handler(&HttpContext{RawCtx: ctx})
+		return ctx
+	}
+	ctx := do()
+	if ctx.Response.StatusCode() != 200 || string(ctx.Response.Header.Peek("X-RateLimit-Limit")) != "1" ||
+		string(ctx.Response.Header.Peek("X-RateLimit-Remaining")) != "0" {
+		t.Fatal(ctx.Response.String())
+	}
+	ctx = do()
+	if ctx.Response.StatusCode() != 429 || string(ctx.Response.Header.Peek("Retry-After")) != "2" {
+		t.Fatal(ctx.Response.String())
+	}
+	if string(ctx.Response.Body()) != `{"ret":429,"msg":"too many requests","data":null}` {
+		t.Fatal(string(ctx.Response.Body()))
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	router := new(Router)
+	if err := router.TrustProxies("10.0.0.0/8", "192.168.1.1"); err != nil {
+		t.Fatal(err)
+	}
+	if router.TrustProxies("bad") == nil {
+		t.Fatal("invalid proxy accepted")
+	}
+	clientIP := func(remote net.IP, headers map[string]string) string {
+		req := &fasthttp.Request{}
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Init(req, &net.TCPAddr{IP: remote}, nil)
+		return (&HttpContext{RawCtx: ctx, trustedProxies: router.trustedProxies}).ClientIP()
+	}
+	spoofed := map[string]string{"X-Forwarded-For": "1.1.1.1", "X-Real-IP": "2.2.2.2"}
+	if ip := clientIP(net.IPv4(8, 8, 8, 8), spoofed); ip != "8.8.8.8" {
+		t.Fatal("forwarded headers from an untrusted peer used", ip)
+	}
+	if ip := clientIP(net.IPv4(10, 0, 0, 1), map[string]string{"X-Forwarded-For": "1.1.1.1, 3.3.3.3, 192.168.1.1"}); ip != "3.3.3.3" {
+		t.Fatal("first untrusted hop from the right expected", ip)
+	}
+	if ip := clientIP(net.IPv4(10, 0, 0, 1), map[string]string{"X-Real-IP": "2.2.2.2"}); ip != "2.2.2.2" {
+		t.Fatal(ip)
+	}
+	if ip := clientIP(net.IPv4(10, 0, 0, 1), nil); ip != "10.0.0.1" {
+		t.Fatal(ip)
+	}
+}
+
+func TestRedisRateLimiter(t *testing.T) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+	rdb := &db.Redis{Client: client, KeyPrefix: "test:"}
+	limiter := NewRedisRateLimiter(rdb, 2, 100*time.Millisecond)
+
+	for i := 0; i < 2; i++ {
+		res, err := limiter.Allow("k")
+		if err != nil || !res.Allowed || res.Remaining != int64(1-i) {
+			t.Fatalf("request %d: %+v %v", i, res, err)
+		}
+	}
+	res, err := limiter.Allow("k")
+	if err != nil || res.Allowed || res.RetryAfter <= 0 || res.RetryAfter > 100*time.Millisecond {
+		t.Fatalf("%+v %v", res, err)
+	}
+	if res, _ := limiter.Allow("other"); !res.Allowed {
+		t.Fatal("keys must not share windows")
+	}
+	if !server.Exists("test:ratelimit:k") {
+		t.Fatal(server.Keys())
+	}
+
+	time.Sleep(110 * time.Millisecond)
+	if res, err := limiter.Allow("k"); err != nil || !res.Allowed {
+		t.Fatalf("window did not expire: %+v %v", res, err)
+	}
+
+}
+
+func TestRateLimiterValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func()
+	}{
+		{"zero rate", func() { NewTokenBucketLimiter(0, 1) }},
+		{"negative rate", func() { NewTokenBucketLimiter(-1, 1) }},
+		{"NaN rate", func() { NewTokenBucketLimiter(math.NaN(), 1) }},
+		{"zero burst", func() { NewTokenBucketLimiter(1, 0) }},
+		{"zero limit", func() { NewRedisRateLimiter(nil, 0, time.Second) }},
+		{"zero window", func() { NewRedisRateLimiter(nil, 1, 0) }},
+		{"sub-millisecond window", func() { NewRedisRateLimiter(nil, 1, time.Microsecond) }},
+	}
+	for _, test := range tests {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: accepted", test.name)
+				}
+			}()
+			test.fn()
+		}()
+	}
+}
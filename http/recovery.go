@@ -0,0 +1,74 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	comm "github.com/lxf9601/go-common"
+)
+
+// 异常上报函数, 用于对接错误跟踪系统
+type PanicReporter func(ctx *HttpContext, err interface{}, stack []byte)
+
+// 异常恢复配置
+type RecoveryOptions struct {
+	Reporter PanicReporter // 异常上报, 可为空
+	Ret      int           // 响应ApiResponse的Ret, 默认500
+	Msg      string        // 响应ApiResponse的Msg
+}
+
+// Recovery 异常恢复中间件, 记录调用栈并返回500 ApiResponse
+func Recovery(options *RecoveryOptions) Middleware {
+	ret := options.Ret
+	if ret == 0 {
+		ret = http.StatusInternalServerError
+	}
+	msg := options.Msg
+	if msg == "" {
+		msg = "internal server error"
+	}
+	return func(next HandlerFunc) HandlerFunc {
+		return func(c *HttpContext) {
+			defer func() {
+				if err := recover(); err != nil {
+					stack := comm.PanicTrace(4)
+					c.Logger().Errorf("panic: %v\n%s", err, stack)
+					if options.Reporter != nil {
+						reportPanic(options.Reporter, c, err, stack)
+					}
+					writePanicResponse(c, ret, msg)
+				}
+			}()
+			next(c)
+		}
+	}
+}
+
+// reportPanic 调用上报函数, 上报失败不影响响应
+func reportPanic(reporter PanicReporter, c *HttpContext, err interface{}, stack []byte) {
+	defer func() {
+		if e := recover(); e != nil {
+			c.Logger().Errorf("panic reporter: %v", e)
+		}
+	}()
+	reporter(c, err, stack)
+}
+
+// writePanicResponse 丢弃已写入的响应体, 改为500 ApiResponse
+func writePanicResponse(c *HttpContext, ret int, msg string) {
+	ctx := c.RawCtx
+	ctx.Response.ResetBody()
+	ctx.Response.Header.Del("Content-Encoding")
+	ctx.SetStatusCode(http.StatusInternalServerError)
+	c.SetContentType(CONTENT_TYPE_JSON)
+	res := &ApiResponse{Ret: ret, Msg: msg}
+	if c.RequestID() != "" {
+		res.Data = map[string]string{"request_id": c.RequestID()}
+	}
+	j, err := json.Marshal(res)
+	if err != nil {
+		j = []byte(fmt.Sprintf(`{"ret":%d,"msg":"internal server error","data":null}`, ret))
+	}
+	ctx.SetBody(j)
+}
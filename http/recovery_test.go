@@ -0,0 +1,57 @@
+package http
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestRecovery(t *testing.T) {
+	var reported interface{}
+	var stack []byte
+	router := new(Router)
+	router.Init()
+	router.Use(RequestID(), Recovery(&RecoveryOptions{Reporter: func(c *HttpContext, err interface{}, s []byte) {
+		reported = err
+		stack = s
+	}}))
+	router.HandleFunc("/boom", func(c *HttpContext) {
+		c.RawCtx.SetBodyString("partial")
+		panic("boom")
+	})
+	handler := HttpHandler("", router)
+
+	req := fasthttp.AcquireRequest()
+	req.SetRequestURI("/boom")
+	req.Header.Set(HEADER_REQUEST_ID, "req-1")
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Init(req, nil, nil)
+	handler(ctx)
+
+	if ctx.Response.StatusCode() != 500 {
+		t.Fatal(ctx.Response.StatusCode())
+	}
+	if string(ctx.Response.Body()) != `{"ret":500,"msg":"internal server error","data":{"request_id":"req-1"}}` {
+		t.Fatal(string(ctx.Response.Body()))
+	}
+	if reported != "boom" || !strings.Contains(strings.SplitN(string(stack), "\n", 2)[0], "TestRecovery") {
+		t.Fatalf("%v\n%s", reported, stack)
+	}
+}
+
+func TestHttpHandlerPanicWithoutRecovery(t *testing.T) {
+	router := new(Router)
+	router.Init()
+	router.HandleFunc("/boom", func(c *HttpContext) {
+		panic("boom")
+	})
+	req := fasthttp.AcquireRequest()
+	req.SetRequestURI("/boom")
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Init(req, nil, nil)
+	HttpHandler("", router)(ctx)
+	if ctx.Response.StatusCode() != 500 {
+		t.Fatal(ctx.Response.StatusCode())
+	}
+}
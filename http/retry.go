@@ -0,0 +1,127 @@
+package http
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	defaultRetryBaseDelay = 100 * time.Millisecond
+	defaultRetryMaxDelay  = 2 * time.Second
+)
+
+// 重试配置, 默认只重试幂等请求
+type RetryOptions struct {
+	MaxAttempts        int           // 最大尝试次数(含首次), 小于2时不重试
+	BaseDelay          time.Duration // 首次重试的退避上限, 之后每次翻倍, 默认100毫秒
+	MaxDelay           time.Duration // 退避上限, 默认2秒
+	RetryStatus        []int         // 需重试的状态码, 默认429、502、503、504
+	RetryNonIdempotent bool          // 是否重试POST、PATCH等非幂等请求
+}
+
+func normalizeRetryOptions(options *RetryOptions) *RetryOptions {
+	if options == nil || options.MaxAttempts < 2 {
+		return nil
+	}
+	opts := *options
+	if opts.BaseDelay <= 0 {
+		opts.BaseDelay = defaultRetryBaseDelay
+	}
+	if opts.MaxDelay <= 0 {
+		opts.MaxDelay = defaultRetryMaxDelay
+	}
+	if opts.MaxDelay < opts.BaseDelay {
+		opts.MaxDelay = opts.BaseDelay
+	}
+	if opts.RetryStatus == nil {
+		opts.RetryStatus = []int{http.StatusTooManyRequests, http.StatusBadGateway,
+			http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+	}
+	return &opts
+}
+
+// idempotentMethod 按HTTP语义幂等的方法
+func idempotentMethod(method string) bool {
+	switch method {
+	case fasthttp.MethodGet, fasthttp.MethodHead, fasthttp.MethodOptions,
+		fasthttp.MethodPut, fasthttp.MethodDelete, fasthttp.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// retryable 判断错误是否可重试, 上下文取消、熔断和舱壁拒绝不重试
+func (this *RetryOptions) retryable(err error) bool {
+	switch e := err.(type) {
+	case nil, *ApiError:
+		return false
+	case *StatusError:
+		for _, status := range this.RetryStatus {
+			if status == e.StatusCode {
+				return true
+			}
+		}
+		return false
+	}
+	switch err {
+	case context.Canceled, context.DeadlineExceeded, ErrCircuitOpen, ErrBulkheadFull:
+		return false
+	}
+	return true
+}
+
+// backoff 第attempt次重试前的等待时间, 指数退避加全抖动, 服务端Retry-After优先
+func (this *RetryOptions) backoff(attempt int, err error) time.Duration {
+	if e, ok := err.(*StatusError); ok && e.RetryAfter > 0 {
+		if e.RetryAfter > this.MaxDelay {
+			return this.MaxDelay
+		}
+		return e.RetryAfter
+	}
+	ceiling := this.MaxDelay
+	if attempt < 31 {
+		if d := this.BaseDelay << uint(attempt-1); d > 0 && d < ceiling {
+			ceiling = d
+		}
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// parseRetryAfter 解析Retry-After响应头, 支持秒数和HTTP日期
+func parseRetryAfter(value []byte) time.Duration {
+	if len(value) == 0 {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(string(value)); err == nil {
+		if seconds > 0 {
+			return time.Duration(seconds) * time.Second
+		}
+		return 0
+	}
+	if t, err := http.ParseTime(string(value)); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// sleepContext 等待d, ctx结束时提前返回错误
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
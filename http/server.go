@@ -0,0 +1,312 @@
+package http
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/lxf9601/go-common/db"
+	"github.com/lxf9601/go-common/logc"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	defaultReadTimeout        = 30 * time.Second
+	defaultWriteTimeout       = 30 * time.Second
+	defaultIdleTimeout        = 120 * time.Second
+	defaultShutdownTimeout    = 30 * time.Second
+	defaultMaxRequestBodySize = 4 * 1024 * 1024
+	// 与Kubernetes探针默认超时一致
+	defaultReadyCheckTimeout = time.Second
+)
+
+var (
+	errShutdownTimeout = errors.New("http server shutdown timeout")
+	errTLSConfig       = errors.New("http server: CertFile and KeyFile must be set together")
+	errMutualTLSConfig = errors.New("http server: ClientCAFile requires CertFile and KeyFile")
+)
+
+// 服务配置
+type ServerOptions struct {
+	Addr               string        // 监听地址
+	AppPath            string        // 应用路径, 用于静态文件和模板
+	Name               string        // Server响应头
+	ReadTimeout        time.Duration // 读取请求超时, 默认30秒
+	WriteTimeout       time.Duration // 写入响应超时, 默认30秒, 负数不限制
+	IdleTimeout        time.Duration // 长连接空闲超时, 默认120秒
+	MaxRequestBodySize int           // 请求体大小上限, 默认4MB
+	StreamRequestBody  bool          // 流式读取超过上限的请求体, 大文件上传时开启
+	ShutdownTimeout    time.Duration // 优雅退出等待时间, 默认30秒
+	CertFile           string        // TLS证书文件
+	KeyFile            string        // TLS私钥文件
+	ClientCAFile       string        // 校验客户端证书的CA文件, 设置后启用双向TLS, 要求客户端出示证书, 须同时设置CertFile和KeyFile
+	HealthPath         string        // 存活检查路径, 默认/healthz
+	ReadyPath          string        // 就绪检查路径, 默认/readyz
+	ReadyCheckTimeout  time.Duration // 单个就绪检查的超时时间, 默认1秒
+}
+
+// 健康检查, 返回错误表示不可用, AMQP会话可使用session.HealthCheck
+type HealthCheck func() error
+
+// RedisHealthCheck 检查Redis连接
+func RedisHealthCheck(redis *db.Redis) HealthCheck {
+	return func() error {
+		return redis.Client.Ping().Err()
+	}
+}
+
+// HTTP服务, 封装超时设置、健康检查及优雅退出
+type Server struct {
+	options      *ServerOptions
+	server       *fasthttp.Server
+	checks       map[string]HealthCheck
+	hooks        []func()
+	lock         sync.RWMutex
+	shuttingDown int32
+	stop         chan struct{}
+	stopOnce     sync.Once
+}
+
+// NewServer 创建HTTP服务, 存活与就绪检查在路由之前处理, 不经过全局中间件
+func NewServer(router *Router, options *ServerOptions) *Server {
+	opts := *options
+	if opts.ReadTimeout == 0 {
+		opts.ReadTimeout = defaultReadTimeout
+	}
+	if opts.WriteTimeout == 0 {
+		opts.WriteTimeout = defaultWriteTimeout
+	} else if opts.WriteTimeout < 0 {
+		// 长时间的SSE等流式响应不能受写超时限制
+		opts.WriteTimeout = 0
+	}
+	if opts.IdleTimeout == 0 {
+		opts.IdleTimeout = defaultIdleTimeout
+	}
+	if opts.ShutdownTimeout == 0 {
+		opts.ShutdownTimeout = defaultShutdownTimeout
+	}
+	if opts.MaxRequestBodySize == 0 {
+		opts.MaxRequestBodySize = defaultMaxRequestBodySize
+	}
+	if opts.HealthPath == "" {
+		opts.HealthPath = "/healthz"
+	}
+	if opts.ReadyPath == "" {
+		opts.ReadyPath = "/readyz"
+	}
+	if opts.ReadyCheckTimeout <= 0 {
+		opts.ReadyCheckTimeout = defaultReadyCheckTimeout
+	}
+	server := &Server{options: &opts, checks: make(map[string]HealthCheck), stop: make(chan struct{})}
+	server.server = &fasthttp.Server{
+		Handler:            server.probe(HttpHandler(opts.AppPath, router)),
+		Name:               opts.Name,
+		ReadTimeout:        opts.ReadTimeout,
+		WriteTimeout:       opts.WriteTimeout,
+		IdleTimeout:        opts.IdleTimeout,
+		MaxRequestBodySize: opts.MaxRequestBodySize,
+		StreamRequestBody:  opts.StreamRequestBody,
+		// 流式读取时由HttpContext.Upload解析multipart, 避免预先写入临时文件
+		DisablePreParseMultipartForm: opts.StreamRequestBody,
+		CloseOnShutdown:              true,
+	}
+	return server
+}
+
+// AddReadyCheck 添加就绪检查
+func (this *Server) AddReadyCheck(name string, check HealthCheck) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.checks[name] = check
+}
+
+// OnShutdown 添加退出回调, 在请求处理完毕后按添加顺序执行
+func (this *Server) OnShutdown(hook func()) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.hooks = append(this.hooks, hook)
+}
+
+// ListenAndServe 监听并提供服务, 收到SIGINT/SIGTERM后优雅退出
+func (this *Server) ListenAndServe() error {
+	ln, err := net.Listen("tcp", this.options.Addr)
+	if err != nil {
+		return err
+	}
+	return this.Serve(ln)
+}
+
+// Serve 在指定监听上提供服务, 收到SIGINT/SIGTERM或调用Shutdown后优雅退出
+func (this *Server) Serve(ln net.Listener) error {
+	if (this.options.CertFile == "") != (this.options.KeyFile == "") {
+		return errTLSConfig
+	}
+	if this.options.ClientCAFile != "" {
+		if this.options.CertFile == "" {
+			// 未配置服务端证书时无法校验客户端证书, 不能退化为明文服务
+			return errMutualTLSConfig
+		}
+		pool, err := loadCertPool(this.options.ClientCAFile)
+		if err != nil {
+			return err
+		}
+		this.server.TLSConfig = &tls.Config{ClientCAs: pool, ClientAuth: tls.RequireAndVerifyClientCert,
+			MinVersion: tls.VersionTLS12}
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		if this.options.CertFile != "" && this.options.KeyFile != "" {
+			errCh <- this.server.ServeTLS(ln, this.options.CertFile, this.options.KeyFile)
+		} else {
+			errCh <- this.server.Serve(ln)
+		}
+	}()
+	logc.Infof("http server listening on %s", ln.Addr())
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	select {
+	case err := <-errCh:
+		return err
+	case sig := <-signals:
+		logc.Infof("http server received %s, shutting down", sig)
+	case <-this.stop:
+		logc.Info("http server shutting down")
+	}
+	return this.drain()
+}
+
+// Shutdown 触发优雅退出, Serve在请求处理完毕后返回
+func (this *Server) Shutdown() {
+	this.stopOnce.Do(func() {
+		close(this.stop)
+	})
+}
+
+// IsShuttingDown 是否正在退出
+func (this *Server) IsShuttingDown() bool {
+	return atomic.LoadInt32(&this.shuttingDown) == 1
+}
+
+// drain 停止接收新连接并等待处理中的请求完成
+func (this *Server) drain() error {
+	atomic.StoreInt32(&this.shuttingDown, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- this.server.Shutdown()
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-time.After(this.options.ShutdownTimeout):
+		err = errShutdownTimeout
+	}
+	this.lock.RLock()
+	hooks := this.hooks
+	this.lock.RUnlock()
+	for _, hook := range hooks {
+		hook()
+	}
+	if err != nil {
+		logc.Errorf("http server shutdown: %s", err)
+	} else {
+		logc.Info("http server stopped")
+	}
+	return err
+}
+
+// probe 探针请求不经过鉴权、签名、限流等中间件, 避免探针被拒绝或计入限流
+func (this *Server) probe(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		switch string(ctx.Path()) {
+		case this.options.HealthPath:
+			this.healthz(ctx)
+		case this.options.ReadyPath:
+			this.readyz(ctx)
+		default:
+			next(ctx)
+		}
+	}
+}
+
+func (this *Server) healthz(ctx *fasthttp.RequestCtx) {
+	writeHealth(ctx, http.StatusOK, nil)
+}
+
+type readyResult struct {
+	name string
+	err  error
+}
+
+// readyz 并发执行就绪检查, 超时未返回的检查视为失败
+func (this *Server) readyz(ctx *fasthttp.RequestCtx) {
+	if this.IsShuttingDown() {
+		writeHealth(ctx, http.StatusServiceUnavailable, map[string]string{"server": "shutting down"})
+		return
+	}
+	this.lock.RLock()
+	checks := make(map[string]HealthCheck, len(this.checks))
+	for name, check := range this.checks {
+		checks[name] = check
+	}
+	this.lock.RUnlock()
+	results := make(chan readyResult, len(checks))
+	for name, check := range checks {
+		go func(name string, check HealthCheck) {
+			defer func() {
+				if err := recover(); err != nil {
+					results <- readyResult{name, fmt.Errorf("panic: %v", err)}
+				}
+			}()
+			results <- readyResult{name, check()}
+		}(name, check)
+	}
+	timer := time.NewTimer(this.options.ReadyCheckTimeout)
+	defer timer.Stop()
+	status := http.StatusOK
+	result := make(map[string]string, len(checks))
+wait:
+	for range checks {
+		select {
+		case res := <-results:
+			if res.err != nil {
+				status = http.StatusServiceUnavailable
+				result[res.name] = res.err.Error()
+			} else {
+				result[res.name] = "ok"
+			}
+		case <-timer.C:
+			break wait
+		}
+	}
+	for name := range checks {
+		if _, ok := result[name]; !ok {
+			status = http.StatusServiceUnavailable
+			result[name] = "timeout"
+		}
+	}
+	writeHealth(ctx, status, result)
+}
+
+func writeHealth(ctx *fasthttp.RequestCtx, status int, checks map[string]string) {
+	res := &ApiResponse{Data: checks}
+	if status != http.StatusOK {
+		res.Ret = status
+		res.Msg = http.StatusText(status)
+	}
+	j, _ := json.Marshal(res)
+	ctx.SetStatusCode(status)
+	ctx.SetContentType(CONTENT_TYPE_JSON)
+	ctx.SetBody(j)
+}
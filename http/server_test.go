@@ -0,0 +1,93 @@
+package http
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+)
+
+func TestServerHealthAndShutdown(t *testing.T) {
+	router := new(Router)
+	router.Init()
+	// 探针不经过全局中间件
+	router.Use(func(next HandlerFunc) HandlerFunc {
+		return func(c *HttpContext) {
+			c.RawCtx.SetStatusCode(401)
+		}
+	})
+	server := NewServer(router, &ServerOptions{ShutdownTimeout: 5 * time.Second, ReadyCheckTimeout: 50 * time.Millisecond})
+	server.AddReadyCheck("redis", func() error { return nil })
+	server.AddReadyCheck("amqp", func() error { return errors.New("amqp session not ready") })
+	hung := make(chan struct{})
+	defer close(hung)
+	server.AddReadyCheck("db", func() error {
+		<-hung
+		return nil
+	})
+	hooked := false
+	server.OnShutdown(func() { hooked = true })
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(ln)
+	}()
+	url := "http://" + ln.Addr().String()
+
+	status, body, err := fasthttp.Get(nil, url+"/healthz")
+	if err != nil || status != 200 {
+		t.Fatal(status, err)
+	}
+	start := time.Now()
+	status, body, err = fasthttp.Get(nil, url+"/readyz")
+	if err != nil || status != 503 || string(body) !=
+		`{"ret":503,"msg":"Service Unavailable","data":{"amqp":"amqp session not ready","db":"timeout","redis":"ok"}}` {
+		t.Fatal(status, string(body), err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("hung check blocked the probe")
+	}
+	if status, _, err = fasthttp.Get(nil, url+"/other"); err != nil || status != 401 {
+		t.Fatal("middleware not applied to other routes", status, err)
+	}
+
+	server.Shutdown()
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not stop")
+	}
+	if !hooked || !server.IsShuttingDown() {
+		t.Fatal("shutdown hook not called")
+	}
+}
+
+// startTestServer 在内存监听上启动服务, 返回连接该服务的Dial函数及关闭函数
+func startTestServer(server *fasthttp.Server) (fasthttp.DialFunc, func()) {
+	ln := fasthttputil.NewInmemoryListener()
+	go server.Serve(ln)
+	return func(addr string) (net.Conn, error) {
+		return ln.Dial()
+	}, func() { ln.Close() }
+}
+
+// newTestServer 以默认配置启动处理handler的内存服务
+func newTestServer(handler fasthttp.RequestHandler) (fasthttp.DialFunc, func()) {
+	return startTestServer(&fasthttp.Server{Handler: handler})
+}
+
+// newTestClient 启动内存服务并返回连接它的客户端
+func newTestClient(handler fasthttp.RequestHandler) (*fasthttp.HostClient, func()) {
+	dial, closeFn := newTestServer(handler)
+	return &fasthttp.HostClient{Addr: "test", Dial: dial}, closeFn
+}
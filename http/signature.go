@@ -0,0 +1,189 @@
+package http
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lxf9601/go-common/db"
+	"github.com/valyala/fasthttp"
+)
+
+// 请求签名请求头
+const (
+	HEADER_SIGNATURE_KEY       = "X-Signature-Key"
+	HEADER_SIGNATURE_TIMESTAMP = "X-Signature-Timestamp"
+	HEADER_SIGNATURE_NONCE     = "X-Signature-Nonce"
+	HEADER_SIGNATURE           = "X-Signature"
+)
+
+const (
+	defaultSignatureMaxSkew     = 5 * time.Minute
+	defaultSignatureNoncePrefix = "signature:nonce:"
+	maxSignatureNonceLen        = 64
+)
+
+var (
+	ErrSignatureMissing = errors.New("signature missing")
+	ErrSignatureKey     = errors.New("signature key unknown")
+	ErrSignatureExpired = errors.New("signature timestamp out of range")
+	ErrSignatureInvalid = errors.New("signature invalid")
+	ErrSignatureReplay  = errors.New("signature nonce reused")
+)
+
+// 请求签名密钥
+type SignerOptions struct {
+	KeyID  string // 密钥ID, 服务端据此查找密钥
+	Secret string // 密钥
+}
+
+// signatureString 待签名字符串: 方法、请求路径及查询参数、时间戳、nonce、请求体SHA256
+func signatureString(method []byte, requestUri []byte, timestamp string, nonce string, body []byte) string {
+	hash := sha256.Sum256(body)
+	return strings.Join([]string{string(method), string(requestUri), timestamp, nonce, hex.EncodeToString(hash[:])}, "\n")
+}
+
+func signature(secret string, s string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(s))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// SignRequest 使用HMAC-SHA256为请求签名, 需在设置请求体后调用
+func SignRequest(req *fasthttp.Request, keyId string, secret string) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := NewRequestID()
+	req.Header.Set(HEADER_SIGNATURE_KEY, keyId)
+	req.Header.Set(HEADER_SIGNATURE_TIMESTAMP, timestamp)
+	req.Header.Set(HEADER_SIGNATURE_NONCE, nonce)
+	req.Header.Set(HEADER_SIGNATURE, signature(secret,
+		signatureString(req.Header.Method(), req.URI().RequestURI(), timestamp, nonce, req.Body())))
+}
+
+// 签名校验配置
+type SignatureOptions struct {
+	Keys        map[string]string // 密钥ID到密钥
+	MaxSkew     time.Duration     // 允许的时间偏差, 默认5分钟
+	Redis       *db.Redis         // 保存已使用的nonce, 为空时保存在进程内, 多实例部署时需设置
+	NoncePrefix string            // nonce键前缀, 默认signature:nonce:
+	Ret         int               // 校验失败时ApiResponse的Ret, 默认401
+	Msg         string            // 校验失败时ApiResponse的Msg, 默认为错误信息
+}
+
+// VerifySignature 请求签名校验中间件, 校验时间戳、HMAC签名并拒绝重复的nonce
+// 通过后可用HttpContext.SignatureKey获取调用方的密钥ID
+func VerifySignature(options *SignatureOptions) Middleware {
+	maxSkew := options.MaxSkew
+	if maxSkew <= 0 {
+		maxSkew = defaultSignatureMaxSkew
+	}
+	prefix := options.NoncePrefix
+	if prefix == "" {
+		prefix = defaultSignatureNoncePrefix
+	}
+	ret := options.Ret
+	if ret == 0 {
+		ret = http.StatusUnauthorized
+	}
+	nonces := &nonceCache{redis: options.Redis, prefix: prefix, items: make(map[string]time.Time)}
+	return func(next HandlerFunc) HandlerFunc {
+		return func(c *HttpContext) {
+			keyId, err := verifySignature(c, options.Keys, maxSkew, nonces)
+			if err == nil {
+				c.signatureKey = keyId
+				c.SetLogger(c.Logger().WithField("signature_key", keyId))
+				next(c)
+				return
+			}
+			c.Logger().Warnf("verify signature: %s", err)
+			msg := options.Msg
+			if msg == "" {
+				msg = err.Error()
+			}
+			c.RawCtx.SetStatusCode(http.StatusUnauthorized)
+			c.SetContentType(CONTENT_TYPE_JSON)
+			j, _ := json.Marshal(&ApiResponse{Ret: ret, Msg: msg})
+			c.RawCtx.SetBody(j)
+		}
+	}
+}
+
+func verifySignature(c *HttpContext, keys map[string]string, maxSkew time.Duration, nonces *nonceCache) (string, error) {
+	header := &c.RawCtx.Request.Header
+	keyId := string(header.Peek(HEADER_SIGNATURE_KEY))
+	timestamp := string(header.Peek(HEADER_SIGNATURE_TIMESTAMP))
+	nonce := string(header.Peek(HEADER_SIGNATURE_NONCE))
+	sign := string(header.Peek(HEADER_SIGNATURE))
+	if keyId == "" || timestamp == "" || nonce == "" || sign == "" || len(nonce) > maxSignatureNonceLen {
+		return "", ErrSignatureMissing
+	}
+	secret, ok := keys[keyId]
+	if !ok {
+		return "", ErrSignatureKey
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return "", ErrSignatureExpired
+	}
+	if skew := time.Since(time.Unix(ts, 0)); skew > maxSkew || skew < -maxSkew {
+		return "", ErrSignatureExpired
+	}
+	expected := signature(secret, signatureString(header.Method(), c.RawCtx.RequestURI(), timestamp, nonce, c.RawCtx.PostBody()))
+	if !hmac.Equal([]byte(expected), []byte(sign)) {
+		return "", ErrSignatureInvalid
+	}
+	// 时间戳范围外的请求已被拒绝, nonce只需保存两倍时间偏差
+	added, err := nonces.add(keyId+":"+nonce, 2*maxSkew)
+	if err != nil {
+		return "", err
+	}
+	if !added {
+		return "", ErrSignatureReplay
+	}
+	return keyId, nil
+}
+
+// SignatureKey 请求签名的密钥ID, 未经VerifySignature校验时为空
+func (this *HttpContext) SignatureKey() string {
+	return this.signatureKey
+}
+
+// 已使用的nonce, 优先保存在Redis
+type nonceCache struct {
+	redis  *db.Redis
+	prefix string
+	lock   sync.Mutex
+	items  map[string]time.Time
+	purged time.Time
+}
+
+// add 保存nonce, 已存在时返回false
+func (this *nonceCache) add(nonce string, ttl time.Duration) (bool, error) {
+	if this.redis != nil {
+		return this.redis.SetNX(this.prefix+nonce, 1, ttl).Result()
+	}
+	now := time.Now()
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if now.Sub(this.purged) > ttl {
+		for k, expires := range this.items {
+			if now.After(expires) {
+				delete(this.items, k)
+			}
+		}
+		this.purged = now
+	}
+	if expires, ok := this.items[nonce]; ok && now.Before(expires) {
+		return false, nil
+	}
+	this.items[nonce] = now.Add(ttl)
+	return true, nil
+}
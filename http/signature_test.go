@@ -0,0 +1,105 @@
+package http
+
+import (
+	"context"
+
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+	"github.com/lxf9601/go-common/db"
+	"github.com/valyala/fasthttp"
+)
+
+func newSignatureTestApi(t *testing.T, options *SignatureOptions, signer *SignerOptions) (*MicroSrvApi, func(req *fasthttp.Request) *fasthttp.Response, func()) {
+	router := new(Router)
+	router.Init()
+	router.Use(VerifySignature(options))
+	router.HandleFunc("/api/order", func(c *HttpContext) {
+		c.RawCtx.SetBodyString(`{"ret":0,"msg":"","data":"` + c.SignatureKey() + `"}`)
+	})
+	dial, closeFn := newTestServer(HttpHandler("", router))
+	api := NewMicroSrvApi(&MicroSrvApiOptions{Url: "http://order", Signer: signer})
+	api.client.Dial = dial
+	send := func(req *fasthttp.Request) *fasthttp.Response {
+		rep := fasthttp.AcquireResponse()
+		if err := api.client.Do(req, rep); err != nil {
+			t.Fatal(err)
+		}
+		return rep
+	}
+	return api, send, closeFn
+}
+
+func TestVerifySignature(t *testing.T) {
+	keys := map[string]string{"user-service": "secret"}
+	api, send, closeFn := newSignatureTestApi(t, &SignatureOptions{Keys: keys},
+		&SignerOptions{KeyID: "user-service", Secret: "secret"})
+	defer closeFn()
+
+	var caller string
+	if _, err := api.NewRequest("POST", "/api/order").Query("id", "1").JSON(map[string]int{"n": 1}).Do(context.Background(), &caller); err != nil || caller != "user-service" {
+		t.Fatal(err, caller)
+	}
+
+	req := fasthttp.AcquireRequest()
+	req.Header.SetMethod("POST")
+	req.SetRequestURI("http://order/api/order?id=1")
+	req.SetBodyString(`{"n":1}`)
+	if rep := send(req); rep.StatusCode() != 401 {
+		t.Fatal("unsigned request accepted")
+	}
+
+	SignRequest(req, "user-service", "secret")
+	if rep := send(req); rep.StatusCode() != 200 {
+		t.Fatal(rep.StatusCode(), string(rep.Body()))
+	}
+	if rep := send(req); rep.StatusCode() != 401 || string(rep.Body()) != `{"ret":401,"msg":"signature nonce reused","data":null}` {
+		t.Fatal("replayed request accepted", string(rep.Body()))
+	}
+
+	SignRequest(req, "user-service", "secret")
+	req.SetBodyString(`{"n":2}`)
+	if rep := send(req); rep.StatusCode() != 401 {
+		t.Fatal("tampered body accepted")
+	}
+
+	SignRequest(req, "user-service", "wrong")
+	if rep := send(req); rep.StatusCode() != 401 {
+		t.Fatal("wrong secret accepted")
+	}
+
+	SignRequest(req, "user-service", "secret")
+	req.Header.Set(HEADER_SIGNATURE_TIMESTAMP, strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10))
+	if rep := send(req); rep.StatusCode() != 401 || string(rep.Body()) != `{"ret":401,"msg":"signature timestamp out of range","data":null}` {
+		t.Fatal("expired request accepted", string(rep.Body()))
+	}
+}
+
+func TestVerifySignatureRedisNonce(t *testing.T) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+	options := &SignatureOptions{Keys: map[string]string{"k": "s"}, Redis: &db.Redis{Client: client, KeyPrefix: "test:"}}
+	_, send, closeFn := newSignatureTestApi(t, options, nil)
+	defer closeFn()
+
+	req := fasthttp.AcquireRequest()
+	req.SetRequestURI("http://order/api/order")
+	SignRequest(req, "k", "s")
+	if rep := send(req); rep.StatusCode() != 200 {
+		t.Fatal(rep.StatusCode(), string(rep.Body()))
+	}
+	if !server.Exists("test:" + defaultSignatureNoncePrefix + "k:" + string(req.Header.Peek(HEADER_SIGNATURE_NONCE))) {
+		t.Fatal(server.Keys())
+	}
+	if rep := send(req); rep.StatusCode() != 401 {
+		t.Fatal("replayed request accepted")
+	}
+}
@@ -0,0 +1,342 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	comm "github.com/lxf9601/go-common"
+)
+
+const (
+	CONTENT_TYPE_SSE    = "text/event-stream; charset=utf-8"
+	CONTENT_TYPE_NDJSON = "application/x-ndjson; charset=utf-8"
+	CONTENT_TYPE_CSV    = "text/csv; charset=utf-8"
+
+	HEADER_LAST_EVENT_ID = "Last-Event-ID"
+
+	defaultSSEKeepAlive = 15 * time.Second
+	// NDJSON/CSV每写入多少条记录刷新一次
+	streamFlushEvery = 64
+)
+
+// 客户端断开或服务关闭后继续写入时返回
+var ErrStreamClosed = errors.New("stream closed")
+
+// 流式响应写入器, 写入失败即认为客户端已断开
+type StreamWriter struct {
+	w        *bufio.Writer
+	lock     sync.Mutex
+	err      error
+	finished bool
+	done     chan struct{}
+	doneOnce sync.Once
+}
+
+func newStreamWriter(w *bufio.Writer) *StreamWriter {
+	return &StreamWriter{w: w, done: make(chan struct{})}
+}
+
+// Write 写入数据, 数据先进入缓冲区
+func (this *StreamWriter) Write(p []byte) (int, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.err != nil {
+		return 0, this.err
+	}
+	n, err := this.w.Write(p)
+	if err != nil {
+		this.fail(err)
+	}
+	return n, err
+}
+
+// Flush 将缓冲区数据发送给客户端
+func (this *StreamWriter) Flush() error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return this.flush()
+}
+
+func (this *StreamWriter) flush() error {
+	if this.err != nil {
+		return this.err
+	}
+	if err := this.w.Flush(); err != nil {
+		this.fail(err)
+		return err
+	}
+	return nil
+}
+
+// Done 客户端断开或服务关闭时关闭, 生产者应据此停止工作
+func (this *StreamWriter) Done() <-chan struct{} {
+	return this.done
+}
+
+// Err 返回导致流结束的错误
+func (this *StreamWriter) Err() error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.finished {
+		return nil
+	}
+	return this.err
+}
+
+// fail 需持有锁
+func (this *StreamWriter) fail(err error) {
+	if this.err == nil {
+		this.err = err
+	}
+	this.doneOnce.Do(func() {
+		close(this.done)
+	})
+}
+
+// finish 刷新剩余数据, 之后不再写入底层连接
+func (this *StreamWriter) finish() {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.flush()
+	this.finished = true
+	this.fail(ErrStreamClosed)
+}
+
+// watch 监听服务关闭并定时发送心跳, 心跳写入失败即可发现客户端断开
+func (this *StreamWriter) watch(shutdown <-chan struct{}, keepAlive time.Duration, ping []byte) {
+	var tick <-chan time.Time
+	if keepAlive > 0 && ping != nil {
+		ticker := time.NewTicker(keepAlive)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-this.done:
+			return
+		case <-shutdown:
+			this.lock.Lock()
+			this.fail(ErrStreamClosed)
+			this.lock.Unlock()
+			return
+		case <-tick:
+			this.lock.Lock()
+			if this.err == nil {
+				if _, err := this.w.Write(ping); err != nil {
+					this.fail(err)
+				} else {
+					this.flush()
+				}
+			}
+			this.lock.Unlock()
+		}
+	}
+}
+
+// stream 以分块方式输出响应, fn在处理函数返回后执行
+// 长时间的流需将ServerOptions.WriteTimeout设为负数关闭写超时
+func (this *HttpContext) stream(contentType string, keepAlive time.Duration, ping []byte, fn func(sw *StreamWriter) error) {
+	this.streaming = true
+	ctx := this.RawCtx
+	ctx.SetContentType(contentType)
+	ctx.Response.Header.Set("Cache-Control", "no-cache")
+	// 禁止nginx缓冲
+	ctx.Response.Header.Set("X-Accel-Buffering", "no")
+	logger := this.Logger()
+	shutdown := this.serverDone()
+	ctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+		sw := newStreamWriter(w)
+		go sw.watch(shutdown, keepAlive, ping)
+		defer this.release()
+		defer sw.finish()
+		defer func() {
+			if err := recover(); err != nil {
+				logger.Errorf("stream panic: %v\n%s", err, comm.PanicTrace(4))
+			}
+		}()
+		if err := fn(sw); err != nil && sw.Err() == nil {
+			logger.Errorf("stream: %s", err)
+		}
+	})
+}
+
+// IsStreaming 是否已开始流式响应
+func (this *HttpContext) IsStreaming() bool {
+	return this.streaming
+}
+
+// SSE配置
+type SSEOptions struct {
+	Retry     time.Duration // 建议客户端重连间隔, 为0时不发送
+	KeepAlive time.Duration // 心跳间隔, 默认15秒, 负数不发送
+}
+
+// SSE事件
+type SSEvent struct {
+	Id    string        // 事件ID, 客户端重连时通过Last-Event-ID带回
+	Event string        // 事件类型, 为空时客户端按message处理
+	Retry time.Duration // 重连间隔
+	Data  interface{}   // string和[]byte原样发送, 其他类型编码为JSON
+}
+
+// SSE写入器
+type SSEWriter struct {
+	*StreamWriter
+	lastEventId string
+}
+
+// LastEventID 客户端重连时带回的最后事件ID, 用于断点续传
+func (this *SSEWriter) LastEventID() string {
+	return this.lastEventId
+}
+
+// Send 发送事件并立即刷新
+func (this *SSEWriter) Send(event *SSEvent) error {
+	var buf bytes.Buffer
+	if event.Id != "" {
+		buf.WriteString("id: " + sseField(event.Id) + "\n")
+	}
+	if event.Event != "" {
+		buf.WriteString("event: " + sseField(event.Event) + "\n")
+	}
+	if event.Retry > 0 {
+		buf.WriteString("retry: " + strconv.FormatInt(int64(event.Retry/time.Millisecond), 10) + "\n")
+	}
+	if event.Data != nil {
+		var data []byte
+		switch v := event.Data.(type) {
+		case string:
+			data = []byte(v)
+		case []byte:
+			data = v
+		default:
+			j, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			data = j
+		}
+		for _, line := range bytes.Split(data, []byte("\n")) {
+			buf.WriteString("data: ")
+			buf.Write(bytes.TrimSuffix(line, []byte("\r")))
+			buf.WriteByte('\n')
+		}
+	}
+	buf.WriteByte('\n')
+	if _, err := this.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	return this.Flush()
+}
+
+// SendData 发送仅包含数据的事件
+func (this *SSEWriter) SendData(data interface{}) error {
+	return this.Send(&SSEvent{Data: data})
+}
+
+// sseField 事件ID和类型不能包含换行
+func sseField(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
+
+// SSE 以Server-Sent Events输出, options可为空
+func (this *HttpContext) SSE(options *SSEOptions, fn func(w *SSEWriter) error) {
+	if options == nil {
+		options = &SSEOptions{}
+	}
+	keepAlive := options.KeepAlive
+	if keepAlive == 0 {
+		keepAlive = defaultSSEKeepAlive
+	}
+	lastEventId := string(this.RawCtx.Request.Header.Peek(HEADER_LAST_EVENT_ID))
+	if lastEventId == "" {
+		// EventSource兼容库无法设置请求头时通过参数传递
+		lastEventId = string(this.RawCtx.QueryArgs().Peek("lastEventId"))
+	}
+	this.stream(CONTENT_TYPE_SSE, keepAlive, []byte(": ping\n\n"), func(sw *StreamWriter) error {
+		w := &SSEWriter{StreamWriter: sw, lastEventId: lastEventId}
+		if options.Retry > 0 {
+			if err := w.Send(&SSEvent{Retry: options.Retry}); err != nil {
+				return err
+			}
+		}
+		return fn(w)
+	})
+}
+
+// NDJSON写入器, 每行一个JSON
+type NDJSONWriter struct {
+	*StreamWriter
+	encoder *json.Encoder
+	count   int
+}
+
+// Encode 写入一行JSON
+func (this *NDJSONWriter) Encode(v interface{}) error {
+	if err := this.encoder.Encode(v); err != nil {
+		return err
+	}
+	this.count++
+	if this.count%streamFlushEvery == 0 {
+		return this.Flush()
+	}
+	return nil
+}
+
+// StreamNDJSON 以NDJSON分块输出, 适合大量数据导出
+func (this *HttpContext) StreamNDJSON(fn func(w *NDJSONWriter) error) {
+	this.stream(CONTENT_TYPE_NDJSON, 0, nil, func(sw *StreamWriter) error {
+		return fn(&NDJSONWriter{StreamWriter: sw, encoder: json.NewEncoder(sw)})
+	})
+}
+
+// CSV写入器
+type CSVWriter struct {
+	*StreamWriter
+	writer *csv.Writer
+	count  int
+}
+
+// WriteRecord 写入一行记录
+func (this *CSVWriter) WriteRecord(record []string) error {
+	if err := this.writer.Write(record); err != nil {
+		return err
+	}
+	this.count++
+	if this.count%streamFlushEvery == 0 {
+		return this.flushRecords()
+	}
+	return nil
+}
+
+func (this *CSVWriter) flushRecords() error {
+	this.writer.Flush()
+	if err := this.writer.Error(); err != nil {
+		return err
+	}
+	return this.Flush()
+}
+
+// StreamCSV 以CSV分块输出, filename不为空时作为附件下载
+func (this *HttpContext) StreamCSV(filename string, fn func(w *CSVWriter) error) {
+	if filename != "" {
+		this.RawCtx.Response.Header.Set("Content-Disposition",
+			fmt.Sprintf("attachment; filename*=UTF-8''%s", url.PathEscape(filename)))
+	}
+	this.stream(CONTENT_TYPE_CSV, 0, nil, func(sw *StreamWriter) error {
+		w := &CSVWriter{StreamWriter: sw, writer: csv.NewWriter(sw)}
+		if err := fn(w); err != nil {
+			return err
+		}
+		return w.flushRecords()
+	})
+}
@@ -0,0 +1,137 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"errors"
+
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+type streamTestController struct {
+	Controller
+}
+
+func (this *streamTestController) Export(ctx *HttpContext) *ApiResponse {
+	ctx.StreamNDJSON(func(w *NDJSONWriter) error {
+		for i := 0; i < 3; i++ {
+			if err := w.Encode(map[string]int{"i": i}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return nil
+}
+
+func TestStream(t *testing.T) {
+	router := new(Router)
+	router.Init()
+	var controller interface{} = &streamTestController{}
+	router.Get("/export", &controller, "Export")
+	router.HandleFunc("/events", func(c *HttpContext) {
+		c.SSE(&SSEOptions{Retry: 3 * time.Second}, func(w *SSEWriter) error {
+			return w.Send(&SSEvent{Id: "2", Event: "progress", Data: "a\nb:" + w.LastEventID()})
+		})
+	})
+	router.HandleFunc("/csv", func(c *HttpContext) {
+		c.StreamCSV("报表.csv", func(w *CSVWriter) error {
+			w.WriteRecord([]string{"name", "note"})
+			return w.WriteRecord([]string{"a", "x,y"})
+		})
+	})
+
+	client, closeFn := newTestClient(HttpHandler("", router))
+	defer closeFn()
+	do := func(uri string, lastEventId string) *fasthttp.Response {
+		req := fasthttp.AcquireRequest()
+		req.SetRequestURI("http://test" + uri)
+		if lastEventId != "" {
+			req.Header.Set(HEADER_LAST_EVENT_ID, lastEventId)
+		}
+		resp := new(fasthttp.Response)
+		if err := client.Do(req, resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := do("/export", "")
+	if string(resp.Body()) != "{\"i\":0}\n{\"i\":1}\n{\"i\":2}\n" ||
+		string(resp.Header.ContentType()) != CONTENT_TYPE_NDJSON {
+		t.Fatal(string(resp.Body()))
+	}
+	resp = do("/events", "1")
+	if string(resp.Body()) != "retry: 3000\n\nid: 2\nevent: progress\ndata: a\ndata: b:1\n\n" {
+		t.Fatal(string(resp.Body()))
+	}
+	resp = do("/csv", "")
+	if string(resp.Body()) != "name,note\na,\"x,y\"\n" ||
+		!strings.Contains(string(resp.Header.Peek("Content-Disposition")), "%E6%8A%A5%E8%A1%A8.csv") {
+		t.Fatal(string(resp.Body()), string(resp.Header.Peek("Content-Disposition")))
+	}
+}
+
+func TestStreamContext(t *testing.T) {
+	contexts := make(chan context.Context, 3)
+	router := new(Router)
+	router.Init()
+	stream := func(c *HttpContext) {
+		ctx := c.Context()
+		c.StreamNDJSON(func(w *NDJSONWriter) error {
+			time.Sleep(20 * time.Millisecond)
+			contexts <- ctx
+			return w.Encode(ctx.Err() == nil)
+		})
+	}
+	router.HandleFunc("/created", stream)
+	router.HandleFunc("/timeout", stream).Use(Timeout(&TimeoutOptions{Timeout: time.Second}))
+	router.HandleFunc("/lazy", func(c *HttpContext) {
+		c.StreamNDJSON(func(w *NDJSONWriter) error {
+			ctx := c.Context()
+			contexts <- ctx
+			return w.Encode(ctx.Err() == nil)
+		})
+	})
+	client, closeFn := newTestClient(HttpHandler("", router))
+	defer closeFn()
+
+	for _, uri := range []string{"/created", "/timeout", "/lazy"} {
+		req := fasthttp.AcquireRequest()
+		req.SetRequestURI("http://test" + uri)
+		resp := new(fasthttp.Response)
+		if err := client.Do(req, resp); err != nil || string(resp.Body()) != "true\n" {
+			t.Fatal(uri, "context cancelled before the stream was written", string(resp.Body()), err)
+		}
+		// 流写入结束后取消, 避免监听服务关闭的协程泄漏
+		select {
+		case <-(<-contexts).Done():
+		case <-time.After(time.Second):
+			t.Fatal(uri, "context not cancelled after the stream")
+		}
+	}
+}
+
+type brokenWriter struct{}
+
+func (brokenWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+func TestStreamWriterDisconnect(t *testing.T) {
+	sw := newStreamWriter(bufio.NewWriter(brokenWriter{}))
+	go sw.watch(nil, time.Millisecond, []byte(": ping\n\n"))
+	select {
+	case <-sw.Done():
+	case <-time.After(time.Second):
+		t.Fatal("disconnect not detected")
+	}
+	if _, err := sw.Write([]byte("x")); err == nil || sw.Err() == nil {
+		t.Fatal("write after disconnect must fail")
+	}
+	sw.finish()
+}
@@ -0,0 +1,155 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	comm "github.com/lxf9601/go-common"
+
+	"github.com/fasthttp/websocket"
+	"github.com/valyala/fasthttp"
+)
+
+// 超时配置
+type TimeoutOptions struct {
+	Timeout time.Duration // 处理超时时间
+	Status  int           // 超时响应状态码, 默认503, 网关类服务可设为504
+	Ret     int           // 响应ApiResponse的Ret, 默认与Status相同
+	Msg     string        // 响应ApiResponse的Msg
+}
+
+// handlerPanic 处理协程中的panic, 带回原始调用栈
+type handlerPanic struct {
+	err   interface{}
+	stack []byte
+}
+
+// Timeout 超时中间件, 在独立协程中执行后续处理, 超时后取消Context()并立即返回超时响应
+// 后续处理使用HttpContext及RawCtx的副本, 正常返回时才将响应复制回原请求, 超时后的修改不再生效
+// 处理函数应通过Context()感知取消并尽快返回, WebSocket升级请求不受超时限制
+func Timeout(options *TimeoutOptions) Middleware {
+	status := options.Status
+	if status == 0 {
+		status = http.StatusServiceUnavailable
+	}
+	ret := options.Ret
+	if ret == 0 {
+		ret = status
+	}
+	msg := options.Msg
+	if msg == "" {
+		msg = "request timeout"
+	}
+	return func(next HandlerFunc) HandlerFunc {
+		return func(c *HttpContext) {
+			if websocket.FastHTTPIsWebSocketUpgrade(c.RawCtx) {
+				// 升级后的连接由Hijack接管, 副本无法完成升级
+				next(c)
+				return
+			}
+			ctx, cancel := context.WithTimeout(c.Context(), options.Timeout)
+			streaming := false
+			defer func() {
+				// 流式响应写入期间仍受超时限制, 写入结束时随请求上下文取消
+				if !streaming {
+					cancel()
+				}
+			}()
+			inner := c.fork()
+			inner.SetContext(ctx)
+			done := make(chan *handlerPanic, 1)
+			go func() {
+				defer func() {
+					if err := recover(); err != nil {
+						done <- &handlerPanic{err: err, stack: comm.PanicTrace(4)}
+					}
+					close(done)
+				}()
+				next(inner)
+			}()
+			select {
+			case p := <-done:
+				if p != nil {
+					c.Logger().Errorf("panic: %v\n%s", p.err, p.stack)
+					panic(p.err)
+				}
+				c.join(inner)
+				streaming = inner.streaming
+			case <-ctx.Done():
+				resp := new(fasthttp.Response)
+				resp.SetStatusCode(status)
+				resp.Header.SetContentType(CONTENT_TYPE_JSON)
+				if c.RequestID() != "" {
+					resp.Header.Set(HEADER_REQUEST_ID, c.RequestID())
+				}
+				j, _ := json.Marshal(&ApiResponse{Ret: ret, Msg: msg})
+				resp.SetBody(j)
+				c.RawCtx.TimeoutErrorWithResponse(resp)
+				c.timeoutResponse = resp
+				c.Logger().Warnf("request timeout after %s: %s", options.Timeout, ctx.Err())
+			}
+		}
+	}
+}
+
+// RequestCtx副本的日志, 与fasthttp默认日志一致
+var forkLogger = log.New(os.Stderr, "", log.LstdFlags)
+
+// fork 复制请求上下文供独立协程处理, 请求及已设置的响应头复制到新的RequestCtx
+func (this *HttpContext) fork() *HttpContext {
+	inner := *this
+	inner.shutdown = this.serverDone()
+	raw := new(fasthttp.RequestCtx)
+	if conn := this.RawCtx.Conn(); conn != nil {
+		raw.Init2(conn, forkLogger, true)
+		this.RawCtx.Request.CopyTo(&raw.Request)
+	} else {
+		raw.Init(&this.RawCtx.Request, this.RawCtx.RemoteAddr(), nil)
+	}
+	if this.RawCtx.Request.IsBodyStream() {
+		raw.Request.SetBodyStream(this.RawCtx.RequestBodyStream(), this.RawCtx.Request.Header.ContentLength())
+	}
+	this.RawCtx.Response.CopyTo(&raw.Response)
+	this.RawCtx.VisitUserValues(func(key []byte, value interface{}) {
+		raw.SetUserValueBytes(key, value)
+	})
+	inner.RawCtx = raw
+	return &inner
+}
+
+// join 将副本的响应及路由、鉴权、日志等请求状态复制回原请求
+func (this *HttpContext) join(inner *HttpContext) {
+	this.contentType = inner.contentType
+	this.claims = inner.claims
+	this.requestId = inner.requestId
+	this.logger = inner.logger
+	this.route = inner.route
+	this.apiVersion = inner.apiVersion
+	this.signatureKey = inner.signatureKey
+	resp := &inner.RawCtx.Response
+	resp.CopyTo(&this.RawCtx.Response)
+	if resp.IsBodyStream() {
+		this.RawCtx.Response.SetBodyStreamWriter(func(w *bufio.Writer) {
+			resp.BodyWriteTo(flushWriter{w})
+		})
+	}
+	this.streaming = inner.streaming
+}
+
+// flushWriter 每次写入后立即刷新, 保持流式响应的实时性
+type flushWriter struct {
+	w *bufio.Writer
+}
+
+func (this flushWriter) Write(p []byte) (int, error) {
+	n, err := this.w.Write(p)
+	if err == nil {
+		err = this.w.Flush()
+	}
+	return n, err
+}
@@ -0,0 +1,191 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gogap/logrus"
+	"github.com/lxf9601/go-common/metrics"
+	"github.com/valyala/fasthttp"
+)
+
+func TestTimeout(t *testing.T) {
+	cancelled := make(chan error, 1)
+	router := new(Router)
+	router.Init()
+	router.Use(RequestID())
+	router.HandleFunc("/slow", func(c *HttpContext) {
+		ctx := c.Context()
+		if RequestIDFromContext(ctx) != "req-1" {
+			cancelled <- nil
+			return
+		}
+		if _, ok := ctx.Deadline(); !ok {
+			cancelled <- nil
+			return
+		}
+		<-ctx.Done()
+		cancelled <- ctx.Err()
+	}).Use(Timeout(&TimeoutOptions{Timeout: 50 * time.Millisecond, Status: 504}))
+	router.HandleFunc("/fast", func(c *HttpContext) {
+		c.RawCtx.SetBodyString("ok")
+	}).Use(Timeout(&TimeoutOptions{Timeout: time.Second}))
+	router.HandleFunc("/panic", func(c *HttpContext) {
+		panic("boom")
+	}).Use(Timeout(&TimeoutOptions{Timeout: time.Second}))
+
+	client, closeFn := newTestClient(HttpHandler("", router))
+	defer closeFn()
+	do := func(uri string) *fasthttp.Response {
+		req := fasthttp.AcquireRequest()
+		req.SetRequestURI("http://test" + uri)
+		req.Header.Set(HEADER_REQUEST_ID, "req-1")
+		resp := new(fasthttp.Response)
+		if err := client.Do(req, resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := do("/slow")
+	if resp.StatusCode() != 504 || string(resp.Body()) != `{"ret":504,"msg":"request timeout","data":null}` ||
+		string(resp.Header.Peek(HEADER_REQUEST_ID)) != "req-1" {
+		t.Fatal(resp.StatusCode(), string(resp.Body()))
+	}
+	select {
+	case err := <-cancelled:
+		if err != context.DeadlineExceeded {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("handler context not cancelled")
+	}
+	if resp = do("/fast"); resp.StatusCode() != 200 || string(resp.Body()) != "ok" {
+		t.Fatal(resp.StatusCode(), string(resp.Body()))
+	}
+	if resp = do("/panic"); resp.StatusCode() != 500 {
+		t.Fatal(resp.StatusCode(), string(resp.Body()))
+	}
+}
+
+func TestTimeoutPrivateContext(t *testing.T) {
+	finished := make(chan bool, 1)
+	router := new(Router)
+	router.Init()
+	router.Use(RequestID())
+	// 外层中间件在Timeout返回后继续读写HttpContext
+	router.Use(func(next HandlerFunc) HandlerFunc {
+		return func(c *HttpContext) {
+			c.RawCtx.Response.Header.Set("X-Outer", "1")
+			next(c)
+			c.Logger().Infof("status %d", c.response().StatusCode())
+			c.SetLogger(c.Logger().WithField("outer", true))
+			c.RawCtx.SetUserValue("outer", true)
+			c.RawCtx.Response.Header.Set("X-After", "1")
+		}
+	})
+	router.HandleFunc("/slow", func(c *HttpContext) {
+		<-c.Context().Done()
+		for i := 0; i < 100; i++ {
+			c.SetLogger(c.Logger().WithField("i", i))
+			c.Logger().Debugf("still running")
+			c.RawCtx.SetUserValue("i", i)
+			c.RawCtx.Response.Header.Set("X-Inner", "1")
+			c.RawCtx.SetBodyString("late")
+		}
+		finished <- true
+	}).Use(Timeout(&TimeoutOptions{Timeout: 20 * time.Millisecond}))
+	router.HandleFunc("/user/{id}", func(c *HttpContext) {
+		c.RawCtx.Response.Header.SetBytesV("X-Inner", c.RawCtx.Request.Header.Peek("X-In"))
+		c.RawCtx.SetBodyString(c.FormString("id") + " " + string(c.RawCtx.PostBody()))
+	}).Use(Timeout(&TimeoutOptions{Timeout: time.Second}))
+	router.HandleFunc("/stream", func(c *HttpContext) {
+		c.StreamNDJSON(func(w *NDJSONWriter) error {
+			return w.Encode(map[string]int{"a": 1})
+		})
+	}).Use(Timeout(&TimeoutOptions{Timeout: time.Second}))
+
+	client, closeFn := newTestClient(HttpHandler("", router))
+	defer closeFn()
+	do := func(method string, uri string, body string) *fasthttp.Response {
+		req := fasthttp.AcquireRequest()
+		req.Header.SetMethod(method)
+		req.SetRequestURI("http://test" + uri)
+		req.Header.Set("X-In", "in")
+		req.SetBodyString(body)
+		resp := new(fasthttp.Response)
+		if err := client.Do(req, resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := do("GET", "/slow", "")
+	if resp.StatusCode() != 503 || len(resp.Header.Peek("X-Inner")) > 0 {
+		t.Fatal(resp.StatusCode(), resp.Header.String())
+	}
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Fatal("handler not finished")
+	}
+
+	resp = do("POST", "/user/7", "body")
+	if resp.StatusCode() != 200 || string(resp.Body()) != "7 body" || string(resp.Header.Peek("X-Inner")) != "in" ||
+		string(resp.Header.Peek("X-Outer")) != "1" || string(resp.Header.Peek("X-After")) != "1" ||
+		len(resp.Header.Peek(HEADER_REQUEST_ID)) == 0 {
+		t.Fatal(resp.StatusCode(), string(resp.Body()), resp.Header.String())
+	}
+	if resp = do("GET", "/stream", ""); resp.StatusCode() != 200 || string(resp.Body()) != "{\"a\":1}\n" {
+		t.Fatal(resp.StatusCode(), string(resp.Body()))
+	}
+}
+
+func TestTimeoutJoinState(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logrus.SetOutput(buf)
+	logrus.SetFormatter(&logrus.JSONFormatter{})
+	defer logrus.SetOutput(os.Stdout)
+	defer logrus.SetFormatter(&logrus.TextFormatter{})
+
+	registry := metrics.NewRegistry()
+	router := new(Router)
+	router.Init()
+	router.Use(Metrics(registry), AccessLog(&AccessLogOptions{}), Timeout(&TimeoutOptions{Timeout: time.Second}))
+	router.HandleFunc("/user/{id}", func(c *HttpContext) {
+		c.SetClaims(jwt.MapClaims{"sub": "alice"})
+		if c.serverDone() == nil {
+			// 副本应沿用原请求的服务关闭信号
+			c.RawCtx.SetStatusCode(500)
+			return
+		}
+		c.RawCtx.SetStatusCode(201)
+	})
+	client, closeFn := newTestClient(HttpHandler("", router))
+	defer closeFn()
+	req := fasthttp.AcquireRequest()
+	req.SetRequestURI("http://test/user/1")
+	resp := new(fasthttp.Response)
+	if err := client.Do(req, resp); err != nil || resp.StatusCode() != 201 {
+		t.Fatal(resp.StatusCode(), err)
+	}
+
+	var scrape bytes.Buffer
+	registry.WritePrometheus(&scrape)
+	if line := `http_requests_total{method="GET",route="/user/{id}",status="201"} 1`; !strings.Contains(scrape.String(), line) {
+		t.Fatal("route set inside Timeout lost", scrape.String())
+	}
+	entry := map[string]interface{}{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatal(buf.String())
+	}
+	if entry["route"] != "/user/{id}" || entry["user"] != "alice" {
+		t.Fatal(buf.String())
+	}
+}
@@ -0,0 +1,58 @@
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+// TLS配置, 证书和私钥均为PEM文件
+type TLSOptions struct {
+	CertFile   string // 证书文件, 双向TLS时客户端出示的证书
+	KeyFile    string // 私钥文件
+	CAFile     string // 校验对端证书的CA文件, 为空时使用系统根证书
+	ServerName string // 校验的服务端证书名称, 默认为请求主机名
+}
+
+// loadCertPool 加载PEM格式的CA证书
+func loadCertPool(caFile string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in %s", caFile)
+	}
+	return pool, nil
+}
+
+// ClientConfig 客户端TLS配置
+func (this *TLSOptions) ClientConfig() (*tls.Config, error) {
+	config := &tls.Config{ServerName: this.ServerName, MinVersion: tls.VersionTLS12}
+	if this.CertFile != "" || this.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(this.CertFile, this.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if this.CAFile != "" {
+		pool, err := loadCertPool(this.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+	return config, nil
+}
+
+// PeerCertificate 双向TLS时客户端出示的证书, 非TLS请求或未出示证书时为nil
+func (this *HttpContext) PeerCertificate() *x509.Certificate {
+	state := this.RawCtx.TLSConnectionState()
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return nil
+	}
+	return state.PeerCertificates[0]
+}
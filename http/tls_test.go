@@ -0,0 +1,114 @@
+package http
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCert 生成证书并写入PEM文件, parent为空时生成自签名CA
+func writeTestCert(t *testing.T, dir string, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(filepath.Join(dir, name+".pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	cert, _ := x509.ParseCertificate(der)
+	return cert, key
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mtls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ca, caKey := writeTestCert(t, dir, "ca", nil, nil)
+	writeTestCert(t, dir, "server", ca, caKey)
+	writeTestCert(t, dir, "user-service", ca, caKey)
+	file := func(name string) string { return filepath.Join(dir, name) }
+
+	router := new(Router)
+	router.Init()
+	router.HandleFunc("/api/whoami", func(c *HttpContext) {
+		name := ""
+		if cert := c.PeerCertificate(); cert != nil {
+			name = cert.Subject.CommonName
+		}
+		c.RawCtx.SetBodyString(`{"ret":0,"msg":"","data":"` + name + `"}`)
+	})
+	server := NewServer(router, &ServerOptions{CertFile: file("server.pem"), KeyFile: file("server.key"),
+		ClientCAFile: file("ca.pem")})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(ln)
+	}()
+	defer func() {
+		server.Shutdown()
+		<-served
+	}()
+	url := "https://" + ln.Addr().String() + "/api"
+
+	api := NewMicroSrvApi(&MicroSrvApiOptions{Url: url, Timeout: 5 * time.Second, TLS: &TLSOptions{
+		CertFile: file("user-service.pem"), KeyFile: file("user-service.key"), CAFile: file("ca.pem")}})
+	var name string
+	if _, err := api.NewRequest("GET", "/whoami").Do(context.Background(), &name); err != nil || name != "user-service" {
+		t.Fatal(err, name)
+	}
+
+	anonymous := NewMicroSrvApi(&MicroSrvApiOptions{Url: url, Timeout: 5 * time.Second, TLS: &TLSOptions{CAFile: file("ca.pem")}})
+	if _, err := anonymous.NewRequest("GET", "/whoami").Do(context.Background(), nil); err == nil {
+		t.Fatal("client without certificate accepted")
+	}
+
+	// 双向TLS配置不完整时拒绝启动, 不能退化为明文服务
+	for _, options := range []*ServerOptions{{ClientCAFile: file("ca.pem")}, {CertFile: file("server.pem")},
+		{KeyFile: file("server.key"), ClientCAFile: file("ca.pem")}} {
+		if err := NewServer(router, options).Serve(ln); err == nil {
+			t.Fatal("incomplete tls config served", options)
+		}
+	}
+
+	broken := NewMicroSrvApi(&MicroSrvApiOptions{Url: url, TLS: &TLSOptions{CAFile: file("missing.pem")}})
+	if _, err := broken.NewRequest("GET", "/whoami").Do(context.Background(), nil); !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+}
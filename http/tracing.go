@@ -0,0 +1,62 @@
+package http
+
+import (
+	"github.com/lxf9601/go-common/logc"
+	"github.com/lxf9601/go-common/trace"
+)
+
+// 链路追踪配置
+type TracingOptions struct {
+	Tracer    *trace.Tracer // 追踪器, 默认trace.Default()
+	SkipPaths []string      // 不追踪的路径, 如健康检查
+}
+
+// Tracing 链路追踪中间件, 从traceparent/tracestate请求头恢复链路, 为每个请求创建服务端Span
+// Span放入c.Context(), 经MicroSrvApi和amqp.Session.PushContext继续传递, 请求日志附加trace_id和span_id
+func Tracing(options *TracingOptions) Middleware {
+	skip := make(map[string]bool, len(options.SkipPaths))
+	for _, p := range options.SkipPaths {
+		skip[p] = true
+	}
+	return func(next HandlerFunc) HandlerFunc {
+		return func(c *HttpContext) {
+			if skip[string(c.RawCtx.Path())] {
+				next(c)
+				return
+			}
+			tracer := options.Tracer
+			if tracer == nil {
+				tracer = trace.Default()
+			}
+			req := &c.RawCtx.Request
+			ctx := trace.Extract(c.Context(), func(key string) string {
+				return string(req.Header.Peek(key))
+			})
+			method := string(c.RawCtx.Method())
+			path := string(c.RawCtx.Path())
+			ctx, span := tracer.Start(ctx, method+" "+path, trace.SPAN_KIND_SERVER)
+			defer span.End()
+			c.SetContext(ctx)
+			sc := span.SpanContext()
+			c.SetLogger(c.Logger().WithFields(logc.Fields{"trace_id": sc.TraceID.String(), "span_id": sc.SpanID.String()}))
+			span.SetAttribute("http.method", method)
+			span.SetAttribute("http.target", string(c.RawCtx.RequestURI()))
+			span.SetAttribute("http.client_ip", c.ClientIP())
+			if c.RequestID() != "" {
+				span.SetAttribute("http.request_id", c.RequestID())
+			}
+
+			next(c)
+
+			if route := c.RoutePattern(); route != "" {
+				span.SetName(method + " " + route)
+				span.SetAttribute("http.route", route)
+			}
+			status := c.response().StatusCode()
+			span.SetAttribute("http.status_code", status)
+			if status >= 500 {
+				span.SetStatus(trace.STATUS_ERROR, "")
+			}
+		}
+	}
+}
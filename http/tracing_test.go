@@ -0,0 +1,78 @@
+package http
+
+import (
+	"context"
+
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/lxf9601/go-common/trace"
+	"github.com/valyala/fasthttp"
+)
+
+type tracingTestExporter struct {
+	lock  sync.Mutex
+	spans []*trace.SpanData
+}
+
+func (this *tracingTestExporter) Export(span *trace.SpanData) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.spans = append(this.spans, span)
+	return nil
+}
+
+func (this *tracingTestExporter) Close() error {
+	return nil
+}
+
+func TestTracing(t *testing.T) {
+	exporter := &tracingTestExporter{}
+	tracer := trace.NewTracer(&trace.TracerOptions{Service: "gateway", Exporter: exporter})
+	defer trace.SetDefault(trace.Default())
+	trace.SetDefault(tracer)
+
+	var traceparent string
+	dial, closeFn := newTestServer(func(ctx *fasthttp.RequestCtx) {
+		traceparent = string(ctx.Request.Header.Peek(trace.HEADER_TRACEPARENT))
+		ctx.SetBodyString(`{"ret":0,"msg":"","data":null}`)
+	})
+	defer closeFn()
+	api := NewMicroSrvApi(&MicroSrvApiOptions{Url: "http://order/api"})
+	api.client.Dial = dial
+
+	router := new(Router)
+	router.Init()
+	router.Use(Tracing(&TracingOptions{}))
+	router.HandleFunc("/user/{id}", func(c *HttpContext) {
+		if _, err := api.NewRequest("GET", "/order").Do(c.Context(), nil); err != nil {
+			t.Error(err)
+		}
+	})
+	req := fasthttp.AcquireRequest()
+	req.SetRequestURI("/user/1")
+	req.Header.Set(trace.HEADER_TRACEPARENT, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Init(req, nil, nil)
+	HttpHandler("", router)(ctx)
+
+	if len(exporter.spans) != 2 {
+		t.Fatal(exporter.spans)
+	}
+	client, server := exporter.spans[0], exporter.spans[1]
+	if server.Name != "GET /user/{id}" || server.ParentSpanID != "00f067aa0ba902b7" ||
+		server.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || server.Attributes["http.status_code"] != 200 {
+		t.Fatal(server)
+	}
+	if client.ParentSpanID != server.SpanID || client.Attributes["http.status_code"] != 200 ||
+		!strings.HasPrefix(traceparent, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+client.SpanID) {
+		t.Fatal(client, traceparent)
+	}
+
+	// 没有链路上下文时MicroSrvApi不创建Span
+	traceparent = ""
+	if _, err := api.NewRequest("GET", "/order").Do(context.Background(), nil); err != nil || traceparent != "" {
+		t.Fatal(err, traceparent)
+	}
+}
@@ -0,0 +1,266 @@
+package http
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lxf9601/go-common/storage"
+)
+
+const (
+	defaultUploadMaxFileSize  = 10 * 1024 * 1024
+	defaultUploadMaxTotalSize = 50 * 1024 * 1024
+	defaultUploadMaxFiles     = 10
+	// 普通表单字段大小上限
+	uploadMaxValueSize = 1024 * 1024
+	// MIME类型探测读取的字节数
+	uploadSniffSize = 512
+)
+
+var (
+	ErrNotMultipart   = errors.New("upload: request is not multipart/form-data")
+	ErrUploadTooLarge = errors.New("upload: file too large")
+	ErrUploadTooMany  = errors.New("upload: too many files")
+	ErrUploadType     = errors.New("upload: file type not allowed")
+)
+
+// 上传配置
+type UploadOptions struct {
+	Storage      storage.Storage               // 存储后端
+	Fields       []string                      // 接收文件的表单字段, 为空时接收全部
+	MaxFileSize  int64                         // 单个文件大小上限, 默认10MB
+	MaxTotalSize int64                         // 全部文件大小上限, 默认50MB
+	MaxFiles     int                           // 文件数量上限, 默认10
+	AllowedTypes []string                      // 允许的MIME类型, 按内容探测, 支持image/*, 为空不限制
+	AllowedExts  []string                      // 允许的扩展名, 如.jpg, 为空不限制
+	KeyFunc      func(file *UploadFile) string // 生成存储key, 默认 日期/随机ID+扩展名
+}
+
+// 已上传文件
+type UploadFile struct {
+	Field       string          // 表单字段
+	Filename    string          // 客户端文件名
+	Ext         string          // 小写扩展名
+	ContentType string          // 按内容探测的MIME类型
+	Size        int64           // 大小
+	Object      *storage.Object // 存储的对象信息
+}
+
+type uploader struct {
+	options *UploadOptions
+	files   []*UploadFile
+	total   int64
+}
+
+// Upload 解析multipart请求并将文件写入存储, 普通字段可继续通过FormString等读取
+// 服务开启ServerOptions.StreamRequestBody时边读边写, 不在内存中缓存整个请求体
+// 任一文件校验失败时已写入的文件会被删除
+func (this *HttpContext) Upload(options *UploadOptions) ([]*UploadFile, error) {
+	ctx := this.RawCtx
+	boundary := string(ctx.Request.Header.MultipartFormBoundary())
+	if boundary == "" {
+		return nil, ErrNotMultipart
+	}
+	opts := *options
+	if opts.MaxFileSize <= 0 {
+		opts.MaxFileSize = defaultUploadMaxFileSize
+	}
+	if opts.MaxTotalSize <= 0 {
+		opts.MaxTotalSize = defaultUploadMaxTotalSize
+	}
+	if opts.MaxFiles <= 0 {
+		opts.MaxFiles = defaultUploadMaxFiles
+	}
+	if opts.KeyFunc == nil {
+		opts.KeyFunc = defaultUploadKey
+	}
+	u := &uploader{options: &opts}
+	var err error
+	if stream := ctx.RequestBodyStream(); stream != nil {
+		err = u.readParts(this, multipart.NewReader(stream, boundary))
+	} else if body := ctx.PostBody(); len(body) > 0 {
+		err = u.readParts(this, multipart.NewReader(bytes.NewReader(body), boundary))
+	} else {
+		// 服务端已预解析multipart表单
+		err = u.readForm(this)
+	}
+	if err != nil {
+		u.cleanup()
+		return nil, err
+	}
+	return u.files, nil
+}
+
+func (this *uploader) readParts(c *HttpContext, reader *multipart.Reader) error {
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if part.FileName() == "" {
+			value, err := ioutil.ReadAll(io.LimitReader(part, uploadMaxValueSize+1))
+			if err != nil {
+				return err
+			}
+			if len(value) > uploadMaxValueSize {
+				return ErrUploadTooLarge
+			}
+			c.RawCtx.PostArgs().AddBytesV(part.FormName(), value)
+			continue
+		}
+		err = this.save(part.FormName(), part.FileName(), part)
+		part.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (this *uploader) readForm(c *HttpContext) error {
+	form, err := c.RawCtx.MultipartForm()
+	if err != nil {
+		return err
+	}
+	fields := make([]string, 0, len(form.File))
+	for field := range form.File {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		for _, header := range form.File[field] {
+			if header.Size > this.options.MaxFileSize {
+				return ErrUploadTooLarge
+			}
+			f, err := header.Open()
+			if err != nil {
+				return err
+			}
+			err = this.save(field, header.Filename, f)
+			f.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// save 校验扩展名和探测到的MIME类型后写入存储
+func (this *uploader) save(field string, filename string, r io.Reader) error {
+	options := this.options
+	if len(options.Fields) > 0 && !containsString(options.Fields, field) {
+		return nil
+	}
+	if len(this.files) >= options.MaxFiles {
+		return ErrUploadTooMany
+	}
+	file := &UploadFile{Field: field, Filename: path.Base(filename), Ext: strings.ToLower(path.Ext(filename))}
+	if len(options.AllowedExts) > 0 && !containsFold(options.AllowedExts, file.Ext) {
+		return ErrUploadType
+	}
+	head := make([]byte, uploadSniffSize)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	head = head[:n]
+	file.ContentType = http.DetectContentType(head)
+	if len(options.AllowedTypes) > 0 && !mimeAllowed(options.AllowedTypes, file.ContentType) {
+		return ErrUploadType
+	}
+	limit := options.MaxFileSize
+	if remaining := options.MaxTotalSize - this.total; remaining < limit {
+		limit = remaining
+	}
+	reader := &uploadLimitReader{r: io.MultiReader(bytes.NewReader(head), r), remaining: limit}
+	obj, err := options.Storage.Put(options.KeyFunc(file), reader, -1, &storage.PutOptions{ContentType: file.ContentType})
+	if reader.exceeded {
+		if err == nil {
+			options.Storage.Delete(obj.Key)
+		}
+		return ErrUploadTooLarge
+	}
+	if err != nil {
+		return err
+	}
+	file.Object = obj
+	file.Size = obj.Size
+	this.total += obj.Size
+	this.files = append(this.files, file)
+	return nil
+}
+
+// cleanup 删除本次已写入的文件
+func (this *uploader) cleanup() {
+	for _, file := range this.files {
+		this.options.Storage.Delete(file.Object.Key)
+	}
+	this.files = nil
+}
+
+// 超过上限时返回ErrUploadTooLarge, 使存储中止写入
+type uploadLimitReader struct {
+	r         io.Reader
+	remaining int64
+	exceeded  bool
+}
+
+func (this *uploadLimitReader) Read(p []byte) (int, error) {
+	if this.remaining < 0 {
+		this.exceeded = true
+		return 0, ErrUploadTooLarge
+	}
+	if int64(len(p)) > this.remaining+1 {
+		p = p[:this.remaining+1]
+	}
+	n, err := this.r.Read(p)
+	this.remaining -= int64(n)
+	if this.remaining < 0 {
+		this.exceeded = true
+		return 0, ErrUploadTooLarge
+	}
+	return n, err
+}
+
+func defaultUploadKey(file *UploadFile) string {
+	return time.Now().Format("2006/01/02") + "/" + NewRequestID() + file.Ext
+}
+
+func mimeAllowed(allowed []string, contentType string) bool {
+	contentType = strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0])
+	for _, t := range allowed {
+		if t == contentType || (strings.HasSuffix(t, "/*") && strings.HasPrefix(contentType, t[:len(t)-1])) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
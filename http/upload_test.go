@@ -0,0 +1,96 @@
+package http
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime/multipart"
+
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lxf9601/go-common/storage"
+
+	"github.com/valyala/fasthttp"
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n0000")
+
+func newUploadContext(t *testing.T, files map[string][]byte) *HttpContext {
+	body := new(bytes.Buffer)
+	w := multipart.NewWriter(body)
+	w.WriteField("title", "report")
+	for name, content := range files {
+		part, _ := w.CreateFormFile("file", name)
+		part.Write(content)
+	}
+	w.Close()
+	req := fasthttp.AcquireRequest()
+	req.Header.SetMethod("POST")
+	req.Header.SetContentType(w.FormDataContentType())
+	req.SetBody(body.Bytes())
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Init(req, nil, nil)
+	return &HttpContext{RawCtx: ctx}
+}
+
+func TestUpload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	local, _ := storage.NewLocal(&storage.LocalOptions{Root: dir})
+	options := &UploadOptions{
+		Storage:      local,
+		MaxFileSize:  20,
+		AllowedTypes: []string{"image/*"},
+		AllowedExts:  []string{".png"},
+		KeyFunc:      func(file *UploadFile) string { return "img/" + file.Filename },
+	}
+
+	c := newUploadContext(t, map[string][]byte{"a.PNG": pngHeader})
+	files, err := c.Upload(options)
+	if err != nil || len(files) != 1 || files[0].ContentType != "image/png" || files[0].Size != 12 ||
+		files[0].Ext != ".png" || c.FormString("title") != "report" {
+		t.Fatal(files, err)
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(dir, "img", "a.PNG")); !bytes.Equal(b, pngHeader) {
+		t.Fatal(string(b))
+	}
+
+	if _, err := newUploadContext(t, map[string][]byte{"b.png": []byte("plain text")}).Upload(options); err != ErrUploadType {
+		t.Fatal(err)
+	}
+	big := append(append([]byte{}, pngHeader...), bytes.Repeat([]byte("x"), 20)...)
+	if _, err := newUploadContext(t, map[string][]byte{"c.png": big}).Upload(options); err != ErrUploadTooLarge {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "img", "c.png")); !os.IsNotExist(err) {
+		t.Fatal("oversized file must not be stored")
+	}
+	if _, err := (&HttpContext{RawCtx: new(fasthttp.RequestCtx)}).Upload(options); err != ErrNotMultipart {
+		t.Fatal(err)
+	}
+
+	// 请求体超过上限时流式解析
+	dial, closeFn := startTestServer(&fasthttp.Server{StreamRequestBody: true, DisablePreParseMultipartForm: true, MaxRequestBodySize: 64,
+		Handler: func(ctx *fasthttp.RequestCtx) {
+			files, err := (&HttpContext{RawCtx: ctx}).Upload(&UploadOptions{Storage: local})
+			if err != nil || len(files) != 1 || files[0].Size != 1000 {
+				ctx.SetStatusCode(500)
+			}
+		}})
+	defer closeFn()
+	client := &fasthttp.HostClient{Addr: "test", Dial: dial}
+	req := &newUploadContext(t, map[string][]byte{"d.txt": bytes.Repeat([]byte("x"), 1000)}).RawCtx.Request
+	req.SetRequestURI("http://test/")
+	resp := new(fasthttp.Response)
+	if err := client.Do(req, resp); err != nil || resp.StatusCode() != 200 {
+		t.Fatal(resp.StatusCode(), err)
+	}
+
+	if !mimeAllowed([]string{"text/*"}, "text/plain; charset=utf-8") || mimeAllowed([]string{"image/*"}, "imagex/png") {
+		t.Fatal("mimeAllowed")
+	}
+}
@@ -0,0 +1,205 @@
+package http
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 版本选择方式, 可组合使用, 优先级为路径、请求头、Accept
+const (
+	VERSION_BY_PATH   = 1 << iota // /v2/user/list
+	VERSION_BY_HEADER             // X-API-Version: 2
+	VERSION_BY_ACCEPT             // Accept: application/vnd.{Vendor}.v2+json 或 application/json; version=2
+
+	HEADER_API_VERSION = "X-API-Version"
+)
+
+var (
+	versionPathRegexp   = regexp.MustCompile(`^/v(\d+)(/.*)$`)
+	versionAcceptRegexp = regexp.MustCompile(`(?:\.v(\d+)(?:\+|$)|;\s*version=v?(\d+))`)
+)
+
+// 版本配置
+type VersionOptions struct {
+	Strategies int    // 版本选择方式, 默认全部启用
+	Header     string // 自定义版本请求头, 默认X-API-Version
+	Vendor     string // Accept媒体类型中的vendor, 为空时匹配任意vendor
+	Default    int    // 未指定版本时使用的版本, 默认最新版本
+}
+
+// API版本
+type ApiVersion struct {
+	Version     int       // 版本号
+	Deprecation time.Time // 废弃时间, 设置后响应Deprecation头
+	Sunset      time.Time // 下线时间, 设置后响应Sunset头
+	Link        string    // 迁移说明地址, 随Deprecation/Sunset以Link头返回
+}
+
+// Status 版本状态: active, deprecated或sunset
+func (this *ApiVersion) Status() string {
+	now := time.Now()
+	if !this.Sunset.IsZero() && !now.Before(this.Sunset) {
+		return "sunset"
+	}
+	if !this.Deprecation.IsZero() && !now.Before(this.Deprecation) {
+		return "deprecated"
+	}
+	return "active"
+}
+
+// Versioning 启用版本路由, 需在HttpHandler之前调用
+func (this *Router) Versioning(options *VersionOptions) {
+	opts := *options
+	if opts.Strategies == 0 {
+		opts.Strategies = VERSION_BY_PATH | VERSION_BY_HEADER | VERSION_BY_ACCEPT
+	}
+	if opts.Header == "" {
+		opts.Header = HEADER_API_VERSION
+	}
+	this.versioning = &opts
+}
+
+// VersionGroup 注册版本分组, 路由路径为 /v{Version}{url}
+// 请求的版本未定义该路由时, 回退到定义了该路由的最近的低版本
+func (this *Router) VersionGroup(version *ApiVersion, url string, interceptors []Interceptor, handler func(group *RouterGroup)) {
+	if this.versioning == nil {
+		this.Versioning(&VersionOptions{})
+	}
+	if this.versions == nil {
+		this.versions = make(map[int]*ApiVersion)
+	}
+	if _, ok := this.versions[version.Version]; !ok {
+		this.versions[version.Version] = version
+		this.versionList = append(this.versionList, version.Version)
+		sort.Sort(sort.Reverse(sort.IntSlice(this.versionList)))
+	}
+	this.Group("/v"+strconv.Itoa(version.Version)+url, interceptors, handler)
+}
+
+// Versions 返回已注册的版本, 按版本号升序
+func (this *Router) Versions() []*ApiVersion {
+	versions := make([]*ApiVersion, 0, len(this.versionList))
+	for i := len(this.versionList) - 1; i >= 0; i-- {
+		versions = append(versions, this.versions[this.versionList[i]])
+	}
+	return versions
+}
+
+// VersionsHandler 输出已注册版本及状态, 可通过Router.HandleFunc挂载
+func VersionsHandler(router *Router) HandlerFunc {
+	type versionInfo struct {
+		Version     int    `json:"version"`
+		Status      string `json:"status"`
+		Deprecation string `json:"deprecation,omitempty"`
+		Sunset      string `json:"sunset,omitempty"`
+		Link        string `json:"link,omitempty"`
+	}
+	return func(c *HttpContext) {
+		infos := make([]*versionInfo, 0)
+		for _, version := range router.Versions() {
+			info := &versionInfo{Version: version.Version, Status: version.Status(), Link: version.Link}
+			if !version.Deprecation.IsZero() {
+				info.Deprecation = version.Deprecation.Format(time.RFC3339)
+			}
+			if !version.Sunset.IsZero() {
+				info.Sunset = version.Sunset.Format(time.RFC3339)
+			}
+			infos = append(infos, info)
+		}
+		c.Encode(&ApiResponse{Data: infos})
+	}
+}
+
+// ApiVersion 返回本次请求实际使用的版本, 非版本路由为0
+func (this *HttpContext) ApiVersion() int {
+	return this.apiVersion
+}
+
+// requestedVersion 解析请求的版本及去掉版本前缀的路径, 未指定版本时返回0
+func (this *Router) requestedVersion(c *HttpContext) (int, string) {
+	options := this.versioning
+	ctx := c.RawCtx
+	path := string(ctx.Path())
+	if options.Strategies&VERSION_BY_PATH != 0 {
+		if m := versionPathRegexp.FindStringSubmatch(path); m != nil {
+			version, _ := strconv.Atoi(m[1])
+			return version, m[2]
+		}
+	}
+	if options.Strategies&VERSION_BY_HEADER != 0 {
+		header := strings.TrimPrefix(strings.TrimSpace(string(ctx.Request.Header.Peek(options.Header))), "v")
+		if version, err := strconv.Atoi(header); err == nil && version > 0 {
+			return version, path
+		}
+	}
+	if options.Strategies&VERSION_BY_ACCEPT != 0 {
+		for _, accept := range strings.Split(string(ctx.Request.Header.Peek("Accept")), ",") {
+			accept = strings.TrimSpace(accept)
+			if options.Vendor != "" && strings.HasPrefix(accept, "application/vnd.") &&
+				!strings.HasPrefix(accept, "application/vnd."+options.Vendor+".") {
+				continue
+			}
+			if m := versionAcceptRegexp.FindStringSubmatch(accept); m != nil {
+				v := m[1]
+				if v == "" {
+					v = m[2]
+				}
+				if version, err := strconv.Atoi(v); err == nil {
+					return version, path
+				}
+			}
+		}
+	}
+	return 0, path
+}
+
+// matchVersion 按请求的版本匹配路由, 从该版本向低版本回退, 均未命中时按原路径匹配
+func (this *Router) matchVersion(c *HttpContext) *RouterLocation {
+	if this.versioning == nil || len(this.versionList) == 0 {
+		return this.Match(string(c.RawCtx.Path()))
+	}
+	requested, path := this.requestedVersion(c)
+	if requested == 0 {
+		requested = this.versioning.Default
+		if requested == 0 {
+			requested = this.versionList[0]
+		}
+	}
+	for _, version := range this.versionList {
+		if version > requested {
+			continue
+		}
+		if n := this.Match("/v" + strconv.Itoa(version) + path); n != nil {
+			c.apiVersion = version
+			this.writeVersionHeaders(c, this.versions[version])
+			return n
+		}
+	}
+	return this.Match(string(c.RawCtx.Path()))
+}
+
+// writeVersionHeaders 返回实际版本及废弃、下线信息
+func (this *Router) writeVersionHeaders(c *HttpContext, version *ApiVersion) {
+	header := &c.RawCtx.Response.Header
+	header.Set(HEADER_API_VERSION, strconv.Itoa(version.Version))
+	if !version.Deprecation.IsZero() {
+		header.Set("Deprecation", "@"+strconv.FormatInt(version.Deprecation.Unix(), 10))
+		if version.Link != "" {
+			header.Add("Link", "<"+version.Link+`>; rel="deprecation"`)
+		}
+	}
+	if !version.Sunset.IsZero() {
+		header.Set("Sunset", version.Sunset.UTC().Format(http.TimeFormat))
+		if version.Link != "" {
+			header.Add("Link", "<"+version.Link+`>; rel="sunset"`)
+		}
+	}
+	if this.versioning.Strategies&(VERSION_BY_HEADER|VERSION_BY_ACCEPT) != 0 {
+		header.Add("Vary", this.versioning.Header)
+		header.Add("Vary", "Accept")
+	}
+}
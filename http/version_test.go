@@ -0,0 +1,73 @@
+package http
+
+import (
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestVersioning(t *testing.T) {
+	router := new(Router)
+	router.Init()
+	router.Versioning(&VersionOptions{Vendor: "demo"})
+	sunset := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	handler := func(name string) HandlerFunc {
+		return func(c *HttpContext) {
+			c.RawCtx.SetBodyString(name + ":" + c.RawCtx.QueryArgs().String())
+		}
+	}
+	router.VersionGroup(&ApiVersion{Version: 1, Deprecation: time.Unix(1700000000, 0), Sunset: sunset,
+		Link: "https://example.com/migrate"}, "/user", nil, func(group *RouterGroup) {
+		group.HandleFunc("/list", handler("v1 list"))
+		group.HandleFunc("/{id}", handler("v1 info"))
+	})
+	router.VersionGroup(&ApiVersion{Version: 2}, "/user", nil, func(group *RouterGroup) {
+		group.HandleFunc("/list", handler("v2 list"))
+	})
+	router.HandleFunc("/versions", VersionsHandler(router))
+	h := HttpHandler("", router)
+	do := func(uri string, header string, value string) *fasthttp.RequestCtx {
+		req := fasthttp.AcquireRequest()
+		req.SetRequestURI(uri)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Init(req, nil, nil)
+		h(ctx)
+		return ctx
+	}
+
+	cases := []struct {
+		uri, header, value, body, version string
+	}{
+		{"/v2/user/list", "", "", "v2 list:", "2"},
+		{"/v1/user/list", "", "", "v1 list:", "1"},
+		{"/user/list", "", "", "v2 list:", "2"},
+		{"/user/list", HEADER_API_VERSION, "v1", "v1 list:", "1"},
+		{"/user/list", "Accept", "application/vnd.demo.v1+json", "v1 list:", "1"},
+		{"/user/list", "Accept", "application/vnd.other.v1+json", "v2 list:", "2"},
+		{"/user/list", "Accept", "application/json; version=1", "v1 list:", "1"},
+		{"/v2/user/7", "", "", "v1 info:id=7", "1"},
+		{"/v9/user/list", "", "", "v2 list:", "2"},
+	}
+	for _, c := range cases {
+		ctx := do(c.uri, c.header, c.value)
+		if string(ctx.Response.Body()) != c.body || string(ctx.Response.Header.Peek(HEADER_API_VERSION)) != c.version {
+			t.Fatal(c, string(ctx.Response.Body()))
+		}
+	}
+
+	ctx := do("/v1/user/list", "", "")
+	if string(ctx.Response.Header.Peek("Deprecation")) != "@1700000000" ||
+		string(ctx.Response.Header.Peek("Sunset")) != "Tue, 01 Jan 2030 00:00:00 GMT" {
+		t.Fatal(ctx.Response.Header.String())
+	}
+	ctx = do("/versions", "", "")
+	if string(ctx.Response.Body()) != `{"ret":0,"msg":"","data":[{"version":1,"status":"deprecated",`+
+		`"deprecation":"`+time.Unix(1700000000, 0).Format(time.RFC3339)+`","sunset":"2030-01-01T00:00:00Z",`+
+		`"link":"https://example.com/migrate"},{"version":2,"status":"active"}]}` {
+		t.Fatal(string(ctx.Response.Body()))
+	}
+}
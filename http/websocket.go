@@ -0,0 +1,442 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/lxf9601/go-common/db"
+	"github.com/lxf9601/go-common/logc"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/fasthttp/websocket"
+	"github.com/go-redis/redis"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	WS_TEXT   = websocket.TextMessage
+	WS_BINARY = websocket.BinaryMessage
+
+	defaultWsSendQueueSize  = 256
+	defaultWsPingInterval   = 30 * time.Second
+	defaultWsPongTimeout    = 60 * time.Second
+	defaultWsWriteTimeout   = 10 * time.Second
+	defaultWsMaxMessageSize = 64 * 1024
+	defaultWsHubChannel     = "ws:hub"
+)
+
+var (
+	ErrWsClosed    = errors.New("websocket: connection closed")
+	ErrWsQueueFull = errors.New("websocket: send queue full")
+)
+
+// WebSocket路由配置
+type WsOptions struct {
+	Hub             *WsHub                                           // 连接所属的Hub, 为空时每个路由单独创建
+	OnOpen          func(conn *WsConn)                               // 连接建立
+	OnMessage       func(conn *WsConn, messageType int, data []byte) // 收到消息
+	OnClose         func(conn *WsConn)                               // 连接关闭
+	CheckOrigin     func(ctx *fasthttp.RequestCtx) bool              // 来源校验, 默认要求同源
+	ReadBufferSize  int                                              // 读缓冲区大小
+	WriteBufferSize int                                              // 写缓冲区大小
+	SendQueueSize   int                                              // 发送队列长度, 默认256
+	PingInterval    time.Duration                                    // 心跳间隔, 默认30秒
+	PongTimeout     time.Duration                                    // 未收到心跳响应的超时, 默认60秒
+	WriteTimeout    time.Duration                                    // 单条消息写超时, 默认10秒
+	MaxMessageSize  int64                                            // 单条消息大小上限, 默认64KB
+}
+
+type wsMessage struct {
+	messageType int
+	data        []byte
+}
+
+// WebSocket连接, 发送通过队列异步写出
+type WsConn struct {
+	Id        string            // 连接ID
+	RequestID string            // 升级请求的请求ID
+	ClientIP  string            // 客户端IP
+	Claims    jwt.MapClaims     // 升级请求的鉴权信息
+	Query     map[string]string // 升级请求的查询参数, 包含路径参数
+	conn      *websocket.Conn
+	hub       *WsHub
+	options   *WsOptions
+	send      chan *wsMessage
+	closed    chan struct{}
+	closeOnce sync.Once
+	lock      sync.RWMutex
+	values    map[string]interface{}
+}
+
+// Send 发送文本消息, 队列已满时返回ErrWsQueueFull, 由调用方决定重试或丢弃
+func (this *WsConn) Send(data []byte) error {
+	return this.SendMessage(WS_TEXT, data)
+}
+
+// SendJSON 以文本消息发送JSON
+func (this *WsConn) SendJSON(v interface{}) error {
+	j, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return this.SendMessage(WS_TEXT, j)
+}
+
+// SendMessage 发送指定类型的消息
+func (this *WsConn) SendMessage(messageType int, data []byte) error {
+	select {
+	case <-this.closed:
+		return ErrWsClosed
+	default:
+	}
+	select {
+	case this.send <- &wsMessage{messageType: messageType, data: data}:
+		return nil
+	case <-this.closed:
+		return ErrWsClosed
+	default:
+		return ErrWsQueueFull
+	}
+}
+
+// Join 加入房间
+func (this *WsConn) Join(room string) {
+	this.hub.Join(this, room)
+}
+
+// Leave 离开房间
+func (this *WsConn) Leave(room string) {
+	this.hub.Leave(this, room)
+}
+
+// Set 保存连接级数据
+func (this *WsConn) Set(key string, value interface{}) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.values == nil {
+		this.values = make(map[string]interface{})
+	}
+	this.values[key] = value
+}
+
+// Get 获取连接级数据
+func (this *WsConn) Get(key string) interface{} {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+	return this.values[key]
+}
+
+// Close 关闭连接, 写协程会发送关闭帧后断开
+func (this *WsConn) Close() {
+	this.closeOnce.Do(func() {
+		close(this.closed)
+	})
+}
+
+// run 处理已升级的连接, 返回时连接已关闭
+func (this *WsConn) run() {
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+		this.writeLoop()
+	}()
+	this.hub.add(this)
+	if this.options.OnOpen != nil {
+		this.options.OnOpen(this)
+	}
+	this.readLoop()
+	this.Close()
+	this.hub.remove(this)
+	if this.options.OnClose != nil {
+		this.options.OnClose(this)
+	}
+	<-writerDone
+}
+
+func (this *WsConn) readLoop() {
+	this.conn.SetReadLimit(this.options.MaxMessageSize)
+	this.conn.SetReadDeadline(time.Now().Add(this.options.PongTimeout))
+	this.conn.SetPongHandler(func(string) error {
+		return this.conn.SetReadDeadline(time.Now().Add(this.options.PongTimeout))
+	})
+	for {
+		messageType, data, err := this.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				logc.Debugf("websocket %s read: %s", this.Id, err)
+			}
+			return
+		}
+		this.conn.SetReadDeadline(time.Now().Add(this.options.PongTimeout))
+		if this.options.OnMessage != nil {
+			this.options.OnMessage(this, messageType, data)
+		}
+	}
+}
+
+func (this *WsConn) writeLoop() {
+	ticker := time.NewTicker(this.options.PingInterval)
+	defer ticker.Stop()
+	defer this.conn.Close()
+	for {
+		select {
+		case msg := <-this.send:
+			this.conn.SetWriteDeadline(time.Now().Add(this.options.WriteTimeout))
+			if err := this.conn.WriteMessage(msg.messageType, msg.data); err != nil {
+				this.Close()
+				return
+			}
+		case <-ticker.C:
+			this.conn.SetWriteDeadline(time.Now().Add(this.options.WriteTimeout))
+			if err := this.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				this.Close()
+				return
+			}
+		case <-this.closed:
+			this.conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+				time.Now().Add(this.options.WriteTimeout))
+			return
+		}
+	}
+}
+
+// WebSocket 注册WebSocket路由, 升级前经过与普通路由相同的中间件、拦截器和鉴权
+func (this *Router) WebSocket(url string, options *WsOptions) *RouterLocation {
+	return this.HandleFunc(url, wsHandler(options))
+}
+
+// WebSocket 注册WebSocket路由, 升级前经过分组的中间件、拦截器和鉴权
+func (this *RouterGroup) WebSocket(url string, options *WsOptions) *RouterLocation {
+	return this.HandleFunc(url, wsHandler(options))
+}
+
+func wsHandler(options *WsOptions) HandlerFunc {
+	opts := *options
+	if opts.Hub == nil {
+		opts.Hub = NewWsHub(&WsHubOptions{})
+	}
+	if opts.SendQueueSize <= 0 {
+		opts.SendQueueSize = defaultWsSendQueueSize
+	}
+	if opts.PingInterval <= 0 {
+		opts.PingInterval = defaultWsPingInterval
+	}
+	if opts.PongTimeout <= 0 {
+		opts.PongTimeout = defaultWsPongTimeout
+	}
+	if opts.WriteTimeout <= 0 {
+		opts.WriteTimeout = defaultWsWriteTimeout
+	}
+	if opts.MaxMessageSize <= 0 {
+		opts.MaxMessageSize = defaultWsMaxMessageSize
+	}
+	upgrader := &websocket.FastHTTPUpgrader{
+		ReadBufferSize:  opts.ReadBufferSize,
+		WriteBufferSize: opts.WriteBufferSize,
+		CheckOrigin:     opts.CheckOrigin,
+	}
+	return func(c *HttpContext) {
+		if !websocket.FastHTTPIsWebSocketUpgrade(c.RawCtx) {
+			c.RawCtx.Error(http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		// 升级后RequestCtx会被复用, 需提前复制请求信息
+		query := make(map[string]string)
+		c.RawCtx.QueryArgs().VisitAll(func(key, value []byte) {
+			query[string(key)] = string(value)
+		})
+		conn := &WsConn{
+			Id:        NewRequestID(),
+			RequestID: c.RequestID(),
+			ClientIP:  c.ClientIP(),
+			Claims:    c.Claims(),
+			Query:     query,
+			hub:       opts.Hub,
+			options:   &opts,
+			send:      make(chan *wsMessage, opts.SendQueueSize),
+			closed:    make(chan struct{}),
+		}
+		err := upgrader.Upgrade(c.RawCtx, func(ws *websocket.Conn) {
+			conn.conn = ws
+			conn.run()
+		})
+		if err != nil {
+			c.Logger().Debugf("websocket upgrade: %s", err)
+		}
+	}
+}
+
+// WebSocket Hub配置
+type WsHubOptions struct {
+	Redis   *db.Redis // 设置时通过Redis发布订阅在多个实例间广播
+	Channel string    // Redis频道, 默认ws:hub
+}
+
+// Redis广播消息
+type wsEnvelope struct {
+	Node string `json:"node"`
+	Room string `json:"room"`
+	Type int    `json:"type"`
+	Data []byte `json:"data"`
+}
+
+// WebSocket连接管理, 支持房间和广播
+type WsHub struct {
+	lock    sync.RWMutex
+	conns   map[*WsConn]map[string]bool
+	rooms   map[string]map[*WsConn]bool
+	redis   *db.Redis
+	channel string
+	nodeId  string
+	pubsub  *redis.PubSub
+}
+
+// NewWsHub 创建Hub, 配置Redis时订阅广播频道
+func NewWsHub(options *WsHubOptions) *WsHub {
+	hub := &WsHub{
+		conns:   make(map[*WsConn]map[string]bool),
+		rooms:   make(map[string]map[*WsConn]bool),
+		redis:   options.Redis,
+		channel: options.Channel,
+		nodeId:  NewRequestID(),
+	}
+	if hub.channel == "" {
+		hub.channel = defaultWsHubChannel
+	}
+	if hub.redis != nil {
+		hub.pubsub = hub.redis.Subscribe(hub.channel)
+		go hub.subscribe(hub.pubsub.Channel())
+	}
+	return hub
+}
+
+func (this *WsHub) add(conn *WsConn) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.conns[conn] == nil {
+		this.conns[conn] = make(map[string]bool)
+	}
+}
+
+func (this *WsHub) remove(conn *WsConn) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	for room := range this.conns[conn] {
+		this.leave(conn, room)
+	}
+	delete(this.conns, conn)
+}
+
+// Join 将连接加入房间
+func (this *WsHub) Join(conn *WsConn, room string) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	rooms := this.conns[conn]
+	if rooms == nil {
+		// 连接已关闭
+		return
+	}
+	rooms[room] = true
+	if this.rooms[room] == nil {
+		this.rooms[room] = make(map[*WsConn]bool)
+	}
+	this.rooms[room][conn] = true
+}
+
+// Leave 将连接移出房间
+func (this *WsHub) Leave(conn *WsConn, room string) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.leave(conn, room)
+}
+
+func (this *WsHub) leave(conn *WsConn, room string) {
+	delete(this.conns[conn], room)
+	if members := this.rooms[room]; members != nil {
+		delete(members, conn)
+		if len(members) == 0 {
+			delete(this.rooms, room)
+		}
+	}
+}
+
+// Count 房间内本实例的连接数, room为空时返回全部连接数
+func (this *WsHub) Count(room string) int {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+	if room == "" {
+		return len(this.conns)
+	}
+	return len(this.rooms[room])
+}
+
+// Broadcast 向房间广播文本消息, room为空时发送给全部连接
+func (this *WsHub) Broadcast(room string, data []byte) error {
+	return this.BroadcastMessage(room, WS_TEXT, data)
+}
+
+// BroadcastMessage 向房间广播消息, 配置Redis时同时发送到其他实例
+// 发送队列已满的慢连接会被关闭, 避免拖慢其他连接
+func (this *WsHub) BroadcastMessage(room string, messageType int, data []byte) error {
+	this.deliver(room, messageType, data)
+	if this.redis == nil {
+		return nil
+	}
+	j, err := json.Marshal(&wsEnvelope{Node: this.nodeId, Room: room, Type: messageType, Data: data})
+	if err != nil {
+		return err
+	}
+	return this.redis.Publish(this.channel, j).Err()
+}
+
+func (this *WsHub) deliver(room string, messageType int, data []byte) {
+	this.lock.RLock()
+	targets := make([]*WsConn, 0)
+	if room == "" {
+		for conn := range this.conns {
+			targets = append(targets, conn)
+		}
+	} else {
+		for conn := range this.rooms[room] {
+			targets = append(targets, conn)
+		}
+	}
+	this.lock.RUnlock()
+	for _, conn := range targets {
+		if err := conn.SendMessage(messageType, data); err == ErrWsQueueFull {
+			logc.Warnf("websocket %s send queue full, closing", conn.Id)
+			conn.Close()
+		}
+	}
+}
+
+func (this *WsHub) subscribe(messages <-chan *redis.Message) {
+	for msg := range messages {
+		envelope := new(wsEnvelope)
+		if err := json.Unmarshal([]byte(msg.Payload), envelope); err != nil {
+			logc.Errorf("websocket hub message: %s", err)
+			continue
+		}
+		if envelope.Node == this.nodeId {
+			continue
+		}
+		this.deliver(envelope.Room, envelope.Type, envelope.Data)
+	}
+}
+
+// Close 关闭全部连接并停止Redis订阅
+func (this *WsHub) Close() error {
+	this.lock.RLock()
+	for conn := range this.conns {
+		conn.Close()
+	}
+	this.lock.RUnlock()
+	if this.pubsub != nil {
+		return this.pubsub.Close()
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package http
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/fasthttp/websocket"
+	"github.com/go-redis/redis"
+	"github.com/lxf9601/go-common/db"
+	"github.com/valyala/fasthttp"
+)
+
+func TestWebSocketHub(t *testing.T) {
+	hub := NewWsHub(&WsHubOptions{})
+	defer hub.Close()
+	joined := make(chan bool, 2)
+	router := new(Router)
+	router.Init()
+	router.WebSocket("/ws/{room}", &WsOptions{
+		Hub:         hub,
+		CheckOrigin: func(ctx *fasthttp.RequestCtx) bool { return true },
+		OnOpen: func(conn *WsConn) {
+			conn.Set("room", conn.Query["room"])
+			conn.Join(conn.Query["room"])
+			joined <- true
+		},
+		OnMessage: func(conn *WsConn, messageType int, data []byte) {
+			hub.Broadcast(conn.Get("room").(string), data)
+		},
+	})
+
+	dial, closeFn := newTestServer(HttpHandler("", router))
+	defer closeFn()
+	dialer := &websocket.Dialer{NetDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return dial(addr)
+	}}
+	a, _, err := dialer.Dial("ws://test/ws/r1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	b, _, err := dialer.Dial("ws://test/ws/r1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	<-joined
+	<-joined
+
+	if err := a.WriteMessage(websocket.TextMessage, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	b.SetReadDeadline(time.Now().Add(5 * time.Second))
+	messageType, data, err := b.ReadMessage()
+	if err != nil || messageType != websocket.TextMessage || string(data) != "hello" {
+		t.Fatal(messageType, string(data), err)
+	}
+	if hub.Count("r1") != 2 || hub.Count("") != 2 {
+		t.Fatal(hub.Count("r1"), hub.Count(""))
+	}
+}
+
+func newWsTestConn(hub *WsHub, id string, room string) *WsConn {
+	conn := &WsConn{Id: id, hub: hub, send: make(chan *wsMessage, 8), closed: make(chan struct{})}
+	hub.add(conn)
+	conn.Join(room)
+	return conn
+}
+
+func wsTestReceive(t *testing.T, conn *WsConn, expected string) {
+	select {
+	case msg := <-conn.send:
+		if string(msg.data) != expected {
+			t.Fatal(conn.Id, "received", string(msg.data), "expected", expected)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal(conn.Id, "did not receive", expected)
+	}
+}
+
+func TestWebSocketHubRedis(t *testing.T) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+	r := &db.Redis{Client: client, KeyPrefix: "test:"}
+	a := NewWsHub(&WsHubOptions{Redis: r})
+	defer a.Close()
+	b := NewWsHub(&WsHubOptions{Redis: r})
+	defer b.Close()
+	channel := r.KeyPrefix + a.channel
+	for deadline := time.Now().Add(5 * time.Second); server.PubSubNumSub(channel)[channel] != 2; {
+		if time.Now().After(deadline) {
+			t.Fatal("hubs not subscribed", server.PubSubNumSub(channel))
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	connA := newWsTestConn(a, "a", "r1")
+	connB := newWsTestConn(b, "b", "r1")
+	connB2 := newWsTestConn(b, "b2", "r2")
+	if err := a.Broadcast("r1", []byte("from a")); err != nil {
+		t.Fatal(err)
+	}
+	wsTestReceive(t, connA, "from a")
+	wsTestReceive(t, connB, "from a")
+
+	if err := b.Broadcast("", []byte("from b")); err != nil {
+		t.Fatal(err)
+	}
+	wsTestReceive(t, connB, "from b")
+	wsTestReceive(t, connB2, "from b")
+	// 本实例发出的消息经Redis回到自身时应被忽略, 否则a会先收到重复的"from a"
+	wsTestReceive(t, connA, "from b")
+	time.Sleep(10 * time.Millisecond)
+	for _, conn := range []*WsConn{connA, connB, connB2} {
+		if len(conn.send) != 0 {
+			t.Fatal(conn.Id, "received unexpected messages", len(conn.send))
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package logc
 
 import (
+	"context"
 	"os"
+	"sync"
 
 	"github.com/gogap/logrus"
 )
@@ -56,3 +58,101 @@ func IsDebug() bool {
 func IsInfo() bool {
 	return logrus.GetLevel() >= logrus.InfoLevel
 }
+
+func Warn(args ...interface{}) {
+	logrus.Warn(args...)
+}
+
+func Warnf(format string, args ...interface{}) {
+	logrus.Warnf(format, args...)
+}
+
+// 日志字段
+type Fields map[string]interface{}
+
+// 带字段的日志, 用于输出请求ID等关联信息
+type Logger struct {
+	entry *logrus.Entry
+}
+
+func WithField(key string, value interface{}) *Logger {
+	return &Logger{logrus.WithField(key, value)}
+}
+
+func WithFields(fields Fields) *Logger {
+	return &Logger{logrus.WithFields(logrus.Fields(fields))}
+}
+
+// 从context提取日志字段, 如链路追踪ID, 返回nil表示没有字段
+type ContextFields func(ctx context.Context) Fields
+
+var (
+	contextFields     []ContextFields
+	contextFieldsLock sync.RWMutex
+)
+
+// RegisterContextFields 注册context日志字段提取函数, 供WithContext使用
+func RegisterContextFields(fn ContextFields) {
+	contextFieldsLock.Lock()
+	defer contextFieldsLock.Unlock()
+	contextFields = append(contextFields, fn)
+}
+
+// WithContext 带有ctx关联字段的日志
+func WithContext(ctx context.Context) *Logger {
+	return WithFields(Fields{}).WithContext(ctx)
+}
+
+// WithContext 附加ctx关联字段
+func (this *Logger) WithContext(ctx context.Context) *Logger {
+	contextFieldsLock.RLock()
+	fns := contextFields
+	contextFieldsLock.RUnlock()
+	entry := this.entry
+	for _, fn := range fns {
+		if fields := fn(ctx); len(fields) > 0 {
+			entry = entry.WithFields(logrus.Fields(fields))
+		}
+	}
+	return &Logger{entry}
+}
+
+func (this *Logger) WithField(key string, value interface{}) *Logger {
+	return &Logger{this.entry.WithField(key, value)}
+}
+
+func (this *Logger) WithFields(fields Fields) *Logger {
+	return &Logger{this.entry.WithFields(logrus.Fields(fields))}
+}
+
+func (this *Logger) Error(args ...interface{}) {
+	this.entry.Error(args...)
+}
+
+func (this *Logger) Errorf(format string, args ...interface{}) {
+	this.entry.Errorf(format, args...)
+}
+
+func (this *Logger) Warn(args ...interface{}) {
+	this.entry.Warn(args...)
+}
+
+func (this *Logger) Warnf(format string, args ...interface{}) {
+	this.entry.Warnf(format, args...)
+}
+
+func (this *Logger) Info(args ...interface{}) {
+	this.entry.Info(args...)
+}
+
+func (this *Logger) Infof(format string, args ...interface{}) {
+	this.entry.Infof(format, args...)
+}
+
+func (this *Logger) Debug(args ...interface{}) {
+	this.entry.Debug(args...)
+}
+
+func (this *Logger) Debugf(format string, args ...interface{}) {
+	this.entry.Debugf(format, args...)
+}
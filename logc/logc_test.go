@@ -1,9 +1,29 @@
 package logc
 
 import (
+	"context"
 	"testing"
 )
 
 func TestLog(t *testing.T) {
 	Infof("fdsafd%v%v", 1, 2)
 }
+
+type testContextKey struct{}
+
+func TestWithContext(t *testing.T) {
+	RegisterContextFields(func(ctx context.Context) Fields {
+		if v, ok := ctx.Value(testContextKey{}).(string); ok {
+			return Fields{"test_id": v}
+		}
+		return nil
+	})
+	logger := WithField("request_id", "r1").WithContext(context.WithValue(context.Background(), testContextKey{}, "t1"))
+	if logger.entry.Data["test_id"] != "t1" || logger.entry.Data["request_id"] != "r1" {
+		t.Fatal(logger.entry.Data)
+	}
+	if _, ok := WithContext(context.Background()).entry.Data["test_id"]; ok {
+		t.Fatal("fields without context value")
+	}
+	logger.Info("with context")
+}
@@ -0,0 +1,358 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	TYPE_COUNTER   = "counter"
+	TYPE_GAUGE     = "gauge"
+	TYPE_HISTOGRAM = "histogram"
+
+	// Prometheus文本格式的Content-Type
+	CONTENT_TYPE = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+// 默认直方图分桶(秒)
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// 默认注册中心
+var DefaultRegistry = NewRegistry()
+
+// 指标
+type collector interface {
+	name() string
+	kind() string
+	write(w *bufio.Writer)
+}
+
+// 指标注册中心
+type Registry struct {
+	lock       sync.RWMutex
+	collectors map[string]collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]collector)}
+}
+
+// register 按名称注册指标, 已存在同名同类型指标时返回已有指标
+func (this *Registry) register(c collector) collector {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if exist, ok := this.collectors[c.name()]; ok {
+		if exist.kind() != c.kind() {
+			panic("metrics: " + c.name() + " already registered as " + exist.kind())
+		}
+		return exist
+	}
+	this.collectors[c.name()] = c
+	return c
+}
+
+// WritePrometheus 以Prometheus文本格式输出所有指标
+func (this *Registry) WritePrometheus(w io.Writer) error {
+	this.lock.RLock()
+	names := make([]string, 0, len(this.collectors))
+	for name := range this.collectors {
+		names = append(names, name)
+	}
+	collectors := make([]collector, 0, len(names))
+	sort.Strings(names)
+	for _, name := range names {
+		collectors = append(collectors, this.collectors[name])
+	}
+	this.lock.RUnlock()
+
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(bw)
+	}
+	return bw.Flush()
+}
+
+// 指标公共部分: 名称、说明、标签及按标签值存储的序列
+type metric struct {
+	metricName string
+	help       string
+	labels     []string
+	lock       sync.Mutex
+	series     map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	buckets     []uint64
+	sum         float64
+	count       uint64
+}
+
+func (this *metric) init(name string, help string, labels []string) {
+	this.metricName = name
+	this.help = help
+	this.labels = labels
+	this.series = make(map[string]*series)
+}
+
+func (this *metric) name() string {
+	return this.metricName
+}
+
+// get 获取标签值对应的序列, 调用方需持有锁
+func (this *metric) get(labelValues []string) *series {
+	if len(labelValues) != len(this.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d",
+			this.metricName, len(this.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s := this.series[key]
+	if s == nil {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		this.series[key] = s
+	}
+	return s
+}
+
+// sorted 按标签值排序后的序列, 调用方需持有锁
+func (this *metric) sorted() []*series {
+	keys := make([]string, 0, len(this.series))
+	for k := range this.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	list := make([]*series, 0, len(keys))
+	for _, k := range keys {
+		list = append(list, this.series[k])
+	}
+	return list
+}
+
+func (this *metric) writeHeader(w *bufio.Writer, kind string) {
+	w.WriteString("# HELP " + this.metricName + " " + escapeHelp(this.help) + "\n")
+	w.WriteString("# TYPE " + this.metricName + " " + kind + "\n")
+}
+
+func (this *metric) writeSample(w *bufio.Writer, suffix string, labelValues []string,
+	extraName string, extraValue string, value float64) {
+	w.WriteString(this.metricName + suffix)
+	if len(this.labels) > 0 || extraName != "" {
+		w.WriteByte('{')
+		for i, l := range this.labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(l + `="` + escapeLabel(labelValues[i]) + `"`)
+		}
+		if extraName != "" {
+			if len(this.labels) > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(extraName + `="` + extraValue + `"`)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+// 计数器, 只增不减
+type Counter struct {
+	metric
+}
+
+// NewCounter 在默认注册中心创建计数器
+func NewCounter(name string, help string, labels ...string) *Counter {
+	return DefaultRegistry.NewCounter(name, help, labels...)
+}
+
+func (this *Registry) NewCounter(name string, help string, labels ...string) *Counter {
+	counter := new(Counter)
+	counter.init(name, help, labels)
+	return this.register(counter).(*Counter)
+}
+
+func (this *Counter) kind() string {
+	return TYPE_COUNTER
+}
+
+func (this *Counter) Inc(labelValues ...string) {
+	this.Add(1, labelValues...)
+}
+
+func (this *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic("metrics: counter " + this.metricName + " cannot decrease")
+	}
+	this.lock.Lock()
+	this.get(labelValues).value += v
+	this.lock.Unlock()
+}
+
+// Value 获取当前值
+func (this *Counter) Value(labelValues ...string) float64 {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return this.get(labelValues).value
+}
+
+func (this *Counter) write(w *bufio.Writer) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.writeHeader(w, TYPE_COUNTER)
+	for _, s := range this.sorted() {
+		this.writeSample(w, "", s.labelValues, "", "", s.value)
+	}
+}
+
+// 仪表盘, 可增可减
+type Gauge struct {
+	metric
+}
+
+// NewGauge 在默认注册中心创建仪表盘
+func NewGauge(name string, help string, labels ...string) *Gauge {
+	return DefaultRegistry.NewGauge(name, help, labels...)
+}
+
+func (this *Registry) NewGauge(name string, help string, labels ...string) *Gauge {
+	gauge := new(Gauge)
+	gauge.init(name, help, labels)
+	return this.register(gauge).(*Gauge)
+}
+
+func (this *Gauge) kind() string {
+	return TYPE_GAUGE
+}
+
+func (this *Gauge) Set(v float64, labelValues ...string) {
+	this.lock.Lock()
+	this.get(labelValues).value = v
+	this.lock.Unlock()
+}
+
+func (this *Gauge) Add(v float64, labelValues ...string) {
+	this.lock.Lock()
+	this.get(labelValues).value += v
+	this.lock.Unlock()
+}
+
+func (this *Gauge) Inc(labelValues ...string) {
+	this.Add(1, labelValues...)
+}
+
+func (this *Gauge) Dec(labelValues ...string) {
+	this.Add(-1, labelValues...)
+}
+
+// Value 获取当前值
+func (this *Gauge) Value(labelValues ...string) float64 {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return this.get(labelValues).value
+}
+
+func (this *Gauge) write(w *bufio.Writer) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.writeHeader(w, TYPE_GAUGE)
+	for _, s := range this.sorted() {
+		this.writeSample(w, "", s.labelValues, "", "", s.value)
+	}
+}
+
+// 直方图, 统计分布
+type Histogram struct {
+	metric
+	buckets []float64
+}
+
+// NewHistogram 在默认注册中心创建直方图, buckets为空时使用DefBuckets
+func NewHistogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	return DefaultRegistry.NewHistogram(name, help, buckets, labels...)
+}
+
+func (this *Registry) NewHistogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefBuckets
+	}
+	histogram := &Histogram{buckets: append([]float64(nil), buckets...)}
+	sort.Float64s(histogram.buckets)
+	histogram.init(name, help, labels)
+	return this.register(histogram).(*Histogram)
+}
+
+func (this *Histogram) kind() string {
+	return TYPE_HISTOGRAM
+}
+
+func (this *Histogram) Observe(v float64, labelValues ...string) {
+	i := sort.SearchFloat64s(this.buckets, v)
+	this.lock.Lock()
+	s := this.get(labelValues)
+	if s.buckets == nil {
+		s.buckets = make([]uint64, len(this.buckets))
+	}
+	if i < len(this.buckets) {
+		s.buckets[i]++
+	}
+	s.sum += v
+	s.count++
+	this.lock.Unlock()
+}
+
+// Count 获取观测次数
+func (this *Histogram) Count(labelValues ...string) uint64 {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return this.get(labelValues).count
+}
+
+func (this *Histogram) write(w *bufio.Writer) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.writeHeader(w, TYPE_HISTOGRAM)
+	for _, s := range this.sorted() {
+		var cumulative uint64
+		for i, upper := range this.buckets {
+			if s.buckets != nil {
+				cumulative += s.buckets[i]
+			}
+			this.writeSample(w, "_bucket", s.labelValues, "le", formatFloat(upper), float64(cumulative))
+		}
+		this.writeSample(w, "_bucket", s.labelValues, "le", "+Inf", float64(s.count))
+		this.writeSample(w, "_sum", s.labelValues, "", "", s.sum)
+		this.writeSample(w, "_count", s.labelValues, "", "", float64(s.count))
+	}
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var helpReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+var labelReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelReplacer.Replace(s)
+}
@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	registry := NewRegistry()
+	counter := registry.NewCounter("jobs_total", "Jobs processed.", "queue", "result")
+	counter.Inc("mail", "ok")
+	counter.Add(2, "mail", "ok")
+	counter.Inc("sms\n\"x\"", "error")
+	if registry.NewCounter("jobs_total", "Jobs processed.", "queue", "result") != counter {
+		t.Fatal("registering the same counter twice must return the existing one")
+	}
+	registry.NewGauge("workers", "Busy workers.").Set(3)
+	histogram := registry.NewHistogram("latency_seconds", "Latency.", []float64{0.5, 0.1}, "op")
+	histogram.Observe(0.05, "get")
+	histogram.Observe(0.3, "get")
+	histogram.Observe(2, "get")
+
+	buf := new(bytes.Buffer)
+	if err := registry.WritePrometheus(buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := `# HELP jobs_total Jobs processed.
+# TYPE jobs_total counter
+jobs_total{queue="mail",result="ok"} 3
+jobs_total{queue="sms\n\"x\"",result="error"} 1
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{op="get",le="0.1"} 1
+latency_seconds_bucket{op="get",le="0.5"} 2
+latency_seconds_bucket{op="get",le="+Inf"} 3
+latency_seconds_sum{op="get"} 2.35
+latency_seconds_count{op="get"} 3
+# HELP workers Busy workers.
+# TYPE workers gauge
+workers 3
+`
+	if buf.String() != expected {
+		t.Fatalf("got:\n%s", buf.String())
+	}
+}
+
+func TestRegisterTypeMismatch(t *testing.T) {
+	registry := NewRegistry()
+	registry.NewCounter("x", "")
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic")
+		}
+	}()
+	registry.NewGauge("x", "")
+}
@@ -0,0 +1,47 @@
+package registry
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lxf9601/go-common/logc"
+)
+
+// 服务发现, 实现http.Discovery, 用于MicroSrvApiOptions.Discovery
+type Discovery struct {
+	registry  *Registry
+	name      string
+	lock      sync.Mutex
+	endpoints []string
+	expires   time.Time
+}
+
+// Discovery 创建服务的服务发现, 按心跳间隔刷新实例
+func (this *Registry) Discovery(name string) *Discovery {
+	return &Discovery{registry: this, name: name}
+}
+
+// Endpoints 存活实例的地址, 读取失败时沿用上次结果
+func (this *Discovery) Endpoints() ([]string, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if time.Now().Before(this.expires) {
+		return this.endpoints, nil
+	}
+	instances, err := this.registry.Instances(this.name)
+	if err != nil {
+		if this.endpoints != nil {
+			logc.Warnf("registry: discovery %s: %s, using cached endpoints", this.name, err)
+			this.expires = time.Now().Add(this.registry.options.Heartbeat)
+			return this.endpoints, nil
+		}
+		return nil, err
+	}
+	endpoints := make([]string, len(instances))
+	for i, instance := range instances {
+		endpoints[i] = instance.Address
+	}
+	this.endpoints = endpoints
+	this.expires = time.Now().Add(this.registry.options.Heartbeat)
+	return endpoints, nil
+}
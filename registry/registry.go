@@ -0,0 +1,226 @@
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lxf9601/go-common/db"
+	"github.com/lxf9601/go-common/logc"
+)
+
+const (
+	defaultPrefix        = "registry:"
+	defaultTTL           = 15 * time.Second
+	defaultWatchInterval = 5 * time.Second
+)
+
+var ErrInvalidInstance = errors.New("registry: instance name and address are required")
+
+// 服务实例
+type Instance struct {
+	Id       string            `json:"id"`                 // 实例ID, 默认为Address
+	Name     string            `json:"name"`               // 服务名
+	Address  string            `json:"address"`            // 服务地址, 格式同MicroSrvApi.Url, 如http://10.0.0.1:8080/api
+	Metadata map[string]string `json:"metadata,omitempty"` // 元数据, 如版本、机房
+}
+
+// 注册中心配置
+type RegistryOptions struct {
+	Redis     *db.Redis     // Redis服务
+	Prefix    string        // 键前缀, 默认registry:
+	TTL       time.Duration // 实例过期时间, 超过该时间未心跳视为下线, 默认15秒
+	Heartbeat time.Duration // 心跳间隔, 默认TTL的1/3
+}
+
+// 基于Redis的服务注册中心
+// 每个服务使用一个有序集合(成员为实例ID, 分数为过期时间)和一个哈希(实例ID到实例JSON)
+type Registry struct {
+	redis         *db.Redis
+	options       RegistryOptions
+	lock          sync.Mutex
+	registrations map[string]*registration
+}
+
+// 已注册实例及其心跳
+type registration struct {
+	instance *Instance
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func NewRegistry(options *RegistryOptions) *Registry {
+	opts := *options
+	if opts.Prefix == "" {
+		opts.Prefix = defaultPrefix
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = defaultTTL
+	}
+	if opts.Heartbeat <= 0 || opts.Heartbeat >= opts.TTL {
+		opts.Heartbeat = opts.TTL / 3
+	}
+	return &Registry{redis: opts.Redis, options: opts, registrations: make(map[string]*registration)}
+}
+
+// 注册或续期实例, 同时设置两个键的过期时间, 服务所有实例下线后自动清理
+const registerScript = `
+redis.call('zadd', KEYS[1], ARGV[1], ARGV[2])
+redis.call('hset', KEYS[2], ARGV[2], ARGV[3])
+redis.call('pexpire', KEYS[1], ARGV[4])
+redis.call('pexpire', KEYS[2], ARGV[4])
+return 1`
+
+// 注销实例
+const deregisterScript = `
+redis.call('zrem', KEYS[1], ARGV[1])
+redis.call('hdel', KEYS[2], ARGV[1])
+return 1`
+
+// 清理过期实例并返回存活实例的JSON
+const instancesScript = `
+local expired = redis.call('zrangebyscore', KEYS[1], '-inf', '(' .. ARGV[1])
+if #expired > 0 then
+	redis.call('zremrangebyscore', KEYS[1], '-inf', '(' .. ARGV[1])
+	redis.call('hdel', KEYS[2], unpack(expired))
+end
+local ids = redis.call('zrangebyscore', KEYS[1], ARGV[1], '+inf')
+if #ids == 0 then
+	return {}
+end
+return redis.call('hmget', KEYS[2], unpack(ids))`
+
+// keys 服务的有序集合和哈希键, 包含db.Redis的KeyPrefix
+func (this *Registry) keys(name string) []string {
+	key := this.redis.KeyPrefix + this.options.Prefix + name
+	return []string{key, key + ":instances"}
+}
+
+func nowMillis() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
+
+// Register 注册实例并定时心跳, 重复注册同一实例会更新实例信息
+// 优雅退出时调用Deregister或Close注销, 如 server.OnShutdown(func() { registry.Close() })
+func (this *Registry) Register(instance *Instance) error {
+	if instance.Name == "" || instance.Address == "" {
+		return ErrInvalidInstance
+	}
+	inst := *instance
+	if inst.Id == "" {
+		inst.Id = inst.Address
+	}
+	if err := this.heartbeat(&inst); err != nil {
+		return err
+	}
+	reg := &registration{instance: &inst, stop: make(chan struct{}), done: make(chan struct{})}
+	key := inst.Name + "/" + inst.Id
+	this.lock.Lock()
+	old := this.registrations[key]
+	this.registrations[key] = reg
+	this.lock.Unlock()
+	if old != nil {
+		close(old.stop)
+		<-old.done
+	}
+	go this.keepAlive(reg)
+	logc.Infof("registry: registered %s %s at %s", inst.Name, inst.Id, inst.Address)
+	return nil
+}
+
+// heartbeat 写入实例并续期
+func (this *Registry) heartbeat(instance *Instance) error {
+	j, err := json.Marshal(instance)
+	if err != nil {
+		return err
+	}
+	ttl := int64(this.options.TTL / time.Millisecond)
+	return this.redis.Client.Eval(registerScript, this.keys(instance.Name),
+		nowMillis()+ttl, instance.Id, string(j), ttl).Err()
+}
+
+func (this *Registry) keepAlive(reg *registration) {
+	defer close(reg.done)
+	ticker := time.NewTicker(this.options.Heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-reg.stop:
+			return
+		case <-ticker.C:
+			if err := this.heartbeat(reg.instance); err != nil {
+				logc.Warnf("registry: heartbeat %s %s: %s", reg.instance.Name, reg.instance.Id, err)
+			}
+		}
+	}
+}
+
+// Deregister 停止心跳并注销实例
+func (this *Registry) Deregister(instance *Instance) error {
+	id := instance.Id
+	if id == "" {
+		id = instance.Address
+	}
+	key := instance.Name + "/" + id
+	this.lock.Lock()
+	reg := this.registrations[key]
+	delete(this.registrations, key)
+	this.lock.Unlock()
+	if reg != nil {
+		close(reg.stop)
+		<-reg.done
+	}
+	if err := this.redis.Client.Eval(deregisterScript, this.keys(instance.Name), id).Err(); err != nil {
+		return err
+	}
+	logc.Infof("registry: deregistered %s %s", instance.Name, id)
+	return nil
+}
+
+// Close 注销本注册中心注册的所有实例
+func (this *Registry) Close() error {
+	this.lock.Lock()
+	instances := make([]*Instance, 0, len(this.registrations))
+	for _, reg := range this.registrations {
+		instances = append(instances, reg.instance)
+	}
+	this.lock.Unlock()
+	var lastErr error
+	for _, instance := range instances {
+		if err := this.Deregister(instance); err != nil {
+			logc.Errorf("registry: deregister %s %s: %s", instance.Name, instance.Id, err)
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// Instances 获取服务的存活实例, 按ID排序, 同时清理过期实例
+func (this *Registry) Instances(name string) ([]*Instance, error) {
+	res, err := this.redis.Client.Eval(instancesScript, this.keys(name), nowMillis()).Result()
+	if err != nil {
+		return nil, err
+	}
+	vals, ok := res.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("registry: unexpected result %T", res)
+	}
+	instances := make([]*Instance, 0, len(vals))
+	for _, val := range vals {
+		s, ok := val.(string)
+		if !ok {
+			continue
+		}
+		instance := new(Instance)
+		if err := json.Unmarshal([]byte(s), instance); err != nil {
+			logc.Warnf("registry: invalid instance %s: %s", s, err)
+			continue
+		}
+		instances = append(instances, instance)
+	}
+	sort.Slice(instances, func(i, j int) bool { return instances[i].Id < instances[j].Id })
+	return instances, nil
+}
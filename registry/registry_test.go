@@ -0,0 +1,116 @@
+package registry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+	"github.com/lxf9601/go-common/db"
+	"github.com/lxf9601/go-common/http"
+)
+
+var _ http.Discovery = (*Discovery)(nil)
+
+func newTestRegistry(t *testing.T, ttl time.Duration) (*Registry, func()) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	registry := NewRegistry(&RegistryOptions{Redis: &db.Redis{Client: client, KeyPrefix: "test:"}, TTL: ttl})
+	return registry, func() {
+		client.Close()
+		server.Close()
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	registry, closeFn := newTestRegistry(t, 300*time.Millisecond)
+	defer closeFn()
+	if err := registry.Register(&Instance{Name: "user"}); err != ErrInvalidInstance {
+		t.Fatal(err)
+	}
+	a := &Instance{Name: "user", Address: "http://10.0.0.1/api", Metadata: map[string]string{"zone": "a"}}
+	b := &Instance{Name: "user", Id: "b", Address: "http://10.0.0.2/api"}
+	if err := registry.Register(a); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Register(b); err != nil {
+		t.Fatal(err)
+	}
+
+	// 心跳续期, 超过TTL后实例仍存活
+	time.Sleep(400 * time.Millisecond)
+	instances, err := registry.Instances("user")
+	if err != nil || len(instances) != 2 || instances[0].Id != "b" || instances[1].Id != a.Address ||
+		instances[1].Metadata["zone"] != "a" {
+		t.Fatal(instances, err)
+	}
+
+	if err := registry.Deregister(b); err != nil {
+		t.Fatal(err)
+	}
+	if instances, _ := registry.Instances("user"); len(instances) != 1 || instances[0].Address != a.Address {
+		t.Fatal(instances)
+	}
+
+	// 停止心跳而不注销, 模拟进程崩溃, 实例在TTL后过期
+	registry.lock.Lock()
+	for _, reg := range registry.registrations {
+		close(reg.stop)
+		<-reg.done
+	}
+	registry.registrations = make(map[string]*registration)
+	registry.lock.Unlock()
+	time.Sleep(400 * time.Millisecond)
+	if instances, _ := registry.Instances("user"); len(instances) != 0 {
+		t.Fatal(instances)
+	}
+}
+
+func TestRegistryWatchAndDiscovery(t *testing.T) {
+	registry, closeFn := newTestRegistry(t, time.Second)
+	defer closeFn()
+	changes := make(chan []*Instance, 10)
+	watcher := registry.Watch("order", &WatchOptions{Interval: 10 * time.Millisecond}, func(instances []*Instance) {
+		changes <- instances
+	})
+	defer watcher.Close()
+	if instances := <-changes; len(instances) != 0 {
+		t.Fatal(instances)
+	}
+
+	registry.Register(&Instance{Name: "order", Address: "http://10.0.0.3/api"})
+	select {
+	case instances := <-changes:
+		if len(instances) != 1 || instances[0].Address != "http://10.0.0.3/api" {
+			t.Fatal(instances)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("membership change not observed")
+	}
+
+	api := http.NewMicroSrvApi(&http.MicroSrvApiOptions{Discovery: registry.Discovery("order"), Timeout: time.Second})
+	endpoints, err := registry.Discovery("order").Endpoints()
+	if err != nil || len(endpoints) != 1 || endpoints[0] != "http://10.0.0.3/api" {
+		t.Fatal(endpoints, err)
+	}
+
+	registry.Close()
+	select {
+	case instances := <-changes:
+		if len(instances) != 0 {
+			t.Fatal(instances)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("deregistration not observed")
+	}
+	if endpoints, _ := registry.Discovery("order").Endpoints(); len(endpoints) != 0 {
+		t.Fatal(endpoints)
+	}
+	if _, err := api.NewRequest("GET", "/order").Do(context.Background(), nil); err == nil {
+		t.Fatal("request without instances must fail")
+	}
+}
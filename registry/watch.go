@@ -0,0 +1,84 @@
+package registry
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/lxf9601/go-common/logc"
+)
+
+// 监听配置
+type WatchOptions struct {
+	Interval time.Duration // 轮询间隔, 默认5秒, 实例过期不会触发通知, 总是需要轮询
+	Keyspace bool          // 同时订阅键空间通知, 需Redis开启notify-keyspace-events Kz
+}
+
+// 成员变化监听
+type Watcher struct {
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// Watch 监听服务成员变化, 立即回调一次当前成员, 之后成员变化时回调
+func (this *Registry) Watch(name string, options *WatchOptions, fn func([]*Instance)) *Watcher {
+	interval := options.Interval
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+	watcher := &Watcher{stop: make(chan struct{}), done: make(chan struct{})}
+	var pubsub *redis.PubSub
+	if options.Keyspace {
+		channel := fmt.Sprintf("__keyspace@%d__:%s", this.redis.Client.Options().DB, this.keys(name)[0])
+		pubsub = this.redis.Client.Subscribe(channel)
+	}
+	go this.watch(name, interval, pubsub, fn, watcher)
+	return watcher
+}
+
+func (this *Registry) watch(name string, interval time.Duration, pubsub *redis.PubSub, fn func([]*Instance), watcher *Watcher) {
+	defer close(watcher.done)
+	var notify <-chan *redis.Message
+	if pubsub != nil {
+		defer pubsub.Close()
+		notify = pubsub.Channel()
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var last string
+	first := true
+	for {
+		if instances, err := this.Instances(name); err != nil {
+			logc.Warnf("registry: watch %s: %s", name, err)
+		} else if key := membership(instances); first || key != last {
+			first = false
+			last = key
+			fn(instances)
+		}
+		select {
+		case <-watcher.stop:
+			return
+		case <-ticker.C:
+		case <-notify:
+		}
+	}
+}
+
+// membership 成员标识, 用于判断成员是否变化
+func membership(instances []*Instance) string {
+	key := ""
+	for _, instance := range instances {
+		key += instance.Id + "=" + instance.Address + "\n"
+	}
+	return key
+}
+
+// Close 停止监听
+func (this *Watcher) Close() {
+	this.stopOnce.Do(func() {
+		close(this.stop)
+	})
+	<-this.done
+}
@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// 本地磁盘存储配置
+type LocalOptions struct {
+	Root    string // 存储根目录
+	BaseURL string // 访问地址前缀, 如 https://static.example.com/upload
+}
+
+// 本地磁盘存储
+type Local struct {
+	root    string
+	baseURL string
+}
+
+// NewLocal 创建本地存储, 根目录不存在时自动创建
+func NewLocal(options *LocalOptions) (*Local, error) {
+	root, err := filepath.Abs(options.Root)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	return &Local{root: root, baseURL: strings.TrimRight(options.BaseURL, "/")}, nil
+}
+
+func (this *Local) path(key string) (string, string, error) {
+	key, err := CleanKey(key)
+	if err != nil {
+		return "", "", err
+	}
+	return key, filepath.Join(this.root, filepath.FromSlash(key)), nil
+}
+
+// URL 返回对象访问地址
+func (this *Local) URL(key string) string {
+	if this.baseURL == "" {
+		return ""
+	}
+	if cleaned, err := CleanKey(key); err == nil {
+		key = cleaned
+	}
+	return this.baseURL + "/" + key
+}
+
+// Put 先写入临时文件再重命名, 避免读到写了一半的文件
+func (this *Local) Put(key string, reader io.Reader, size int64, options *PutOptions) (*Object, error) {
+	key, file, err := this.path(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return nil, err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(file), ".upload-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	hash := md5.New()
+	n, err := io.Copy(io.MultiWriter(tmp, hash), reader)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if size >= 0 && n != size {
+		return nil, fmt.Errorf("storage: size mismatch, expect %d got %d", size, n)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+	obj := this.object(key, info)
+	obj.ETag = hex.EncodeToString(hash.Sum(nil))
+	if options != nil && options.ContentType != "" {
+		obj.ContentType = options.ContentType
+	}
+	return obj, nil
+}
+
+// Get 读取对象
+func (this *Local) Get(key string) (io.ReadCloser, *Object, error) {
+	key, file, err := this.path(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, ErrNotFound
+		}
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if info.IsDir() {
+		f.Close()
+		return nil, nil, ErrNotFound
+	}
+	return f, this.object(key, info), nil
+}
+
+// Delete 删除对象
+func (this *Local) Delete(key string) error {
+	_, file, err := this.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (this *Local) object(key string, info os.FileInfo) *Object {
+	return &Object{
+		Key:          key,
+		Size:         info.Size(),
+		ContentType:  mime.TypeByExtension(path.Ext(key)),
+		LastModified: info.ModTime(),
+		URL:          this.URL(key),
+	}
+}
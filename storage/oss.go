@@ -0,0 +1,474 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lxf9601/go-common/conf"
+)
+
+const (
+	ossMetaPrefix = "x-oss-meta-"
+
+	defaultOssPartSize           = 10 * 1024 * 1024
+	defaultOssMultipartThreshold = 100 * 1024 * 1024
+	// OSS要求除最后一个分片外不小于100KB
+	ossMinPartSize = 100 * 1024
+)
+
+// OSS错误响应
+type OssError struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+	RequestId  string `xml:"RequestId"`
+}
+
+func (this *OssError) Error() string {
+	return fmt.Sprintf("oss: %d %s: %s (request id %s)", this.StatusCode, this.Code, this.Message, this.RequestId)
+}
+
+// 阿里云OSS及兼容服务存储, 使用OSS V1签名
+type Oss struct {
+	Client             *http.Client // 为空时使用http.DefaultClient
+	PathStyle          bool         // 使用 endpoint/bucket/key 形式访问, endpoint为IP或localhost时自动开启
+	Internal           bool         // 部署在阿里云内网, URL优先使用DomainInternal
+	PartSize           int64        // 分片大小, 默认10MB
+	MultipartThreshold int64        // 超过该大小使用分片上传, 默认100MB
+	conf               *conf.AliyunOssConf
+	scheme             string
+	host               string
+}
+
+// NewOss 根据配置创建OSS存储, Endpoint未指定协议时使用https
+func NewOss(ossConf *conf.AliyunOssConf) *Oss {
+	endpoint := ossConf.Endpoint
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		u = &url.URL{Scheme: "https", Host: ossConf.Endpoint}
+	}
+	host := u.Hostname()
+	return &Oss{
+		PathStyle: host == "localhost" || net.ParseIP(host) != nil,
+		conf:      ossConf,
+		scheme:    u.Scheme,
+		host:      u.Host,
+	}
+}
+
+// objectKey 返回规范化后的键及加上KeyPrefix的对象键
+func (this *Oss) objectKey(key string) (string, string, error) {
+	key, err := CleanKey(key)
+	if err != nil {
+		return "", "", err
+	}
+	return key, this.conf.KeyPrefix + key, nil
+}
+
+// URL 返回对象访问地址, Internal为true时优先使用DomainInternal, 否则优先使用DomainPub1
+// 均未配置时使用bucket地址, 私有bucket需使用PresignGet
+func (this *Oss) URL(key string) string {
+	if cleaned, err := CleanKey(key); err == nil {
+		key = cleaned
+	}
+	domains := []string{this.conf.DomainPub1, this.conf.DomainInternal}
+	if this.Internal {
+		domains[0], domains[1] = domains[1], domains[0]
+	}
+	for _, domain := range domains {
+		if domain != "" {
+			return domainURL(domain, this.conf.KeyPrefix+key)
+		}
+	}
+	return this.requestURL(this.conf.KeyPrefix+key, nil)
+}
+
+func domainURL(domain string, objectKey string) string {
+	if !strings.Contains(domain, "://") {
+		domain = "https://" + domain
+	}
+	return strings.TrimRight(domain, "/") + "/" + escapeKey(objectKey)
+}
+
+func escapeKey(objectKey string) string {
+	segments := strings.Split(objectKey, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func (this *Oss) requestURL(objectKey string, query url.Values) string {
+	u := this.scheme + "://"
+	if this.PathStyle {
+		u += this.host + "/" + this.conf.Bucket + "/"
+	} else {
+		u += this.conf.Bucket + "." + this.host + "/"
+	}
+	u += escapeKey(objectKey)
+	if len(query) > 0 {
+		// 子资源如 uploads 没有值, 不能编码为 uploads=
+		params := make([]string, 0, len(query))
+		for k, vs := range query {
+			for _, v := range vs {
+				if v == "" {
+					params = append(params, url.QueryEscape(k))
+				} else {
+					params = append(params, url.QueryEscape(k)+"="+url.QueryEscape(v))
+				}
+			}
+		}
+		sort.Strings(params)
+		u += "?" + strings.Join(params, "&")
+	}
+	return u
+}
+
+// 参与签名的子资源
+var ossSubResources = map[string]bool{
+	"acl": true, "uploads": true, "location": true, "cors": true, "logging": true,
+	"website": true, "referer": true, "lifecycle": true, "delete": true, "append": true,
+	"tagging": true, "objectMeta": true, "uploadId": true, "partNumber": true,
+	"security-token": true, "position": true, "response-content-type": true,
+	"response-content-language": true, "response-expires": true, "response-cache-control": true,
+	"response-content-disposition": true, "response-content-encoding": true,
+}
+
+// stringToSign 计算OSS V1签名原文, date在预签名时为过期时间戳
+func (this *Oss) stringToSign(method string, header http.Header, objectKey string, query url.Values, date string) string {
+	ossHeaders := make([]string, 0)
+	for k, vs := range header {
+		k = strings.ToLower(k)
+		if strings.HasPrefix(k, "x-oss-") {
+			ossHeaders = append(ossHeaders, k+":"+strings.TrimSpace(strings.Join(vs, ",")))
+		}
+	}
+	sort.Strings(ossHeaders)
+	resource := "/" + this.conf.Bucket + "/" + objectKey
+	subs := make([]string, 0)
+	for k, vs := range query {
+		if !ossSubResources[k] {
+			continue
+		}
+		if len(vs) == 0 || vs[0] == "" {
+			subs = append(subs, k)
+		} else {
+			subs = append(subs, k+"="+vs[0])
+		}
+	}
+	if len(subs) > 0 {
+		sort.Strings(subs)
+		resource += "?" + strings.Join(subs, "&")
+	}
+	s := method + "\n" + header.Get("Content-MD5") + "\n" + header.Get("Content-Type") + "\n" + date + "\n"
+	for _, h := range ossHeaders {
+		s += h + "\n"
+	}
+	return s + resource
+}
+
+func (this *Oss) signature(stringToSign string) string {
+	mac := hmac.New(sha1.New, []byte(this.conf.AccessKeySecret))
+	mac.Write([]byte(stringToSign))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// do 发送签名请求, 非2xx响应转换为OssError
+func (this *Oss) do(method string, objectKey string, query url.Values, header http.Header, body io.Reader, size int64) (*http.Response, error) {
+	req, err := http.NewRequest(method, this.requestURL(objectKey, query), body)
+	if err != nil {
+		return nil, err
+	}
+	if header != nil {
+		req.Header = header
+	}
+	if body != nil {
+		req.ContentLength = size
+		if size == 0 {
+			req.Body = http.NoBody
+		}
+	}
+	date := time.Now().UTC().Format(http.TimeFormat)
+	req.Header.Set("Date", date)
+	req.Header.Set("Authorization", "OSS "+this.conf.AccessKeyID+":"+
+		this.signature(this.stringToSign(method, req.Header, objectKey, query, date)))
+	client := this.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		ossErr := &OssError{StatusCode: resp.StatusCode}
+		if b, err := ioutil.ReadAll(resp.Body); err == nil && len(b) > 0 {
+			xml.Unmarshal(b, ossErr)
+		}
+		if ossErr.Code == "" {
+			ossErr.Code = http.StatusText(resp.StatusCode)
+		}
+		return nil, ossErr
+	}
+	return resp, nil
+}
+
+// isNotFound 判断是否为对象不存在
+func isNotFound(err error) bool {
+	ossErr, ok := err.(*OssError)
+	return ok && ossErr.StatusCode == http.StatusNotFound
+}
+
+// Put 上传对象, 超过MultipartThreshold或size未知且超过PartSize时使用分片上传
+func (this *Oss) Put(key string, reader io.Reader, size int64, options *PutOptions) (*Object, error) {
+	key, objectKey, err := this.objectKey(key)
+	if err != nil {
+		return nil, err
+	}
+	obj := &Object{Key: key, URL: this.URL(key)}
+	header := make(http.Header)
+	if options != nil {
+		obj.ContentType = options.ContentType
+		obj.Metadata = options.Metadata
+		if options.ContentDisposition != "" {
+			header.Set("Content-Disposition", options.ContentDisposition)
+		}
+		for k, v := range options.Metadata {
+			header.Set(ossMetaPrefix+strings.ToLower(k), v)
+		}
+	}
+	if obj.ContentType == "" {
+		obj.ContentType = "application/octet-stream"
+	}
+	header.Set("Content-Type", obj.ContentType)
+	partSize := this.partSize()
+	if size < 0 {
+		// 大小未知时先读取一个分片, 不足一个分片则直接上传
+		part := this.acquirePart()
+		defer releasePart(part)
+		head := *part
+		n, err := io.ReadFull(reader, head)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return nil, err
+		}
+		if int64(n) < partSize {
+			hash := md5.Sum(head[:n])
+			header.Set("Content-MD5", base64.StdEncoding.EncodeToString(hash[:]))
+			return this.putObject(obj, objectKey, bytes.NewReader(head[:n]), int64(n), header)
+		}
+		return this.putMultipart(obj, objectKey, io.MultiReader(bytes.NewReader(head), reader), header)
+	}
+	threshold := this.MultipartThreshold
+	if threshold <= 0 {
+		threshold = defaultOssMultipartThreshold
+	}
+	if size > threshold {
+		return this.putMultipart(obj, objectKey, io.LimitReader(reader, size), header)
+	}
+	return this.putObject(obj, objectKey, reader, size, header)
+}
+
+func (this *Oss) putObject(obj *Object, objectKey string, reader io.Reader, size int64, header http.Header) (*Object, error) {
+	resp, err := this.do(http.MethodPut, objectKey, nil, header, ioutil.NopCloser(reader), size)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	obj.Size = size
+	obj.ETag = strings.Trim(resp.Header.Get("ETag"), `"`)
+	obj.LastModified = time.Now()
+	return obj, nil
+}
+
+// Get 读取对象
+func (this *Oss) Get(key string) (io.ReadCloser, *Object, error) {
+	key, objectKey, err := this.objectKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := this.do(http.MethodGet, objectKey, nil, nil, nil, 0)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil, ErrNotFound
+		}
+		return nil, nil, err
+	}
+	return resp.Body, this.headerObject(key, resp), nil
+}
+
+// Head 读取对象信息
+func (this *Oss) Head(key string) (*Object, error) {
+	key, objectKey, err := this.objectKey(key)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := this.do(http.MethodHead, objectKey, nil, nil, nil, 0)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	resp.Body.Close()
+	return this.headerObject(key, resp), nil
+}
+
+// Delete 删除对象
+func (this *Oss) Delete(key string) error {
+	_, objectKey, err := this.objectKey(key)
+	if err != nil {
+		return err
+	}
+	resp, err := this.do(http.MethodDelete, objectKey, nil, nil, nil, 0)
+	if err != nil {
+		if isNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// headerObject 从响应头解析对象信息
+func (this *Oss) headerObject(key string, resp *http.Response) *Object {
+	obj := &Object{
+		Key:         key,
+		Size:        resp.ContentLength,
+		ContentType: resp.Header.Get("Content-Type"),
+		ETag:        strings.Trim(resp.Header.Get("ETag"), `"`),
+		URL:         this.URL(key),
+	}
+	if size, err := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64); err == nil {
+		obj.Size = size
+	}
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		obj.LastModified = t
+	}
+	for k, vs := range resp.Header {
+		if k = strings.ToLower(k); strings.HasPrefix(k, ossMetaPrefix) && len(vs) > 0 {
+			if obj.Metadata == nil {
+				obj.Metadata = make(map[string]string)
+			}
+			obj.Metadata[k[len(ossMetaPrefix):]] = vs[0]
+		}
+	}
+	return obj
+}
+
+// 列举选项
+type ListOptions struct {
+	Prefix    string // key前缀, 不含KeyPrefix
+	Marker    string // 从该key之后开始列举, 通常为上一页的NextMarker
+	Delimiter string // 目录分隔符, 如 /
+	MaxKeys   int    // 返回数量上限, 默认100, 最大1000
+}
+
+// 列举结果
+type ListResult struct {
+	Objects        []*Object // 对象列表, 只包含Key/Size/ETag/LastModified/URL
+	CommonPrefixes []string  // 设置Delimiter时的子目录
+	IsTruncated    bool      // 是否还有更多结果
+	NextMarker     string    // 下一页的Marker
+}
+
+type ossListResult struct {
+	IsTruncated bool   `xml:"IsTruncated"`
+	NextMarker  string `xml:"NextMarker"`
+	Contents    []struct {
+		Key          string    `xml:"Key"`
+		LastModified time.Time `xml:"LastModified"`
+		ETag         string    `xml:"ETag"`
+		Size         int64     `xml:"Size"`
+	} `xml:"Contents"`
+	CommonPrefixes []struct {
+		Prefix string `xml:"Prefix"`
+	} `xml:"CommonPrefixes"`
+}
+
+// List 列举对象, 返回的key已去除KeyPrefix
+func (this *Oss) List(options *ListOptions) (*ListResult, error) {
+	query := url.Values{"prefix": {this.conf.KeyPrefix + options.Prefix}}
+	if options.Marker != "" {
+		query.Set("marker", this.conf.KeyPrefix+options.Marker)
+	}
+	if options.Delimiter != "" {
+		query.Set("delimiter", options.Delimiter)
+	}
+	if options.MaxKeys > 0 {
+		query.Set("max-keys", strconv.Itoa(options.MaxKeys))
+	}
+	resp, err := this.do(http.MethodGet, "", query, nil, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	list := new(ossListResult)
+	if err := xml.NewDecoder(resp.Body).Decode(list); err != nil {
+		return nil, err
+	}
+	result := &ListResult{IsTruncated: list.IsTruncated}
+	if list.NextMarker != "" {
+		result.NextMarker = strings.TrimPrefix(list.NextMarker, this.conf.KeyPrefix)
+	}
+	for _, content := range list.Contents {
+		key := strings.TrimPrefix(content.Key, this.conf.KeyPrefix)
+		result.Objects = append(result.Objects, &Object{
+			Key:          key,
+			Size:         content.Size,
+			ETag:         strings.Trim(content.ETag, `"`),
+			LastModified: content.LastModified,
+			URL:          this.URL(key),
+		})
+	}
+	for _, prefix := range list.CommonPrefixes {
+		result.CommonPrefixes = append(result.CommonPrefixes, strings.TrimPrefix(prefix.Prefix, this.conf.KeyPrefix))
+	}
+	return result, nil
+}
+
+// PresignGet 生成限时下载地址
+func (this *Oss) PresignGet(key string, expires time.Duration) (string, error) {
+	return this.presign(http.MethodGet, key, "", expires)
+}
+
+// PresignPut 生成限时上传地址, 客户端上传时Content-Type须与contentType一致
+func (this *Oss) PresignPut(key string, contentType string, expires time.Duration) (string, error) {
+	return this.presign(http.MethodPut, key, contentType, expires)
+}
+
+func (this *Oss) presign(method string, key string, contentType string, expires time.Duration) (string, error) {
+	_, objectKey, err := this.objectKey(key)
+	if err != nil {
+		return "", err
+	}
+	expiresAt := strconv.FormatInt(time.Now().Add(expires).Unix(), 10)
+	header := make(http.Header)
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	query := url.Values{
+		"OSSAccessKeyId": {this.conf.AccessKeyID},
+		"Expires":        {expiresAt},
+		"Signature":      {this.signature(this.stringToSign(method, header, objectKey, nil, expiresAt))},
+	}
+	return this.requestURL(objectKey, query), nil
+}
@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 分片缓冲池, 避免每次上传都分配PartSize大小的内存
+var ossPartPool = &sync.Pool{New: func() interface{} { return new([]byte) }}
+
+type ossInitiateResult struct {
+	UploadId string `xml:"UploadId"`
+}
+
+type ossPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type ossCompleteUpload struct {
+	XMLName xml.Name   `xml:"CompleteMultipartUpload"`
+	Parts   []*ossPart `xml:"Part"`
+}
+
+type ossCompleteResult struct {
+	ETag string `xml:"ETag"`
+}
+
+func (this *Oss) partSize() int64 {
+	if this.PartSize <= 0 {
+		return defaultOssPartSize
+	}
+	if this.PartSize < ossMinPartSize {
+		return ossMinPartSize
+	}
+	return this.PartSize
+}
+
+// acquirePart 从缓冲池获取分片缓冲, 容量不足时重新分配
+func (this *Oss) acquirePart() *[]byte {
+	size := this.partSize()
+	buf := ossPartPool.Get().(*[]byte)
+	if int64(cap(*buf)) < size {
+		*buf = make([]byte, size)
+	}
+	*buf = (*buf)[:size]
+	return buf
+}
+
+func releasePart(buf *[]byte) {
+	ossPartPool.Put(buf)
+}
+
+// putMultipart 按PartSize分片顺序上传, 失败时取消本次上传
+func (this *Oss) putMultipart(obj *Object, objectKey string, reader io.Reader, header http.Header) (*Object, error) {
+	uploadId, err := this.initiateMultipart(objectKey, header)
+	if err != nil {
+		return nil, err
+	}
+	parts := make([]*ossPart, 0)
+	part := this.acquirePart()
+	defer releasePart(part)
+	buf := *part
+	size := int64(0)
+	for {
+		n, err := io.ReadFull(reader, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			this.abortMultipart(objectKey, uploadId)
+			return nil, err
+		}
+		if n == 0 && len(parts) > 0 {
+			break
+		}
+		etag, err := this.uploadPart(objectKey, uploadId, len(parts)+1, buf[:n])
+		if err != nil {
+			this.abortMultipart(objectKey, uploadId)
+			return nil, err
+		}
+		parts = append(parts, &ossPart{PartNumber: len(parts) + 1, ETag: etag})
+		size += int64(n)
+		if n < len(buf) {
+			break
+		}
+	}
+	etag, err := this.completeMultipart(objectKey, uploadId, parts)
+	if err != nil {
+		this.abortMultipart(objectKey, uploadId)
+		return nil, err
+	}
+	obj.Size = size
+	obj.ETag = etag
+	obj.LastModified = time.Now()
+	return obj, nil
+}
+
+func (this *Oss) initiateMultipart(objectKey string, header http.Header) (string, error) {
+	resp, err := this.do(http.MethodPost, objectKey, url.Values{"uploads": {""}}, header, nil, 0)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	result := new(ossInitiateResult)
+	if err := xml.NewDecoder(resp.Body).Decode(result); err != nil {
+		return "", err
+	}
+	return result.UploadId, nil
+}
+
+func (this *Oss) uploadPart(objectKey string, uploadId string, partNumber int, data []byte) (string, error) {
+	query := url.Values{"partNumber": {strconv.Itoa(partNumber)}, "uploadId": {uploadId}}
+	hash := md5.Sum(data)
+	header := make(http.Header)
+	header.Set("Content-MD5", base64.StdEncoding.EncodeToString(hash[:]))
+	resp, err := this.do(http.MethodPut, objectKey, query, header, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return resp.Header.Get("ETag"), nil
+}
+
+func (this *Oss) completeMultipart(objectKey string, uploadId string, parts []*ossPart) (string, error) {
+	body, err := xml.Marshal(&ossCompleteUpload{Parts: parts})
+	if err != nil {
+		return "", err
+	}
+	header := make(http.Header)
+	header.Set("Content-Type", "application/xml")
+	resp, err := this.do(http.MethodPost, objectKey, url.Values{"uploadId": {uploadId}}, header,
+		bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	result := new(ossCompleteResult)
+	if err := xml.NewDecoder(resp.Body).Decode(result); err != nil {
+		return "", err
+	}
+	return strings.Trim(result.ETag, `"`), nil
+}
+
+func (this *Oss) abortMultipart(objectKey string, uploadId string) {
+	resp, err := this.do(http.MethodDelete, objectKey, url.Values{"uploadId": {uploadId}}, nil, nil, 0)
+	if err == nil {
+		resp.Body.Close()
+	}
+}
@@ -0,0 +1,8 @@
+//go:build race
+// +build race
+
+package storage
+
+func init() {
+	raceEnabled = true
+}
@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound   = errors.New("storage: object not found")
+	ErrInvalidKey = errors.New("storage: invalid object key")
+)
+
+// 对象信息
+type Object struct {
+	Key          string            // 对象key, 不含KeyPrefix
+	Size         int64             // 大小
+	ContentType  string            // MIME类型
+	ETag         string            // 内容标识
+	LastModified time.Time         // 最后修改时间
+	Metadata     map[string]string // 自定义元数据
+	URL          string            // 访问地址, 未配置域名时为空
+}
+
+// 上传选项
+type PutOptions struct {
+	ContentType        string            // MIME类型
+	ContentDisposition string            // 下载文件名等
+	Metadata           map[string]string // 自定义元数据
+}
+
+// 对象存储
+type Storage interface {
+	// Put 上传对象, size未知时传-1
+	Put(key string, reader io.Reader, size int64, options *PutOptions) (*Object, error)
+	// Get 读取对象, 调用方负责关闭返回的Reader
+	Get(key string) (io.ReadCloser, *Object, error)
+	// Delete 删除对象, 对象不存在时不返回错误
+	Delete(key string) error
+}
+
+// CleanKey 规范化对象key, 拒绝空key和跳出根目录的路径
+func CleanKey(key string) (string, error) {
+	key = strings.TrimLeft(strings.Replace(key, "\\", "/", -1), "/")
+	if key == "" || strings.HasSuffix(key, "/") {
+		return "", ErrInvalidKey
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == ".." || segment == "." || segment == "" {
+			return "", ErrInvalidKey
+		}
+	}
+	return path.Clean(key), nil
+}
@@ -0,0 +1,314 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lxf9601/go-common/conf"
+)
+
+// raceEnabled 是否开启竞态检测, 见race_test.go
+var raceEnabled = false
+
+// fakeOss 内存中的OSS替身, 校验签名并按 /bucket/key 保存对象
+type fakeOss struct {
+	t       *testing.T
+	secret  string
+	lock    sync.Mutex
+	objects map[string][]byte
+	headers map[string]http.Header
+	uploads map[string]map[int][]byte
+}
+
+func newFakeOss(t *testing.T) (*fakeOss, *httptest.Server) {
+	fake := &fakeOss{t: t, secret: "secret", objects: make(map[string][]byte),
+		headers: make(map[string]http.Header), uploads: make(map[string]map[int][]byte)}
+	return fake, httptest.NewServer(fake)
+}
+
+func (this *fakeOss) authorized(r *http.Request) bool {
+	query := r.URL.Query()
+	date, auth := r.Header.Get("Date"), r.Header.Get("Authorization")
+	if query.Get("Expires") != "" {
+		expires, _ := strconv.ParseInt(query.Get("Expires"), 10, 64)
+		if expires < time.Now().Unix() {
+			return false
+		}
+		date, auth = query.Get("Expires"), "OSS "+query.Get("OSSAccessKeyId")+":"+query.Get("Signature")
+	}
+	ossHeaders := make([]string, 0)
+	for k := range r.Header {
+		if k = strings.ToLower(k); strings.HasPrefix(k, "x-oss-") {
+			ossHeaders = append(ossHeaders, k+":"+r.Header.Get(k)+"\n")
+		}
+	}
+	sort.Strings(ossHeaders)
+	subs := make([]string, 0)
+	for _, k := range []string{"partNumber", "uploadId", "uploads"} {
+		if v, ok := query[k]; ok {
+			if v[0] == "" {
+				subs = append(subs, k)
+			} else {
+				subs = append(subs, k+"="+v[0])
+			}
+		}
+	}
+	resource := r.URL.Path
+	if len(subs) > 0 {
+		resource += "?" + strings.Join(subs, "&")
+	}
+	toSign := r.Method + "\n" + r.Header.Get("Content-MD5") + "\n" + r.Header.Get("Content-Type") + "\n" +
+		date + "\n" + strings.Join(ossHeaders, "") + resource
+	mac := hmac.New(sha1.New, []byte(this.secret))
+	mac.Write([]byte(toSign))
+	return auth == "OSS id:"+base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (this *fakeOss) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !this.authorized(r) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("<Error><Code>SignatureDoesNotMatch</Code></Error>"))
+		return
+	}
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	resource := r.URL.Path
+	query := r.URL.Query()
+	body, _ := ioutil.ReadAll(r.Body)
+	switch {
+	case r.Method == http.MethodPost && query["uploads"] != nil:
+		this.uploads["u1"] = make(map[int][]byte)
+		this.headers[resource] = r.Header
+		w.Write([]byte("<InitiateMultipartUploadResult><UploadId>u1</UploadId></InitiateMultipartUploadResult>"))
+	case r.Method == http.MethodPut && query.Get("uploadId") != "":
+		n, _ := strconv.Atoi(query.Get("partNumber"))
+		this.uploads[query.Get("uploadId")][n] = body
+		w.Header().Set("ETag", fmt.Sprintf(`"part%d"`, n))
+	case r.Method == http.MethodPost && query.Get("uploadId") != "":
+		parts := this.uploads[query.Get("uploadId")]
+		complete := new(ossCompleteUpload)
+		xml.Unmarshal(body, complete)
+		data := make([]byte, 0)
+		for i, part := range complete.Parts {
+			if part.PartNumber != i+1 || part.ETag != fmt.Sprintf(`"part%d"`, i+1) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			data = append(data, parts[part.PartNumber]...)
+		}
+		this.objects[resource] = data
+		delete(this.uploads, query.Get("uploadId"))
+		w.Write([]byte("<CompleteMultipartUploadResult><ETag>\"multi\"</ETag></CompleteMultipartUploadResult>"))
+	case r.Method == http.MethodDelete && query.Get("uploadId") != "":
+		delete(this.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodGet && strings.HasSuffix(resource, "/"):
+		keys := make([]string, 0)
+		for k := range this.objects {
+			key := strings.TrimPrefix(k, resource)
+			if strings.HasPrefix(key, query.Get("prefix")) {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		list := "<ListBucketResult><IsTruncated>false</IsTruncated>"
+		for _, key := range keys {
+			list += fmt.Sprintf("<Contents><Key>%s</Key><LastModified>2021-01-02T03:04:05.000Z</LastModified>"+
+				"<ETag>\"e\"</ETag><Size>%d</Size></Contents>", key, len(this.objects[resource+key]))
+		}
+		w.Write([]byte(list + "</ListBucketResult>"))
+	case r.Method == http.MethodPut:
+		this.objects[resource] = body
+		this.headers[resource] = r.Header
+		w.Header().Set("ETag", `"etag"`)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		b, ok := this.objects[resource]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("<Error><Code>NoSuchKey</Code><Message>not found</Message></Error>"))
+			return
+		}
+		w.Header().Set("Content-Type", this.headers[resource].Get("Content-Type"))
+		w.Header().Set("X-Oss-Meta-Owner", this.headers[resource].Get("X-Oss-Meta-Owner"))
+		w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+		if r.Method == http.MethodGet {
+			w.Write(b)
+		}
+	case r.Method == http.MethodDelete:
+		delete(this.objects, resource)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func testStorage(t *testing.T, s Storage) {
+	obj, err := s.Put("a/b.txt", strings.NewReader("hello"), -1,
+		&PutOptions{ContentType: "text/plain", Metadata: map[string]string{"owner": "u1"}})
+	if err != nil || obj.Size != 5 || obj.Key != "a/b.txt" || obj.ETag == "" {
+		t.Fatal(obj, err)
+	}
+	r, obj, err := s.Get("a/b.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(r)
+	r.Close()
+	if string(b) != "hello" || !strings.HasPrefix(obj.ContentType, "text/plain") {
+		t.Fatal(string(b), obj)
+	}
+	if err := s.Delete("a/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Get("a/b.txt"); err != ErrNotFound {
+		t.Fatal(err)
+	}
+	if _, err := s.Put("../x", bytes.NewReader(nil), 0, nil); err != ErrInvalidKey {
+		t.Fatal(err)
+	}
+	// 返回规范化后的键, 与实际存储的对象一致
+	obj, err = s.Put("/a/c.txt", strings.NewReader("c"), 1, nil)
+	if err != nil || obj.Key != "a/c.txt" {
+		t.Fatal(obj, err)
+	}
+	if r, obj, err = s.Get("a/c.txt"); err != nil || obj.Key != "a/c.txt" {
+		t.Fatal(obj, err)
+	}
+	r.Close()
+	s.Delete("a/c.txt")
+}
+
+func TestLocal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, err := NewLocal(&LocalOptions{Root: dir, BaseURL: "https://static.example.com/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if local.URL("a/b.txt") != "https://static.example.com/a/b.txt" {
+		t.Fatal(local.URL("a/b.txt"))
+	}
+	testStorage(t, local)
+}
+
+func TestOss(t *testing.T) {
+	fake, server := newFakeOss(t)
+	defer server.Close()
+	oss := NewOss(&conf.AliyunOssConf{Endpoint: server.URL, AccessKeyID: "id", AccessKeySecret: "secret",
+		Bucket: "bucket", KeyPrefix: "prod/"})
+	if !oss.PathStyle {
+		t.Fatal("ip endpoint must use path style")
+	}
+	testStorage(t, oss)
+	oss.Put("c.txt", strings.NewReader("x"), 1, &PutOptions{Metadata: map[string]string{"owner": "u2"}})
+	if string(fake.objects["/bucket/prod/c.txt"]) != "x" {
+		t.Fatal(fake.objects)
+	}
+	_, obj, err := oss.Get("c.txt")
+	if err != nil || obj.Metadata["owner"] != "u2" {
+		t.Fatal(obj, err)
+	}
+
+	if obj, err := oss.Put("/e.txt", strings.NewReader("e"), 1, nil); err != nil || obj.URL != oss.URL("e.txt") ||
+		oss.URL("/e.txt") != oss.URL("e.txt") || !strings.HasSuffix(obj.URL, "/prod/e.txt") {
+		t.Fatal("url must point to the stored object", obj, err)
+	}
+	obj, err = oss.Head("c.txt")
+	if err != nil || obj.Size != 1 {
+		t.Fatal(obj, err)
+	}
+	if _, err := oss.Head("missing"); err != ErrNotFound {
+		t.Fatal(err)
+	}
+
+	// 大小未知的小文件直接上传, 分片缓冲复用而非每次分配
+	pool := ossPartPool
+	defer func() { ossPartPool = pool }()
+	parts := 0
+	ossPartPool = &sync.Pool{New: func() interface{} {
+		parts++
+		return pool.New()
+	}}
+	for i := 0; i < 10; i++ {
+		if obj, err = oss.Put("small.txt", strings.NewReader("small"), -1, nil); err != nil || obj.Size != 5 {
+			t.Fatal(obj, err)
+		}
+	}
+	// 竞态检测下sync.Pool会随机丢弃放回的对象
+	if parts == 0 || parts > 2 && !raceEnabled {
+		t.Fatal("part buffer not reused", parts)
+	}
+	if string(fake.objects["/bucket/prod/small.txt"]) != "small" {
+		t.Fatal(fake.objects)
+	}
+
+	// 大小未知且超过一个分片时使用分片上传
+	oss.PartSize = ossMinPartSize
+	data := bytes.Repeat([]byte("0123456789"), ossMinPartSize/4)
+	obj, err = oss.Put("dir/big.bin", bytes.NewReader(data), -1, nil)
+	if err != nil || obj.Size != int64(len(data)) || obj.ETag != "multi" ||
+		!bytes.Equal(fake.objects["/bucket/prod/dir/big.bin"], data) || len(fake.uploads) != 0 {
+		t.Fatal(obj, err)
+	}
+	oss.MultipartThreshold = 1
+	if obj, err = oss.Put("dir/big2.bin", bytes.NewReader(data), int64(len(data)), nil); err != nil ||
+		!bytes.Equal(fake.objects["/bucket/prod/dir/big2.bin"], data) {
+		t.Fatal(obj, err)
+	}
+
+	list, err := oss.List(&ListOptions{Prefix: "dir/"})
+	if err != nil || len(list.Objects) != 2 || list.Objects[0].Key != "dir/big.bin" ||
+		list.Objects[0].Size != int64(len(data)) || list.Objects[0].LastModified.Year() != 2021 {
+		t.Fatal(list, err)
+	}
+
+	u, _ := oss.PresignGet("c.txt", time.Minute)
+	resp, err := http.Get(u)
+	if err != nil || resp.StatusCode != 200 {
+		t.Fatal(u, resp, err)
+	}
+	resp.Body.Close()
+	u, _ = oss.PresignPut("d.txt", "text/plain", time.Minute)
+	req, _ := http.NewRequest(http.MethodPut, u, strings.NewReader("d"))
+	req.Header.Set("Content-Type", "text/plain")
+	if resp, err = http.DefaultClient.Do(req); err != nil || resp.StatusCode != 200 ||
+		string(fake.objects["/bucket/prod/d.txt"]) != "d" {
+		t.Fatal(resp, err)
+	}
+	resp.Body.Close()
+
+	oss.conf.AccessKeySecret = "wrong"
+	if _, _, err := oss.Get("c.txt"); err == nil || err.(*OssError).Code != "SignatureDoesNotMatch" {
+		t.Fatal(err)
+	}
+}
+
+func TestOssURL(t *testing.T) {
+	ossConf := &conf.AliyunOssConf{Endpoint: "oss-cn-hangzhou.aliyuncs.com", Bucket: "b", KeyPrefix: "p/",
+		DomainInternal: "b.oss-cn-hangzhou-internal.aliyuncs.com", DomainPub1: "https://cdn.example.com/"}
+	oss := NewOss(ossConf)
+	if oss.PathStyle || oss.URL("a b.png") != "https://cdn.example.com/p/a%20b.png" {
+		t.Fatal(oss.URL("a b.png"))
+	}
+	oss.Internal = true
+	if oss.URL("a.png") != "https://b.oss-cn-hangzhou-internal.aliyuncs.com/p/a.png" {
+		t.Fatal(oss.URL("a.png"))
+	}
+	ossConf.DomainInternal, ossConf.DomainPub1 = "", ""
+	if oss.URL("a.png") != "https://b.oss-cn-hangzhou.aliyuncs.com/p/a.png" {
+		t.Fatal(oss.URL("a.png"))
+	}
+}
@@ -0,0 +1,74 @@
+package trace
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// 导出的Span
+type SpanData struct {
+	Service      string                 `json:"service,omitempty"`
+	Name         string                 `json:"name"`
+	Kind         int                    `json:"kind"`
+	TraceID      string                 `json:"trace_id"`
+	SpanID       string                 `json:"span_id"`
+	ParentSpanID string                 `json:"parent_span_id,omitempty"`
+	Start        time.Time              `json:"start"`
+	End          time.Time              `json:"end"`
+	Attributes   map[string]interface{} `json:"attributes,omitempty"`
+	Status       int                    `json:"status"`
+	StatusMsg    string                 `json:"status_msg,omitempty"`
+}
+
+// 导出器, Export在Span结束时同步调用, 实现需并发安全
+type Exporter interface {
+	Export(span *SpanData) error
+	Close() error
+}
+
+// 以JSON行格式写出Span
+type WriterExporter struct {
+	lock   sync.Mutex
+	w      io.Writer
+	closer io.Closer
+}
+
+// NewWriterExporter 写入w, 每个Span一行JSON
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{w: w}
+}
+
+// NewStdoutExporter 输出到标准输出
+func NewStdoutExporter() *WriterExporter {
+	return NewWriterExporter(os.Stdout)
+}
+
+// NewFileExporter 追加写入文件
+func NewFileExporter(path string) (*WriterExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &WriterExporter{w: f, closer: f}, nil
+}
+
+func (this *WriterExporter) Export(span *SpanData) error {
+	j, err := json.Marshal(span)
+	if err != nil {
+		return err
+	}
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	_, err = this.w.Write(append(j, '\n'))
+	return err
+}
+
+func (this *WriterExporter) Close() error {
+	if this.closer != nil {
+		return this.closer.Close()
+	}
+	return nil
+}
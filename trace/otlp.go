@@ -0,0 +1,232 @@
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lxf9601/go-common/logc"
+)
+
+const (
+	defaultOtlpBatchSize = 100
+	defaultOtlpInterval  = 5 * time.Second
+	defaultOtlpTimeout   = 10 * time.Second
+	defaultOtlpQueueSize = 2048
+)
+
+// OTLP导出配置
+type OtlpOptions struct {
+	Endpoint  string            // OTLP/HTTP地址, 如http://collector:4318/v1/traces
+	Headers   map[string]string // 请求头, 如鉴权
+	BatchSize int               // 每批最多导出的Span数, 默认100
+	Interval  time.Duration     // 导出间隔, 默认5秒
+	Timeout   time.Duration     // 请求超时, 默认10秒
+	QueueSize int               // 缓冲的最大Span数, 超过时丢弃, 默认2048
+}
+
+// OTLP/HTTP JSON导出器, 后台批量发送
+type OtlpExporter struct {
+	options OtlpOptions
+	client  *http.Client
+	lock    sync.Mutex
+	queue   []*SpanData
+	flush   chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+	dropped int
+}
+
+func NewOtlpExporter(options *OtlpOptions) *OtlpExporter {
+	opts := *options
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultOtlpBatchSize
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = defaultOtlpInterval
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultOtlpTimeout
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = defaultOtlpQueueSize
+	}
+	exporter := &OtlpExporter{options: opts, client: &http.Client{Timeout: opts.Timeout},
+		flush: make(chan struct{}, 1), stop: make(chan struct{}), done: make(chan struct{})}
+	go exporter.run()
+	return exporter
+}
+
+// Export 放入缓冲, 达到批量大小时立即发送
+func (this *OtlpExporter) Export(span *SpanData) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if len(this.queue) >= this.options.QueueSize {
+		this.dropped++
+		return nil
+	}
+	this.queue = append(this.queue, span)
+	if len(this.queue) >= this.options.BatchSize {
+		select {
+		case this.flush <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Close 发送缓冲中的Span并停止
+func (this *OtlpExporter) Close() error {
+	this.once.Do(func() {
+		close(this.stop)
+	})
+	<-this.done
+	return nil
+}
+
+func (this *OtlpExporter) run() {
+	defer close(this.done)
+	ticker := time.NewTicker(this.options.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-this.stop:
+			this.send(true)
+			return
+		case <-ticker.C:
+			this.send(true)
+		case <-this.flush:
+			this.send(false)
+		}
+	}
+}
+
+// send 发送缓冲, all为false时只发送完整的批次
+func (this *OtlpExporter) send(all bool) {
+	for {
+		this.lock.Lock()
+		n := len(this.queue)
+		if n > this.options.BatchSize {
+			n = this.options.BatchSize
+		}
+		if n == 0 || (!all && n < this.options.BatchSize) {
+			this.lock.Unlock()
+			return
+		}
+		batch := this.queue[:n:n]
+		this.queue = this.queue[n:]
+		dropped := this.dropped
+		this.dropped = 0
+		this.lock.Unlock()
+		if dropped > 0 {
+			logc.Warnf("otlp export: queue full, dropped %d spans", dropped)
+		}
+		if err := this.post(batch); err != nil {
+			logc.Warnf("otlp export %d spans: %s", len(batch), err)
+		}
+	}
+}
+
+func (this *OtlpExporter) post(batch []*SpanData) error {
+	j, err := json.Marshal(otlpRequest(batch))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, this.options.Endpoint, bytes.NewReader(j))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range this.options.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := this.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("status %d: %s", resp.StatusCode, body)
+	}
+	return nil
+}
+
+type otlpAttribute struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+// otlpValue 转换为OTLP AnyValue, 64位整数按规范编码为字符串
+func otlpValue(v interface{}) map[string]interface{} {
+	switch val := v.(type) {
+	case string:
+		return map[string]interface{}{"stringValue": val}
+	case bool:
+		return map[string]interface{}{"boolValue": val}
+	case int:
+		return map[string]interface{}{"intValue": strconv.FormatInt(int64(val), 10)}
+	case int32:
+		return map[string]interface{}{"intValue": strconv.FormatInt(int64(val), 10)}
+	case int64:
+		return map[string]interface{}{"intValue": strconv.FormatInt(val, 10)}
+	case float32:
+		return map[string]interface{}{"doubleValue": float64(val)}
+	case float64:
+		return map[string]interface{}{"doubleValue": val}
+	}
+	return map[string]interface{}{"stringValue": fmt.Sprint(v)}
+}
+
+func otlpAttributes(attributes map[string]interface{}) []otlpAttribute {
+	list := make([]otlpAttribute, 0, len(attributes))
+	for k, v := range attributes {
+		list = append(list, otlpAttribute{Key: k, Value: otlpValue(v)})
+	}
+	return list
+}
+
+// otlpRequest 按服务分组转换为ExportTraceServiceRequest
+func otlpRequest(batch []*SpanData) map[string]interface{} {
+	services := make([]string, 0)
+	spans := make(map[string][]map[string]interface{})
+	for _, span := range batch {
+		if _, ok := spans[span.Service]; !ok {
+			services = append(services, span.Service)
+		}
+		s := map[string]interface{}{
+			"traceId":           span.TraceID,
+			"spanId":            span.SpanID,
+			"name":              span.Name,
+			"kind":              span.Kind,
+			"startTimeUnixNano": strconv.FormatInt(span.Start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(span.End.UnixNano(), 10),
+			"attributes":        otlpAttributes(span.Attributes),
+			"status":            map[string]interface{}{"code": span.Status, "message": span.StatusMsg},
+		}
+		if span.ParentSpanID != "" {
+			s["parentSpanId"] = span.ParentSpanID
+		}
+		spans[span.Service] = append(spans[span.Service], s)
+	}
+	resourceSpans := make([]map[string]interface{}, 0, len(services))
+	for _, service := range services {
+		resourceSpans = append(resourceSpans, map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": otlpAttributes(map[string]interface{}{"service.name": service}),
+			},
+			"scopeSpans": []map[string]interface{}{{
+				"scope": map[string]interface{}{"name": "github.com/lxf9601/go-common/trace"},
+				"spans": spans[service],
+			}},
+		})
+	}
+	return map[string]interface{}{"resourceSpans": resourceSpans}
+}
@@ -0,0 +1,200 @@
+package trace
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/lxf9601/go-common/logc"
+)
+
+// Span类型, 取值同OTLP
+const (
+	SPAN_KIND_INTERNAL = 1
+	SPAN_KIND_SERVER   = 2
+	SPAN_KIND_CLIENT   = 3
+	SPAN_KIND_PRODUCER = 4
+	SPAN_KIND_CONSUMER = 5
+)
+
+// Span状态, 取值同OTLP
+const (
+	STATUS_UNSET = 0
+	STATUS_OK    = 1
+	STATUS_ERROR = 2
+)
+
+// 链路中的一次操作
+type Span struct {
+	tracer     *Tracer
+	sc         SpanContext
+	parent     SpanID
+	name       string
+	kind       int
+	start      time.Time
+	lock       sync.Mutex
+	end        time.Time
+	attributes map[string]interface{}
+	status     int
+	statusMsg  string
+	ended      bool
+}
+
+// SpanContext 链路上下文
+func (this *Span) SpanContext() SpanContext {
+	return this.sc
+}
+
+// SetName 修改名称, 如路由匹配后使用路由路径
+func (this *Span) SetName(name string) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.name = name
+}
+
+// SetAttribute 设置属性, 值为string、bool、整数或浮点数
+func (this *Span) SetAttribute(key string, value interface{}) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.attributes == nil {
+		this.attributes = make(map[string]interface{})
+	}
+	this.attributes[key] = value
+}
+
+// SetStatus 设置状态
+func (this *Span) SetStatus(status int, msg string) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.status = status
+	this.statusMsg = msg
+}
+
+// SetError err不为空时标记为错误
+func (this *Span) SetError(err error) {
+	if err != nil {
+		this.SetStatus(STATUS_ERROR, err.Error())
+	}
+}
+
+// End 结束并导出, 重复调用无效
+func (this *Span) End() {
+	this.lock.Lock()
+	if this.ended {
+		this.lock.Unlock()
+		return
+	}
+	this.ended = true
+	this.end = time.Now()
+	data := this.data()
+	this.lock.Unlock()
+	if this.sc.Sampled && this.tracer.exporter != nil {
+		if err := this.tracer.exporter.Export(data); err != nil {
+			logc.Warnf("trace export: %s", err)
+		}
+	}
+}
+
+// data 导出用的快照, 需持有锁
+func (this *Span) data() *SpanData {
+	attributes := make(map[string]interface{}, len(this.attributes))
+	for k, v := range this.attributes {
+		attributes[k] = v
+	}
+	data := &SpanData{
+		Service:    this.tracer.service,
+		Name:       this.name,
+		Kind:       this.kind,
+		TraceID:    this.sc.TraceID.String(),
+		SpanID:     this.sc.SpanID.String(),
+		Start:      this.start,
+		End:        this.end,
+		Attributes: attributes,
+		Status:     this.status,
+		StatusMsg:  this.statusMsg,
+	}
+	if this.parent.IsValid() {
+		data.ParentSpanID = this.parent.String()
+	}
+	return data
+}
+
+// 追踪配置
+type TracerOptions struct {
+	Service    string   // 服务名
+	Exporter   Exporter // 导出器, 默认输出到标准输出
+	SampleRate float64  // 新链路的采样比例, 0或1表示全部采样, 有父链路时沿用父链路的采样决定
+}
+
+// 追踪器, 创建Span并导出
+type Tracer struct {
+	service    string
+	exporter   Exporter
+	sampleRate float64
+}
+
+func NewTracer(options *TracerOptions) *Tracer {
+	exporter := options.Exporter
+	if exporter == nil {
+		exporter = NewStdoutExporter()
+	}
+	return &Tracer{service: options.Service, exporter: exporter, sampleRate: options.SampleRate}
+}
+
+// Start 开始Span, ctx中有Span或远程链路上下文时作为其子Span, 返回包含新Span的ctx
+func (this *Tracer) Start(ctx context.Context, name string, kind int) (context.Context, *Span) {
+	span := &Span{tracer: this, name: name, kind: kind, start: time.Now()}
+	parent := SpanContextFromContext(ctx)
+	if parent.IsValid() {
+		span.sc = SpanContext{TraceID: parent.TraceID, Sampled: parent.Sampled, TraceState: parent.TraceState}
+		span.parent = parent.SpanID
+	} else {
+		span.sc = SpanContext{TraceID: newTraceID(),
+			Sampled: this.sampleRate <= 0 || this.sampleRate >= 1 || rand.Float64() < this.sampleRate}
+	}
+	span.sc.SpanID = newSpanID()
+	return ContextWithSpan(ctx, span), span
+}
+
+// Close 关闭导出器, 导出缓冲中的Span
+func (this *Tracer) Close() error {
+	if this.exporter == nil {
+		return nil
+	}
+	return this.exporter.Close()
+}
+
+var (
+	defaultTracer     = NewTracer(&TracerOptions{})
+	defaultTracerLock sync.RWMutex
+)
+
+// SetDefault 设置默认追踪器
+func SetDefault(tracer *Tracer) {
+	defaultTracerLock.Lock()
+	defer defaultTracerLock.Unlock()
+	defaultTracer = tracer
+}
+
+// Default 默认追踪器, 未设置时输出到标准输出
+func Default() *Tracer {
+	defaultTracerLock.RLock()
+	defer defaultTracerLock.RUnlock()
+	return defaultTracer
+}
+
+// Start 使用默认追踪器开始Span
+func Start(ctx context.Context, name string, kind int) (context.Context, *Span) {
+	return Default().Start(ctx, name, kind)
+}
+
+func init() {
+	logc.RegisterContextFields(func(ctx context.Context) logc.Fields {
+		sc := SpanContextFromContext(ctx)
+		if !sc.IsValid() {
+			return nil
+		}
+		return logc.Fields{"trace_id": sc.TraceID.String(), "span_id": sc.SpanID.String()}
+	})
+}
@@ -0,0 +1,155 @@
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// W3C Trace Context请求头
+const (
+	HEADER_TRACEPARENT = "traceparent"
+	HEADER_TRACESTATE  = "tracestate"
+)
+
+const flagSampled = 0x01
+
+type TraceID [16]byte
+
+type SpanID [8]byte
+
+func (this TraceID) String() string {
+	return hex.EncodeToString(this[:])
+}
+
+func (this TraceID) IsValid() bool {
+	return this != TraceID{}
+}
+
+func (this SpanID) String() string {
+	return hex.EncodeToString(this[:])
+}
+
+func (this SpanID) IsValid() bool {
+	return this != SpanID{}
+}
+
+// 链路上下文, 跨进程传递的部分
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Sampled    bool
+	TraceState string
+	Remote     bool // 是否从请求头或消息头解析得到
+}
+
+func (this SpanContext) IsValid() bool {
+	return this.TraceID.IsValid() && this.SpanID.IsValid()
+}
+
+// Traceparent 格式化为traceparent请求头
+func (this SpanContext) Traceparent() string {
+	flags := 0
+	if this.Sampled {
+		flags = flagSampled
+	}
+	return fmt.Sprintf("00-%s-%s-%02x", this.TraceID, this.SpanID, flags)
+}
+
+// ParseTraceparent 解析traceparent请求头, 格式错误或ID全为0时返回false
+func ParseTraceparent(traceparent string, tracestate string) (SpanContext, bool) {
+	sc := SpanContext{}
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" ||
+		len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, false
+	}
+	// 版本00必须恰好4段, 更高版本允许附加字段
+	if parts[0] == "00" && len(parts) != 4 {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || !sc.IsValid() {
+		return SpanContext{}, false
+	}
+	sc.Sampled = flags[0]&flagSampled != 0
+	sc.TraceState = strings.TrimSpace(tracestate)
+	sc.Remote = true
+	return sc, true
+}
+
+func newTraceID() TraceID {
+	id := TraceID{}
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	id := SpanID{}
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return id
+}
+
+type contextKey int
+
+const (
+	spanContextKey contextKey = iota
+	remoteContextKey
+)
+
+// ContextWithSpan 将Span放入ctx, 之后从ctx开始的Span以其为父
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanContextKey, span)
+}
+
+// SpanFromContext 获取ctx中的Span, 没有时为nil
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanContextKey).(*Span)
+	return span
+}
+
+// ContextWithRemote 将远程父链路上下文放入ctx
+func ContextWithRemote(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteContextKey, sc)
+}
+
+// SpanContextFromContext 获取ctx中的链路上下文, 本地Span优先
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if span := SpanFromContext(ctx); span != nil {
+		return span.SpanContext()
+	}
+	sc, _ := ctx.Value(remoteContextKey).(SpanContext)
+	return sc
+}
+
+// Extract 从请求头或消息头解析链路上下文并放入ctx, get返回头的值
+func Extract(ctx context.Context, get func(key string) string) context.Context {
+	if sc, ok := ParseTraceparent(get(HEADER_TRACEPARENT), get(HEADER_TRACESTATE)); ok {
+		return ContextWithRemote(ctx, sc)
+	}
+	return ctx
+}
+
+// Inject 将ctx的链路上下文写入请求头或消息头, 没有链路上下文时不写入
+func Inject(ctx context.Context, set func(key string, value string)) {
+	sc := SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	set(HEADER_TRACEPARENT, sc.Traceparent())
+	if sc.TraceState != "" {
+		set(HEADER_TRACESTATE, sc.TraceState)
+	}
+}
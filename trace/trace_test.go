@@ -0,0 +1,181 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lxf9601/go-common/logc"
+)
+
+// 内存导出器
+type memoryExporter struct {
+	lock  sync.Mutex
+	spans []*SpanData
+}
+
+func (this *memoryExporter) Export(span *SpanData) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.spans = append(this.spans, span)
+	return nil
+}
+
+func (this *memoryExporter) Close() error {
+	return nil
+}
+
+func TestTraceparent(t *testing.T) {
+	header := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, ok := ParseTraceparent(header, "vendor=1")
+	if !ok || !sc.Sampled || !sc.Remote || sc.TraceState != "vendor=1" || sc.Traceparent() != header {
+		t.Fatal(sc, ok)
+	}
+	for _, invalid := range []string{
+		"",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"00-xyz92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	} {
+		if _, ok := ParseTraceparent(invalid, ""); ok {
+			t.Fatal(invalid)
+		}
+	}
+	if sc, ok := ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-future", ""); !ok || sc.Sampled {
+		t.Fatal("future versions may carry extra fields")
+	}
+}
+
+func TestTracer(t *testing.T) {
+	exporter := &memoryExporter{}
+	tracer := NewTracer(&TracerOptions{Service: "user", Exporter: exporter})
+	headers := map[string]string{HEADER_TRACEPARENT: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		HEADER_TRACESTATE: "vendor=1"}
+	ctx := Extract(context.Background(), func(key string) string { return headers[key] })
+	ctx, server := tracer.Start(ctx, "GET /user", SPAN_KIND_SERVER)
+	_, client := tracer.Start(ctx, "GET /order", SPAN_KIND_CLIENT)
+
+	out := map[string]string{}
+	Inject(ContextWithSpan(ctx, client), func(key string, value string) { out[key] = value })
+	if !strings.HasPrefix(out[HEADER_TRACEPARENT], "00-4bf92f3577b34da6a3ce929d0e0e4736-"+client.SpanContext().SpanID.String()) ||
+		out[HEADER_TRACESTATE] != "vendor=1" {
+		t.Fatal(out)
+	}
+	client.SetError(os.ErrNotExist)
+	client.End()
+	server.SetAttribute("http.status_code", 200)
+	server.End()
+	server.End()
+
+	if len(exporter.spans) != 2 {
+		t.Fatal(exporter.spans)
+	}
+	c, s := exporter.spans[0], exporter.spans[1]
+	if c.ParentSpanID != s.SpanID || s.ParentSpanID != "00f067aa0ba902b7" || c.TraceID != s.TraceID ||
+		c.Status != STATUS_ERROR || s.Attributes["http.status_code"] != 200 || s.Service != "user" {
+		t.Fatal(c, s)
+	}
+
+	// 父链路未采样时不导出
+	headers[HEADER_TRACEPARENT] = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"
+	ctx = Extract(context.Background(), func(key string) string { return headers[key] })
+	_, span := tracer.Start(ctx, "GET /user", SPAN_KIND_SERVER)
+	span.End()
+	if len(exporter.spans) != 2 {
+		t.Fatal("unsampled span exported")
+	}
+}
+
+func TestWriterExporter(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := NewTracer(&TracerOptions{Exporter: NewWriterExporter(&buf)})
+	ctx, span := tracer.Start(context.Background(), "job", SPAN_KIND_INTERNAL)
+	logc.WithContext(ctx).Info("traced")
+	span.End()
+	data := new(SpanData)
+	if err := json.Unmarshal(buf.Bytes(), data); err != nil || data.Name != "job" || data.TraceID != span.SpanContext().TraceID.String() {
+		t.Fatal(buf.String(), err)
+	}
+}
+
+func TestFileExporter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "spans.json")
+	exporter, err := NewFileExporter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracer := NewTracer(&TracerOptions{Exporter: exporter})
+	for i := 0; i < 2; i++ {
+		_, span := tracer.Start(context.Background(), "job", SPAN_KIND_INTERNAL)
+		span.End()
+	}
+	tracer.Close()
+	content, _ := ioutil.ReadFile(path)
+	if lines := strings.Split(strings.TrimSpace(string(content)), "\n"); len(lines) != 2 {
+		t.Fatal(string(content))
+	}
+}
+
+func TestOtlpExporter(t *testing.T) {
+	requests := make(chan map[string]interface{}, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := map[string]interface{}{}
+		json.NewDecoder(r.Body).Decode(&body)
+		if r.Header.Get("Authorization") != "token" {
+			w.WriteHeader(401)
+			return
+		}
+		requests <- body
+	}))
+	defer server.Close()
+	exporter := NewOtlpExporter(&OtlpOptions{Endpoint: server.URL, Headers: map[string]string{"Authorization": "token"},
+		BatchSize: 2, Interval: time.Hour})
+	tracer := NewTracer(&TracerOptions{Service: "user", Exporter: exporter})
+	ctx, parent := tracer.Start(context.Background(), "parent", SPAN_KIND_SERVER)
+	_, child := tracer.Start(ctx, "child", SPAN_KIND_CLIENT)
+	child.SetAttribute("retry", 2)
+	child.End()
+	parent.End()
+
+	var body map[string]interface{}
+	select {
+	case body = <-requests:
+	case <-time.After(time.Second):
+		t.Fatal("full batch not sent")
+	}
+	resource := body["resourceSpans"].([]interface{})[0].(map[string]interface{})
+	spans := resource["scopeSpans"].([]interface{})[0].(map[string]interface{})["spans"].([]interface{})
+	first := spans[0].(map[string]interface{})
+	attr := first["attributes"].([]interface{})[0].(map[string]interface{})
+	if len(spans) != 2 || first["name"] != "child" || first["kind"] != float64(SPAN_KIND_CLIENT) ||
+		first["parentSpanId"] != parent.SpanContext().SpanID.String() ||
+		attr["value"].(map[string]interface{})["intValue"] != "2" {
+		t.Fatal(body)
+	}
+
+	// Close导出不足一批的Span
+	_, span := tracer.Start(context.Background(), "last", SPAN_KIND_INTERNAL)
+	span.End()
+	tracer.Close()
+	select {
+	case <-requests:
+	default:
+		t.Fatal("pending spans not flushed on close")
+	}
+}